@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// aliasRequest is the body of a request to point an alias at a redirect.
+type aliasRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// HandleGetAliases lists the aliases of the namespace of the request's host, only those of the redirect in the "key"
+// query parameter if there is one. Responds with a 404 status if that redirect doesn't exist.
+func (r *RedirectorController) HandleGetAliases(c *gin.Context) {
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// List the aliases of the redirect the key refers to, which may be an alias itself.
+	key := c.Query("key")
+	if key != "" {
+		var value []byte
+		key, value, err = r.lookupKey(ns, key)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if value == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": helpers.NewDoesNotExistError([]byte(key)).Error()})
+			return
+		}
+	}
+
+	aliases, err := models.ListAliases(ns.Aliases, key)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"aliases": aliases})
+}
+
+// HandlePutAlias points the alias in the path at the redirect of the key in the request body, creating the alias if it
+// doesn't exist yet. Aliases of aliases are pointed at the redirect they stand for.
+// Responds with a 400 status if the key policy rejects the alias, a 404 status if the redirect doesn't exist, a 409
+// status if the alias is the key of a redirect, or a 501 status if aliases aren't stored.
+func (r *RedirectorController) HandlePutAlias(c *gin.Context) {
+	// Aliases are keys, so the same rules apply.
+	alias := r.KeyPolicy.Normalize(c.Param("alias"))
+	if err := r.KeyPolicy.Validate(alias); err != nil {
+		var ke *helpers.KeyError
+		if errors.As(err, &ke) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ke.Error(), "rule": ke.Rule})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var request aliasRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if ns.Aliases == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "aliases are not stored by this server"})
+		return
+	}
+
+	// The alias is checked and stored in one transaction, so that neither a redirect of its key can be created nor the
+	// redirect it points at deleted in between.
+	var key string
+	err = r.atomically(ns, func(ns *models.Namespace) error {
+		// Redirects take precedence over aliases, an alias shadowed by one would never be used.
+		_, existing, err := r.findKey(ns, alias)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return helpers.NewAlreadyExistsError([]byte(alias))
+		}
+
+		// Aliases can only point at redirects that exist.
+		var value []byte
+		key, value, err = r.lookupKey(ns, request.Key)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return helpers.NewDoesNotExistError([]byte(key))
+		}
+
+		return ns.Aliases.Put([]byte(alias), []byte(key))
+	})
+	if err != nil {
+		var ae *helpers.AlreadyExistsError
+		var dne *helpers.DoesNotExistError
+		switch {
+		case errors.As(err, &ae):
+			c.JSON(http.StatusConflict, gin.H{"error": ae.Error()})
+		case errors.As(err, &dne):
+			c.JSON(http.StatusNotFound, gin.H{"error": dne.Error()})
+		default:
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "alias": models.Alias{Alias: alias, Key: key}})
+}
+
+// HandleDeleteAlias removes the alias in the path, leaving the redirect it stands for as it is.
+// Responds with a 404 status if there is no such alias, or a 501 status if aliases aren't stored.
+func (r *RedirectorController) HandleDeleteAlias(c *gin.Context) {
+	alias := r.KeyPolicy.Normalize(c.Param("alias"))
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if ns.Aliases == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "aliases are not stored by this server"})
+		return
+	}
+
+	if err := ns.Aliases.Delete([]byte(alias)); err != nil {
+		var dne *helpers.DoesNotExistError
+		if errors.As(err, &dne) {
+			c.JSON(http.StatusNotFound, gin.H{"error": dne.Error()})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+func setupAliasRouter(t *testing.T) (*gin.Engine, *models.KVWrapper) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	aliases := models.NamespaceAliases(store.DB, "")
+	_ = redirects.Put([]byte("q4"), []byte("https://example.com/reports/q4"))
+	_ = redirects.Put([]byte("docs"), []byte("https://example.com/docs"))
+	controller := &RedirectorController{KV: redirects, Aliases: aliases}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+	router.POST("/:key", controller.HandlePost)
+	router.PUT("/:key", controller.HandlePutWithKey)
+	router.DELETE("/:key", controller.HandleDelete)
+	router.GET("/api/aliases", controller.HandleGetAliases)
+	router.PUT("/api/aliases/:alias", controller.HandlePutAlias)
+	router.DELETE("/api/aliases/:alias", controller.HandleDeleteAlias)
+	return router, redirects
+}
+
+func Test_HandlePutAlias(t *testing.T) {
+	router, _ := setupAliasRouter(t)
+
+	tests := []struct {
+		name         string
+		alias        string
+		body         interface{}
+		expectStatus int
+		expectKey    string
+	}{
+		{"alias", "q4-report", gin.H{"key": "q4"}, http.StatusOK, "q4"},
+		{"alias of an alias", "2026-q4", gin.H{"key": "q4-report"}, http.StatusOK, "q4"},
+		{"repoint", "2026-q4", gin.H{"key": "docs"}, http.StatusOK, "docs"},
+		{"missing key", "handbook", gin.H{}, http.StatusBadRequest, ""},
+		{"unknown key", "handbook", gin.H{"key": "missing"}, http.StatusNotFound, ""},
+		{"key of a redirect", "docs", gin.H{"key": "q4"}, http.StatusConflict, ""},
+		{"invalid alias", "q4.report", gin.H{"key": "q4"}, http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doJSON(router, http.MethodPut, "/api/aliases/"+test.alias, test.body)
+			assert.Equal(t, test.expectStatus, rec.Code)
+			if test.expectKey != "" {
+				var body struct {
+					Alias models.Alias `json:"alias"`
+				}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.Equal(t, models.Alias{Alias: test.alias, Key: test.expectKey}, body.Alias)
+			}
+		})
+	}
+}
+
+func Test_HandleGet_Aliases(t *testing.T) {
+	router, _ := setupAliasRouter(t)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/api/aliases/q4-report", gin.H{"key": "q4"}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/api/aliases/2026-q4", gin.H{"key": "q4"}).Code)
+
+	// Aliases resolve to the redirect they stand for.
+	rec := doJSON(router, http.MethodGet, "/q4-report/", nil)
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "https://example.com/reports/q4", rec.Header().Get("Location"))
+	rec = doJSON(router, http.MethodGet, "/2026-q4/json", nil)
+	assert.JSONEq(t, `{"key":"q4","url":"https://example.com/reports/q4"}`, rec.Body.String())
+
+	// A single PUT updates every alias.
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/2026-q4", gin.H{"url": "https://example.com/q4"}).Code)
+	for _, path := range []string{"/q4/", "/q4-report/", "/2026-q4/"} {
+		rec := doJSON(router, http.MethodGet, path, nil)
+		assert.Equal(t, "https://example.com/q4", rec.Header().Get("Location"), path)
+	}
+
+	// Aliases can't be reused as keys.
+	assert.Equal(t, http.StatusConflict, doJSON(router, http.MethodPost, "/q4-report", gin.H{"url": "https://example.com"}).Code)
+
+	// Listing.
+	rec = doJSON(router, http.MethodGet, "/api/aliases?key=q4-report", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"aliases":[{"alias":"2026-q4","key":"q4"},{"alias":"q4-report","key":"q4"}]}`, rec.Body.String())
+	rec = doJSON(router, http.MethodGet, "/api/aliases?key=docs", nil)
+	assert.JSONEq(t, `{"aliases":[]}`, rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodGet, "/api/aliases?key=missing", nil).Code)
+}
+
+func Test_HandleDelete_Aliases(t *testing.T) {
+	router, redirects := setupAliasRouter(t)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/api/aliases/q4-report", gin.H{"key": "q4"}).Code)
+
+	// Redirects with aliases can't be deleted, nor can they be deleted through an alias.
+	rec := doJSON(router, http.MethodDelete, "/q4", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.JSONEq(t, `{"error":"key \"q4\" is still in use: 1 aliases","aliases":[{"alias":"q4-report","key":"q4"}]}`,
+		rec.Body.String())
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodDelete, "/q4-report", nil).Code)
+
+	// Removing the alias leaves the redirect as it is.
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodDelete, "/api/aliases/q4-report", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodDelete, "/api/aliases/q4-report", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodGet, "/q4-report/text", nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodGet, "/q4/text", nil).Code)
+
+	// Now the redirect can go.
+	rec = doJSON(router, http.MethodDelete, "/q4", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"success","deleted":{"url":"https://example.com/reports/q4","key":"q4"}}`, rec.Body.String())
+	value, _ := redirects.Get([]byte("q4"))
+	assert.Nil(t, value)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, http.MethodDelete, "/q4", nil).Code)
+}
+
+func Test_HandleAlias_NotStored(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	_ = redirects.Put([]byte("q4"), []byte("https://example.com/reports/q4"))
+	controller := &RedirectorController{KV: redirects}
+
+	router := gin.New()
+	router.PUT("/api/aliases/:alias", controller.HandlePutAlias)
+	router.DELETE("/api/aliases/:alias", controller.HandleDeleteAlias)
+
+	assert.Equal(t, http.StatusNotImplemented, doJSON(router, http.MethodPut, "/api/aliases/q4-report", gin.H{"key": "q4"}).Code)
+	assert.Equal(t, http.StatusNotImplemented, doJSON(router, http.MethodDelete, "/api/aliases/q4-report", nil).Code)
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// maxChainHops is the most links of ours a URL may go through, so that following a chain always ends.
+const maxChainHops = 32
+
+// chainHop is one of our links that a URL points to.
+type chainHop struct {
+	ns    *models.Namespace
+	key   string
+	mode  string
+	query url.Values
+}
+
+// namespaceHost returns the host of the domain of ns, or an empty string for the default namespace.
+func namespaceHost(ns *models.Namespace) string {
+	if ns.Domain == nil {
+		return ""
+	}
+	return ns.Domain.Host
+}
+
+// linkID identifies key across namespaces. Hosts never contain a "/".
+func linkID(ns *models.Namespace, key string) string {
+	return namespaceHost(ns) + "/" + key
+}
+
+// resolveHop returns the link rawURL points to if it's one of ours: a key on a registered domain, or on one of the
+// public hosts serving the default namespace. Returns nil if it isn't.
+func (r *RedirectorController) resolveHop(rawURL string) (*chainHop, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil
+	}
+	host := helpers.NormalizeHost(u.Host)
+
+	var ns *models.Namespace
+	if r.Namespaces != nil {
+		if ns, err = r.Namespaces.Resolve(host); err != nil {
+			return nil, err
+		}
+	}
+	if ns == nil {
+		for _, public := range r.PublicHosts {
+			if helpers.NormalizeHost(public) == host {
+				ns = r.defaultNamespace()
+				break
+			}
+		}
+	}
+	if ns == nil {
+		return nil, nil
+	}
+
+	// Mirror the "/:key/*mode" route.
+	key, rest, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if key == "" {
+		return nil, nil
+	}
+	return &chainHop{ns: ns, key: key, mode: "/" + rest, query: u.Query()}, nil
+}
+
+// followChain follows the links of ours that redirect leads through, and returns where it finally ends up and how many
+// links it went through. Returns a PolicyError if it leads back to a link it already went through, redirect included,
+// or through too many links.
+func (r *RedirectorController) followChain(ns *models.Namespace, redirect models.Redirect) (string, int, error) {
+	return r.followPlannedChain(ns, redirect, nil)
+}
+
+// followPlannedChain is followChain with the redirects of planned, by linkID, standing in for what's stored under their
+// keys, so that changes made together are checked against each other.
+func (r *RedirectorController) followPlannedChain(ns *models.Namespace, redirect models.Redirect,
+	planned map[string]models.Redirect) (string, int, error) {
+	destination, err := redirect.Destination("", nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	self := linkID(ns, redirect.Key)
+	visited := map[string]bool{self: true}
+	for hops := 0; ; hops++ {
+		hop, err := r.resolveHop(destination)
+		if err != nil || hop == nil {
+			return destination, hops, err
+		}
+
+		key, value, err := r.lookupKey(hop.ns, hop.key)
+		if err != nil {
+			return "", hops, err
+		}
+		id := linkID(hop.ns, key)
+
+		// The redirects being written stand in for what's stored under their keys.
+		next, ok := planned[id]
+		if id == self {
+			next, ok = redirect, true
+		}
+		if !ok {
+			if value == nil {
+				return destination, hops, nil
+			}
+			if next, err = models.DecodeRedirect([]byte(key), value); err != nil {
+				return "", hops, err
+			}
+		}
+
+		// Only plain links and prefixes redirect, like they would when requested.
+		extraPath := ""
+		switch hop.mode {
+		case "/":
+		case "/json", "/text", "/qr":
+			return destination, hops, nil
+		default:
+			if next.PathMode == models.PathModeNone {
+				return destination, hops, nil
+			}
+			extraPath = strings.TrimPrefix(hop.mode, "/")
+		}
+
+		if visited[id] {
+			return "", hops, helpers.NewPolicyError(helpers.URLRuleLoop,
+				fmt.Sprintf("%s leads back to a link it came from", destination))
+		}
+		if hops == maxChainHops {
+			return "", hops, helpers.NewPolicyError(helpers.URLRuleChain,
+				fmt.Sprintf("the URL goes through more than %d links", maxChainHops))
+		}
+		visited[id] = true
+
+		to, err := next.Destination(extraPath, hop.query)
+		if errors.Is(err, models.ErrDotSegment) {
+			// The link refuses the path, so the chain ends there.
+			return destination, hops, nil
+		}
+		if err != nil {
+			return "", hops, err
+		}
+		destination = to
+	}
+}
+
+// checkChain makes sure that the URL of redirect doesn't lead back to it through our own links, responding with a 422
+// if it does, and reports whether it doesn't. Chains through more than MaxChainDepth links are flattened to where they
+// end up, unless redirect passes paths or query strings along, which would then end up somewhere else. Where they end
+// up must comply with the URL policy to be flattened to, since the redirect then leads there directly.
+func (r *RedirectorController) checkChain(c *gin.Context, ns *models.Namespace, redirect *models.Redirect) bool {
+	destination, hops, err := r.followChain(ns, *redirect)
+	if err != nil {
+		return rejectURL(c, err)
+	}
+
+	if r.MaxChainDepth > 0 && hops > r.MaxChainDepth &&
+		redirect.PathMode == models.PathModeNone && redirect.QueryMode == models.QueryModeDrop {
+		if !r.checkURL(c, destination) {
+			return false
+		}
+		logging.GetLogger().Debugf("flattening %q from %q to %q (%d links)", redirect.Key, redirect.URL, destination, hops)
+		redirect.URL = destination
+		redirect.Params = nil
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// mapKV returns a KV serving the redirects in values, and accepting writes without storing them.
+func mapKV(values map[string]string) *mockKVWrapper {
+	return &mockKVWrapper{
+		getFunc: func(key []byte) ([]byte, error) {
+			if value, ok := values[string(key)]; ok {
+				return []byte(value), nil
+			}
+			return nil, nil
+		},
+		exclusivePutFunc: func(key []byte, value []byte) error { return nil },
+		replaceFunc: func(key []byte, value []byte) ([]byte, error) {
+			return []byte(values[string(key)]), nil
+		},
+	}
+}
+
+func Test_HandlePost_Chains(t *testing.T) {
+	long := map[string]string{}
+	for i := 0; i < 40; i++ {
+		long[fmt.Sprintf("k%d", i)] = fmt.Sprintf("https://lnk.now/k%d", i+1)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		stored   map[string]string
+		team     map[string]string
+		depth    int
+		body     gin.H
+		wantCode int
+		wantRule string
+		wantURL  string
+	}{
+		{
+			name:     "external",
+			body:     gin.H{"url": "https://example.com"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://example.com",
+		},
+		{
+			name:     "self",
+			body:     gin.H{"url": "https://lnk.now/a"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "self with another host spelling",
+			body:     gin.H{"url": "http://LNK.now:8080/a?x=1"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "cycle",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://lnk.now/a"},
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "cycle on update",
+			method:   http.MethodPut,
+			stored:   map[string]string{"a": "https://example.com", "b": "https://lnk.now/a"},
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "cycle through a domain",
+			stored:   map[string]string{"b": "https://go.team/c"},
+			team:     map[string]string{"c": "https://lnk.now/a"},
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "same key on another domain",
+			team:     map[string]string{"a": "https://example.com"},
+			body:     gin.H{"url": "https://go.team/a"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://go.team/a",
+		},
+		{
+			name:     "existing cycle",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://lnk.now/b"},
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "cycle through a prefix",
+			stored:   map[string]string{"b": `{"url": "https://lnk.now/a", "path_mode": "append"}`},
+			body:     gin.H{"url": "https://lnk.now/b/x", "path_mode": "append"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleLoop,
+		},
+		{
+			name:     "extra path without a prefix",
+			stored:   map[string]string{"b": "https://lnk.now/a"},
+			body:     gin.H{"url": "https://lnk.now/b/x"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://lnk.now/b/x",
+		},
+		{
+			name:     "format",
+			body:     gin.H{"url": "https://lnk.now/a/qr"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://lnk.now/a/qr",
+		},
+		{
+			name:     "unknown key",
+			body:     gin.H{"url": "https://lnk.now/missing"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://lnk.now/missing",
+		},
+		{
+			name:     "other host",
+			body:     gin.H{"url": "https://example.com/a"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://example.com/a",
+		},
+		{
+			name:     "too long",
+			stored:   long,
+			body:     gin.H{"url": "https://lnk.now/k0"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleChain,
+		},
+		{
+			name:     "short chain",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://example.com/c"},
+			depth:    2,
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://lnk.now/b",
+		},
+		{
+			name:     "flattened",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://example.com/c"},
+			depth:    1,
+			body:     gin.H{"url": "https://lnk.now/b", "params": gin.H{"utm_source": "lnk"}},
+			wantCode: http.StatusOK,
+			wantURL:  "https://example.com/c",
+		},
+		{
+			name: "flattened through a prefix",
+			stored: map[string]string{
+				"b": `{"url": "https://lnk.now/c", "path_mode": "append", "query_mode": "override"}`,
+				"c": `{"url": "https://example.com/c", "path_mode": "append", "query_mode": "override"}`,
+			},
+			depth:    1,
+			body:     gin.H{"url": "https://lnk.now/b/x?y=1", "params": gin.H{"z": "2"}},
+			wantCode: http.StatusOK,
+			wantURL:  "https://example.com/c/x?y=1&z=2",
+		},
+		{
+			name:     "flattened to a blocked URL",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://blocked.example/c"},
+			depth:    1,
+			body:     gin.H{"url": "https://lnk.now/b"},
+			wantCode: http.StatusUnprocessableEntity,
+			wantRule: helpers.URLRuleBlockedDomain,
+		},
+		{
+			name:     "prefixes aren't flattened",
+			stored:   map[string]string{"b": "https://lnk.now/c", "c": "https://example.com/c"},
+			depth:    1,
+			body:     gin.H{"url": "https://lnk.now/b", "path_mode": "append"},
+			wantCode: http.StatusOK,
+			wantURL:  "https://lnk.now/b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			controller := &RedirectorController{
+				KV: mapKV(test.stored),
+				Namespaces: mockResolver{"go.team": {
+					Domain:    &models.Domain{Host: "go.team"},
+					Redirects: mapKV(test.team),
+				}},
+				PublicHosts:   []string{"lnk.now"},
+				MaxChainDepth: test.depth,
+				URLPolicy:     &helpers.URLPolicy{BlockDomains: []string{"blocked.example"}},
+			}
+			router := gin.New()
+			router.POST("/:key", controller.HandlePost)
+			router.PUT("/:key", controller.HandlePutWithKey)
+
+			method := test.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			body, _ := json.Marshal(test.body)
+			req := httptest.NewRequest(method, "/a", bytes.NewReader(body))
+			req.Host = "lnk.now"
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantCode, rec.Code, rec.Body.String())
+			var response struct {
+				Rule     string          `json:"rule"`
+				Redirect models.Redirect `json:"redirect"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, test.wantRule, response.Rule)
+			assert.Equal(t, test.wantURL, response.Redirect.URL)
+		})
+	}
+}
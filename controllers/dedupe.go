@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/middleware"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// dedupeKey returns the key of value in the dedupe index, for the API key the request was authenticated with.
+func dedupeKey(c *gin.Context, value models.Redirect) []byte {
+	return models.DedupeKey(c.GetString(middleware.APIKeyIDContextKey), helpers.NormalizeURL(value.URL))
+}
+
+// findDuplicate returns the redirect that the request's API key created in ns for the same URL as value, with the
+// same options and description, or nil if there is none.
+func (r *RedirectorController) findDuplicate(c *gin.Context, ns *models.Namespace, value models.Redirect) (*models.Redirect, error) {
+	if ns.Dedupe == nil {
+		return nil, nil
+	}
+	key, err := ns.Dedupe.Get(dedupeKey(c, value))
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	// The redirect may have been changed or deleted since.
+	data, err := ns.Redirects.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	existing, err := models.DecodeRedirect(key, data)
+	if err != nil {
+		return nil, err
+	}
+	if !sameRedirect(existing, value) {
+		return nil, nil
+	}
+	return &existing, nil
+}
+
+// indexDuplicate adds value to the dedupe index of ns, for the API key the request was authenticated with.
+func (r *RedirectorController) indexDuplicate(c *gin.Context, ns *models.Namespace, value models.Redirect) error {
+	if ns.Dedupe == nil {
+		return nil
+	}
+	return models.IndexDuplicate(ns.Dedupe, c.GetString(middleware.APIKeyIDContextKey), value.Key,
+		helpers.NormalizeURL(value.URL))
+}
+
+// sameRedirect reports whether a and b lead to the same normalized URL the same way, and have the same title, tags,
+// and notes, whatever their keys. Returning a redirect described differently would drop the caller's description.
+func sameRedirect(a models.Redirect, b models.Redirect) bool {
+	if helpers.NormalizeURL(a.URL) != helpers.NormalizeURL(b.URL) || a.PathMode != b.PathMode ||
+		a.QueryMode != b.QueryMode || len(a.Params) != len(b.Params) || a.Title != b.Title || a.Notes != b.Notes ||
+		!slices.Equal(a.Tags, b.Tags) {
+		return false
+	}
+	for name, value := range a.Params {
+		if other, ok := b.Params[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
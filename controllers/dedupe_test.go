@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/middleware"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+func Test_HandlePost_Dedupe(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := models.NamespaceRedirects(store.DB, "")
+	dedupe := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.DedupeBucket)}
+	controller := &RedirectorController{KV: redirects, Dedupe: dedupe}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(middleware.APIKeyIDContextKey, c.GetHeader("X-Test-Key"))
+	})
+	router.POST("/", controller.HandlePost)
+	router.POST("/:key", controller.HandlePost)
+	router.PUT("/:key", controller.HandlePutWithKey)
+
+	first := postAs(t, router, "/", "a", gin.H{"url": "https://Example.com"})
+	assert.False(t, first.Deduplicated)
+
+	tests := []struct {
+		name        string
+		path        string
+		apiKey      string
+		body        gin.H
+		wantSameKey bool
+	}{
+		{"same URL", "/?dedupe=true", "a", gin.H{"url": "https://example.com:443/"}, true},
+		{"without dedupe", "/", "a", gin.H{"url": "https://example.com"}, false},
+		{"another API key", "/?dedupe=true", "b", gin.H{"url": "https://example.com"}, false},
+		{"other options", "/?dedupe=true", "a", gin.H{"url": "https://example.com", "query_mode": "append"}, false},
+		{"other title", "/?dedupe=true", "a", gin.H{"url": "https://example.com", "title": "Example"}, false},
+		{"other tags", "/?dedupe=true", "a", gin.H{"url": "https://example.com", "tags": []string{"docs"}}, false},
+		{"other URL", "/?dedupe=true", "a", gin.H{"url": "https://example.com/other"}, false},
+		{"explicit key", "/custom?dedupe=true", "a", gin.H{"url": "https://example.com"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := postAs(t, router, test.path, test.apiKey, test.body)
+			assert.Equal(t, test.wantSameKey, r.Deduplicated)
+			assert.Equal(t, test.wantSameKey, r.Redirect.Key == first.Redirect.Key)
+		})
+	}
+
+	// The latest redirect of the URL is the one found, as long as it still leads there.
+	latest := postAs(t, router, "/", "c", gin.H{"url": "https://example.com/latest"})
+	assert.Equal(t, latest.Redirect.Key, postAs(t, router, "/?dedupe=true", "c", gin.H{"url": "https://example.com/latest"}).Redirect.Key)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/"+latest.Redirect.Key, gin.H{"url": "https://example.com/moved"}).Code)
+	r := postAs(t, router, "/?dedupe=true", "c", gin.H{"url": "https://example.com/latest"})
+	assert.False(t, r.Deduplicated)
+	assert.NotEqual(t, latest.Redirect.Key, r.Redirect.Key)
+
+	// The index follows the redirect to its new URL.
+	r = postAs(t, router, "/?dedupe=true", "c", gin.H{"url": "https://example.com/moved"})
+	assert.True(t, r.Deduplicated)
+	assert.Equal(t, latest.Redirect.Key, r.Redirect.Key)
+}
+
+// dedupeResponse is the response to a POST request.
+type dedupeResponse struct {
+	Redirect     models.Redirect `json:"redirect"`
+	Deduplicated bool            `json:"deduplicated"`
+}
+
+// postAs creates a redirect as the API key apiKey.
+func postAs(t *testing.T, router *gin.Engine, path string, apiKey string, body gin.H) dedupeResponse {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-Key", apiKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var response dedupeResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/middleware"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// DomainController is responsible for the administration of registered domains and their API keys. URLPolicy is what
+// the domains' fallback URLs must comply with, like redirect destinations.
+type DomainController struct {
+	Store     *models.DomainStore
+	URLPolicy *helpers.URLPolicy
+}
+
+// domainKeyRequest is the body of a request to revoke a domain API key.
+type domainKeyRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// HandleList returns every registered domain.
+func (d *DomainController) HandleList(c *gin.Context) {
+	domains, err := d.Store.List()
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
+
+// HandleGet returns the configuration of a single registered domain, or a 404 if the host is not registered.
+func (d *DomainController) HandleGet(c *gin.Context) {
+	domain, err := d.Store.Get(helpers.NormalizeHost(c.Param("host")))
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if domain == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"domain": domain})
+}
+
+// HandlePost registers a new domain. Responds with a 409 status if the host is already registered.
+func (d *DomainController) HandlePost(c *gin.Context) {
+	var domain models.Domain
+	if err := c.ShouldBindJSON(&domain); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	domain.Host = helpers.NormalizeHost(domain.Host)
+	if !d.checkFallback(c, domain) {
+		return
+	}
+
+	err := d.Store.Create(domain)
+	if err != nil {
+		var ae *helpers.AlreadyExistsError
+		if errors.As(err, &ae) {
+			c.JSON(http.StatusConflict, gin.H{"error": ae.Error()})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "domain": domain})
+}
+
+// HandlePut replaces the configuration of a registered domain. Responds with a 409 status if the host is not registered.
+func (d *DomainController) HandlePut(c *gin.Context) {
+	var domain models.Domain
+	domain.Host = helpers.NormalizeHost(c.Param("host"))
+	if err := c.ShouldBindJSON(&domain); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The host in the path always wins, a domain can't be renamed.
+	domain.Host = helpers.NormalizeHost(c.Param("host"))
+	if !d.checkFallback(c, domain) {
+		return
+	}
+
+	err := d.Store.Update(domain)
+	if err != nil {
+		var dne *helpers.DoesNotExistError
+		if errors.As(err, &dne) {
+			c.JSON(http.StatusConflict, gin.H{"error": dne.Error()})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "domain": domain})
+}
+
+// HandleDelete removes a registered domain. Responds with a 404 status if the host is not registered and a 409 status
+// if the domain still has redirects.
+func (d *DomainController) HandleDelete(c *gin.Context) {
+	host := helpers.NormalizeHost(c.Param("host"))
+
+	err := d.Store.Delete(host)
+	if err != nil {
+		var dne *helpers.DoesNotExistError
+		var iu *helpers.InUseError
+		switch {
+		case errors.As(err, &dne):
+			c.JSON(http.StatusNotFound, gin.H{"error": dne.Error()})
+		case errors.As(err, &iu):
+			c.JSON(http.StatusConflict, gin.H{"error": iu.Error()})
+		default:
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// HandlePostKey generates a new API key for a registered domain. The token is only returned in this response.
+func (d *DomainController) HandlePostKey(c *gin.Context) {
+	ns, ok := d.domainNamespace(c)
+	if !ok {
+		return
+	}
+
+	// Generate a random token
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(raw)
+
+	if err := ns.APIKeys.Put(middleware.TokenHash(token), []byte(ns.Domain.Host)); err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "host": ns.Domain.Host, "token": token})
+}
+
+// HandleDeleteKey revokes an API key of a registered domain. Responds with a 404 status if the key is unknown.
+func (d *DomainController) HandleDeleteKey(c *gin.Context) {
+	var request domainKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ns, ok := d.domainNamespace(c)
+	if !ok {
+		return
+	}
+
+	if err := ns.APIKeys.Delete(middleware.TokenHash(request.Token)); err != nil {
+		var dne *helpers.DoesNotExistError
+		if errors.As(err, &dne) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// checkFallback responds with a 422 naming the rule that rejects the fallback URL of domain if the URL policy doesn't
+// allow it, and reports whether it does.
+func (d *DomainController) checkFallback(c *gin.Context, domain models.Domain) bool {
+	if domain.FallbackURL == "" {
+		return true
+	}
+	return checkURLPolicy(c, d.URLPolicy, domain.FallbackURL)
+}
+
+// domainNamespace resolves the namespace of the domain in the path, responding with an error if it can't be found.
+func (d *DomainController) domainNamespace(c *gin.Context) (*models.Namespace, bool) {
+	ns, err := d.Store.Resolve(helpers.NormalizeHost(c.Param("host")))
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if ns == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not found"})
+		return nil, false
+	}
+	return ns, true
+}
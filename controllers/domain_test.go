@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/middleware"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// mockResolver resolves hosts to fixed namespaces.
+type mockResolver map[string]*models.Namespace
+
+func (m mockResolver) Resolve(host string) (*models.Namespace, error) {
+	return m[host], nil
+}
+
+func setupDomainStore(t *testing.T) *models.DomainStore {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return &models.DomainStore{DB: db}
+}
+
+func setupDomainRouter(store *models.DomainStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controller := &DomainController{Store: store, URLPolicy: &helpers.URLPolicy{BlockDomains: []string{"blocked.example"}}}
+	router := gin.New()
+	router.GET("/api/domains", controller.HandleList)
+	router.POST("/api/domains", controller.HandlePost)
+	router.GET("/api/domains/:host", controller.HandleGet)
+	router.PUT("/api/domains/:host", controller.HandlePut)
+	router.DELETE("/api/domains/:host", controller.HandleDelete)
+	router.POST("/api/domains/:host/keys", controller.HandlePostKey)
+	router.DELETE("/api/domains/:host/keys", controller.HandleDeleteKey)
+	return router
+}
+
+func doJSON(router *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDomainController(t *testing.T) {
+	store := setupDomainStore(t)
+	router := setupDomainRouter(store)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         interface{}
+		expectStatus int
+	}{
+		{"create", http.MethodPost, "/api/domains", gin.H{"host": "Go.Team-A", "root_text": "Team A"}, http.StatusOK},
+		{"create_duplicate", http.MethodPost, "/api/domains", gin.H{"host": "go.team-a"}, http.StatusConflict},
+		{"create_invalid_host", http.MethodPost, "/api/domains", gin.H{"host": "not a host"}, http.StatusBadRequest},
+		{"create_blocked_fallback", http.MethodPost, "/api/domains",
+			gin.H{"host": "go.team-b", "fallback_url": "https://blocked.example/{key}"}, http.StatusUnprocessableEntity},
+		{"get", http.MethodGet, "/api/domains/go.team-a", nil, http.StatusOK},
+		{"get_missing", http.MethodGet, "/api/domains/missing.example", nil, http.StatusNotFound},
+		{"update", http.MethodPut, "/api/domains/go.team-a", gin.H{"root_text": "Team A links"}, http.StatusOK},
+		{"update_fallback", http.MethodPut, "/api/domains/go.team-a",
+			gin.H{"fallback_url": "https://example.com/{key}"}, http.StatusOK},
+		{"update_blocked_fallback", http.MethodPut, "/api/domains/go.team-a",
+			gin.H{"fallback_url": "https://blocked.example/{key}"}, http.StatusUnprocessableEntity},
+		{"update_missing", http.MethodPut, "/api/domains/missing.example", gin.H{"root_text": "x"}, http.StatusConflict},
+		{"list", http.MethodGet, "/api/domains", nil, http.StatusOK},
+		{"create_key_missing_domain", http.MethodPost, "/api/domains/missing.example/keys", nil, http.StatusNotFound},
+		{"delete_key_unknown", http.MethodDelete, "/api/domains/go.team-a/keys", gin.H{"token": "unknown"}, http.StatusNotFound},
+		{"delete_key_bind_error", http.MethodDelete, "/api/domains/go.team-a/keys", gin.H{}, http.StatusBadRequest},
+		{"delete", http.MethodDelete, "/api/domains/go.team-a", nil, http.StatusOK},
+		{"delete_missing", http.MethodDelete, "/api/domains/go.team-a", nil, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doJSON(router, test.method, test.path, test.body)
+			assert.Equal(t, test.expectStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestDomainController_Keys(t *testing.T) {
+	store := setupDomainStore(t)
+	router := setupDomainRouter(store)
+
+	rec := doJSON(router, http.MethodPost, "/api/domains", gin.H{"host": "lnk.now"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Create a key and make sure it's stored in the domain's namespace
+	rec = doJSON(router, http.MethodPost, "/api/domains/lnk.now/keys", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+
+	ns, err := store.Resolve("lnk.now")
+	assert.NoError(t, err)
+	value, err := ns.APIKeys.Get(middleware.TokenHash(response.Token))
+	assert.NoError(t, err)
+	assert.Equal(t, "lnk.now", string(value))
+
+	// A domain with redirects can't be deleted
+	assert.NoError(t, ns.Redirects.Put([]byte("docs"), []byte("https://example.com")))
+	rec = doJSON(router, http.MethodDelete, "/api/domains/lnk.now", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Revoke the key
+	rec = doJSON(router, http.MethodDelete, "/api/domains/lnk.now/keys", gin.H{"token": response.Token})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	value, err = ns.APIKeys.Get(middleware.TokenHash(response.Token))
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+}
@@ -17,6 +17,7 @@ type mockKVWrapper struct {
 	exclusivePutFunc func(key []byte, value []byte) error
 	replaceFunc      func(key []byte, value []byte) ([]byte, error)
 	deleteFunc       func(key []byte) error
+	scanFunc         func(prefix []byte, fn func(key []byte, value []byte) error) error
 }
 
 func (m *mockKVWrapper) Get(key []byte) ([]byte, error) {
@@ -34,6 +35,13 @@ func (m *mockKVWrapper) Replace(key []byte, value []byte) ([]byte, error) {
 func (m *mockKVWrapper) Delete(key []byte) error {
 	return m.deleteFunc(key)
 }
+func (m *mockKVWrapper) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	// Mocks that don't scan are empty, e.g. when generated keys are counted.
+	if m.scanFunc == nil {
+		return nil
+	}
+	return m.scanFunc(prefix, fn)
+}
 
 func TestHealthController_HandleGet(t *testing.T) {
 	tests := []struct {
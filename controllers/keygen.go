@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+const (
+	// maxKeyAttempts is how many generated keys are tried before giving up on creating a redirect.
+	maxKeyAttempts = 5
+	// maxKeyDensity is the share of the keyspace of generated keys that a namespace may fill before keys are made
+	// longer, which is about the chance that a generated key is already taken.
+	maxKeyDensity = 0.001
+)
+
+// keyMetrics counts what happens to generated keys: "collisions" with existing keys, "exhausted" attempts to find a
+// free key, and key lengths "grown" to make room for more keys. They're published along with the other expvars.
+var keyMetrics = expvar.NewMap("generated_keys")
+
+// keyGrowthID identifies the generator of a namespace. Generators are told apart by their type and settings rather
+// than compared, not all of them can be.
+type keyGrowthID struct {
+	host      string
+	generator string
+}
+
+// keyGeneratorID describes generator by its type and settings.
+func keyGeneratorID(generator helpers.KeyGenerator) string {
+	return fmt.Sprintf("%T%+v", generator, generator)
+}
+
+// keyGrowth remembers the longer generators that namespaces dense in generated keys use instead of the configured
+// ones. The zero value is ready to use.
+type keyGrowth struct {
+	mu         sync.Mutex
+	generators map[keyGrowthID]helpers.KeyGenerator
+}
+
+// get returns the generator of ns in place of generator. The first time, the keys of ns are counted to make it longer
+// if they're already dense, so that namespaces don't start over with collisions whenever the server restarts.
+func (g *keyGrowth) get(ns *models.Namespace, generator helpers.KeyGenerator) (helpers.KeyGenerator, error) {
+	g.mu.Lock()
+	grown, ok := g.generators[keyGrowthID{namespaceHost(ns), keyGeneratorID(generator)}]
+	g.mu.Unlock()
+	if ok {
+		return grown, nil
+	}
+	if _, ok := generator.(helpers.SizedKeyGenerator); !ok {
+		return generator, nil
+	}
+
+	count, err := countKeys(ns)
+	if err != nil {
+		return nil, err
+	}
+	return g.grow(ns, generator, count), nil
+}
+
+// grow makes generator longer for ns if its count keys are too dense. Returns the generator to use.
+func (g *keyGrowth) grow(ns *models.Namespace, generator helpers.KeyGenerator, count int) helpers.KeyGenerator {
+	id := keyGrowthID{namespaceHost(ns), keyGeneratorID(generator)}
+	grown := helpers.GrowKeyGenerator(generator, count, maxKeyDensity)
+	grownID := keyGeneratorID(grown)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.generators == nil {
+		g.generators = map[keyGrowthID]helpers.KeyGenerator{}
+	}
+	current, ok := g.generators[id]
+	if grownID != id.generator && (!ok || keyGeneratorID(current) != grownID) {
+		keyMetrics.Add("grown", 1)
+		logging.GetLogger().Infof("%d keys are taken in %q, generated keys are made longer", count, id.host)
+	}
+	g.generators[id] = grown
+	return grown
+}
+
+// countKeys returns the number of keys taken in ns, by redirects and aliases alike.
+func countKeys(ns *models.Namespace) (int, error) {
+	redirects, err := models.CountKeys(ns.Redirects)
+	if err != nil {
+		return 0, err
+	}
+	aliases, err := models.CountKeys(ns.Aliases)
+	return redirects + aliases, err
+}
+
+// createRedirect stores data as the redirect of value.Key, which mustn't be taken by a redirect or an alias yet.
+// If generator isn't nil, the key was generated by it, and keys that are taken are replaced with newly generated ones
+// up to maxKeyAttempts times, making them longer if the namespace is running out of keys. value.Key is set to the key
+// the redirect was stored under. Returns an AlreadyExistsError if the key is taken, or a KeyError if a generated key
+// isn't valid.
+func (r *RedirectorController) createRedirect(ns *models.Namespace, value *models.Redirect, data []byte,
+	generator helpers.KeyGenerator) error {
+	base, count := generator, -1
+	for attempt := 1; ; attempt++ {
+		err := r.putNewRedirect(ns, value.Key, data)
+		var ae *helpers.AlreadyExistsError
+		if generator == nil || !errors.As(err, &ae) {
+			return err
+		}
+
+		keyMetrics.Add("collisions", 1)
+		if attempt == maxKeyAttempts {
+			keyMetrics.Add("exhausted", 1)
+			logging.GetLogger().Errorf("no free key found in %d attempts in %q", maxKeyAttempts, namespaceHost(ns))
+			return err
+		}
+
+		// The keys are only counted once, the few keys created in the meantime hardly change how dense they are.
+		if count < 0 {
+			if count, err = countKeys(ns); err != nil {
+				return err
+			}
+		}
+		generator = r.keyGrowth.grow(ns, base, count)
+		key, err := generator.Generate()
+		if err != nil {
+			return err
+		}
+		value.Key = r.KeyPolicy.Normalize(key)
+		if err := r.KeyPolicy.Validate(value.Key); err != nil {
+			return err
+		}
+	}
+}
+
+// putNewRedirect stores data as the redirect of key, unless a redirect or an alias already uses the key.
+func (r *RedirectorController) putNewRedirect(ns *models.Namespace, key string, data []byte) error {
+	if ns.Aliases == nil {
+		return ns.Redirects.ExclusivePut([]byte(key), data)
+	}
+	// Aliases share the keys of redirects, so the key can't be taken by one. The alias is looked up in the same
+	// transaction the redirect is stored in, so that it can't be created in between.
+	return r.atomically(ns, func(ns *models.Namespace) error {
+		target, err := ns.Aliases.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if target != nil {
+			return helpers.NewAlreadyExistsError([]byte(key))
+		}
+		return ns.Redirects.ExclusivePut([]byte(key), data)
+	})
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// fixedKeyGenerator always generates the same key.
+type fixedKeyGenerator string
+
+func (g fixedKeyGenerator) Generate() (string, error) {
+	return string(g), nil
+}
+
+// keyMetric returns the current value of a generated keys metric.
+func keyMetric(name string) int64 {
+	if v, ok := keyMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// listKeyGenerator generates the first of its keys. Like any slice, it can't be compared.
+type listKeyGenerator []string
+
+func (g listKeyGenerator) Generate() (string, error) {
+	return g[0], nil
+}
+
+func Test_HandlePost_KeyCollisions(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	aliases := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.AliasesBucket)}
+
+	// Only two keys can be generated.
+	tiny := helpers.NanoidGenerator{Alphabet: "ab", Length: 1}
+	newRouter := func() *gin.Engine {
+		controller := &RedirectorController{
+			KV:           redirects,
+			Aliases:      aliases,
+			KeyGenerator: tiny,
+			KeyGenerators: map[string]helpers.KeyGenerator{
+				"taken": fixedKeyGenerator("a"),
+				"list":  listKeyGenerator{"c"},
+			},
+		}
+		router := gin.New()
+		router.POST("/", controller.HandlePost)
+		router.POST("/:key", controller.HandlePost)
+		return router
+	}
+	gin.SetMode(gin.TestMode)
+	router := newRouter()
+	post := func(router *gin.Engine, path string) (int, string) {
+		rec := doJSON(router, http.MethodPost, path, gin.H{"url": "https://example.com"})
+		var body struct {
+			Redirect models.Redirect `json:"redirect"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body.Redirect.Key
+	}
+
+	// The namespace is empty, so the keys are short.
+	code, key := post(router, "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, key, 1)
+
+	// Both keys are taken now, the key collides, and the next ones are long enough for the keys taken (11 characters
+	// or more, depending on the key generated first).
+	_ = redirects.Put([]byte("a"), []byte("https://example.com/a"))
+	_ = aliases.Put([]byte("b"), []byte("a"))
+	collisions, grown := keyMetric("collisions"), keyMetric("grown")
+	code, key = post(router, "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.GreaterOrEqual(t, len(key), 11)
+	assert.Equal(t, collisions+1, keyMetric("collisions"))
+	assert.Equal(t, grown+1, keyMetric("grown"))
+
+	// The namespace keeps generating longer keys.
+	code, key = post(router, "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.GreaterOrEqual(t, len(key), 11)
+	assert.Equal(t, collisions+1, keyMetric("collisions"))
+
+	// It does after a restart too, the keys are counted before the first one is generated.
+	code, key = post(newRouter(), "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.GreaterOrEqual(t, len(key), 11)
+	assert.Equal(t, collisions+1, keyMetric("collisions"))
+	assert.Equal(t, grown+2, keyMetric("grown"))
+
+	// Generators that can't be compared are told apart all the same.
+	code, key = post(router, "/?generator=list")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "c", key)
+
+	// Attempts are bounded.
+	collisions = keyMetric("collisions")
+	exhausted := keyMetric("exhausted")
+	code, _ = post(router, "/?generator=taken")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, collisions+maxKeyAttempts, keyMetric("collisions"))
+	assert.Equal(t, exhausted+1, keyMetric("exhausted"))
+
+	// Keys that are asked for aren't replaced.
+	collisions = keyMetric("collisions")
+	code, _ = post(router, "/a")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, collisions, keyMetric("collisions"))
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// QRBatchMaxKeys is the largest number of keys a single batch can render.
+const QRBatchMaxKeys = 500
+
+// Statuses of the keys of a batch, as reported by its manifest.
+const (
+	qrBatchOK          = "ok"
+	qrBatchNotFound    = "not_found"
+	qrBatchNoLogo      = "no_logo"
+	qrBatchInvalidKey  = "invalid_key"
+	qrBatchUnscannable = "unscannable"
+	qrBatchError       = "error"
+)
+
+// QRBatchRequest is the body of a batch QR code request: the keys to render and the parameters shared by all of them.
+type QRBatchRequest struct {
+	Keys   []string          `json:"keys" binding:"required,min=1"`
+	Params *helpers.QRParams `json:"params"`
+}
+
+// HandlePostQRBatch renders the QR codes of a list of keys and streams them back as a ZIP archive, with one file per
+// key and a "manifest.csv" listing every key, its file, what it encodes, and whether it could be rendered.
+// Only PNG and SVG are supported. The domain's QR defaults apply to parameters that aren't set, and codes have a
+// border and are verified unless "border" or "verify" is false.
+func (r *RedirectorController) HandlePostQRBatch(c *gin.Context) {
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var params helpers.QRParams
+	request := QRBatchRequest{Params: &params}
+	if !r.qrParams(c, ns, &params, &request) {
+		return
+	}
+
+	// Exports are printed and handed out, so they get a quiet zone and are verified unless told otherwise.
+	if params.Border == nil {
+		border := true
+		params.Border = &border
+	}
+	if params.Verify == nil {
+		verify := true
+		params.Verify = &verify
+	}
+	if len(request.Keys) > QRBatchMaxKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many keys (%d, max %d)", len(request.Keys), QRBatchMaxKeys)})
+		return
+	}
+
+	// Validate the parameters once for the whole batch.
+	qrConfig, err := helpers.ParseQRParams(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if qrConfig.Format != helpers.QRFormatPNG && qrConfig.Format != helpers.QRFormatSVG {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batches only support png and svg: " + qrConfig.Format})
+		return
+	}
+	warnContrast(c, qrConfig)
+
+	// Nothing can be reported as an error once the archive has started, so failures go in the manifest.
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="qr-codes.zip"`)
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	var manifest strings.Builder
+	manifestCSV := csv.NewWriter(&manifest)
+	_ = manifestCSV.Write([]string{"key", "file", "content", "status"})
+
+	seen := map[string]bool{}
+	for _, key := range request.Keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		file, content, status, err := r.addBatchQR(c, archive, ns, key, qrConfig)
+		if err != nil {
+			// The archive is broken at this point, there's nothing left to do but log it.
+			logging.GetLogger().Error(err)
+			return
+		}
+		_ = manifestCSV.Write([]string{key, file, content, status})
+	}
+
+	manifestCSV.Flush()
+	w, err := archive.Create("manifest.csv")
+	if err == nil {
+		_, err = w.Write([]byte(manifest.String()))
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		logging.GetLogger().Error(err)
+	}
+}
+
+// addBatchQR renders the QR code of key into the archive, and returns the name of its file, what it encodes, and its
+// manifest status. Keys that can't be rendered are only reported in their status, an error means that the archive
+// couldn't be written.
+func (r *RedirectorController) addBatchQR(c *gin.Context, archive *zip.Writer, ns *models.Namespace, key string,
+	conf helpers.QRConfig) (string, string, string, error) {
+	// Keys become file names, keep them from escaping the archive's root.
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", "", qrBatchInvalidKey, nil
+	}
+
+	storedKey, value, err := r.lookupKey(ns, key)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return "", "", qrBatchError, nil
+	}
+	if value == nil {
+		return "", "", qrBatchNotFound, nil
+	}
+	redirect, err := models.DecodeRedirect([]byte(storedKey), value)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return "", "", qrBatchError, nil
+	}
+	content, err := qrContent(c, redirect, conf)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return "", "", qrBatchError, nil
+	}
+
+	var logo []byte
+	if conf.Logo {
+		logo, err = loadLogo(ns, storedKey)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			return "", content, qrBatchError, nil
+		}
+		if logo == nil {
+			return "", content, qrBatchNoLogo, nil
+		}
+	}
+
+	entry, err := r.renderQR(ns, storedKey, helpers.QRCacheKey(content, conf, value, logo), content, conf, logo)
+	var unscannable *helpers.UnscannableError
+	if errors.As(err, &unscannable) {
+		return "", content, qrBatchUnscannable, nil
+	}
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return "", content, qrBatchError, nil
+	}
+
+	file := key + "." + conf.Format
+	w, err := archive.Create(file)
+	if err != nil {
+		return "", "", "", err
+	}
+	if _, err := w.Write(entry.Data); err != nil {
+		return "", "", "", err
+	}
+	return file, content, qrBatchOK, nil
+}
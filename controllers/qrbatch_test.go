@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+func TestHandlePostQRBatch(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	_ = redirects.Put([]byte("docs"), []byte("https://example.org/docs"))
+	_ = redirects.Put([]byte("blog"), []byte("https://example.org/blog"))
+	controller := &RedirectorController{KV: redirects}
+
+	router := gin.New()
+	router.POST("/api/qr/batch", controller.HandlePostQRBatch)
+
+	t.Run("archive", func(t *testing.T) {
+		rec := doJSON(router, http.MethodPost, "/api/qr/batch", gin.H{
+			"keys":   []string{"docs", "missing", "blog", "docs", ".."},
+			"params": gin.H{"format": "svg", "size": 128},
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		files := map[string][]byte{}
+		for _, f := range archive.File {
+			r, _ := f.Open()
+			files[f.Name], _ = io.ReadAll(r)
+		}
+		assert.Len(t, files, 3)
+		assert.True(t, strings.HasPrefix(string(files["docs.svg"]), "<?xml"))
+		assert.Contains(t, string(files["blog.svg"]), `width="128"`)
+
+		manifest, err := csv.NewReader(bytes.NewReader(files["manifest.csv"])).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"key", "file", "content", "status"},
+			{"docs", "docs.svg", "https://example.com/docs", "ok"},
+			{"missing", "", "", "not_found"},
+			{"blog", "blog.svg", "https://example.com/blog", "ok"},
+			{"..", "", "", "invalid_key"},
+		}, manifest)
+	})
+
+	t.Run("target content", func(t *testing.T) {
+		rec := doJSON(router, http.MethodPost, "/api/qr/batch", gin.H{
+			"keys":   []string{"docs"},
+			"params": gin.H{"content": "target"},
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "docs.png", archive.File[0].Name)
+		r, _ := archive.File[1].Open()
+		manifest, _ := csv.NewReader(r).ReadAll()
+		assert.Equal(t, []string{"docs", "docs.png", "https://example.org/docs", "ok"}, manifest[1])
+	})
+
+	t.Run("verified", func(t *testing.T) {
+		manifest := func(params gin.H) []string {
+			rec := doJSON(router, http.MethodPost, "/api/qr/batch", gin.H{"keys": []string{"docs"}, "params": params})
+			assert.Equal(t, http.StatusOK, rec.Code)
+			archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+			if !assert.NoError(t, err) {
+				return nil
+			}
+			r, _ := archive.File[len(archive.File)-1].Open()
+			rows, _ := csv.NewReader(r).ReadAll()
+			return rows[1]
+		}
+
+		// Too small to be scanned, which batches check by default.
+		assert.Equal(t, []string{"docs", "", "https://example.com/docs", "unscannable"}, manifest(gin.H{"size": 10}))
+		assert.Equal(t, []string{"docs", "docs.png", "https://example.com/docs", "ok"}, manifest(gin.H{"size": 10, "verify": false}))
+	})
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"no keys", gin.H{"keys": []string{}}},
+		{"invalid params", gin.H{"keys": []string{"docs"}, "params": gin.H{"level": "X"}}},
+		{"unsupported format", gin.H{"keys": []string{"docs"}, "params": gin.H{"format": "pdf"}}},
+		{"too many keys", gin.H{"keys": make([]string, QRBatchMaxKeys+1)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doJSON(router, http.MethodPost, "/api/qr/batch", test.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// QRPayloadRequest is the body of a structured payload QR code request: the payload and the parameters to render it
+// with.
+type QRPayloadRequest struct {
+	helpers.QRPayload
+	Params *helpers.QRParams `json:"params"`
+}
+
+// HandlePostQR renders a QR code for a structured payload (vCard, WiFi, mailto, or geo) rather than a redirect.
+// The domain's QR defaults apply to parameters that aren't set, and the domain's logo is used if one is requested.
+func (r *RedirectorController) HandlePostQR(c *gin.Context) {
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var params helpers.QRParams
+	request := QRPayloadRequest{Params: &params}
+	if !r.qrParams(c, ns, &params, &request) {
+		return
+	}
+
+	qrConfig, err := helpers.ParseQRParams(params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	warnContrast(c, qrConfig)
+	content, err := request.Encode()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Payloads don't belong to a redirect, so only the domain's logo applies.
+	var logo []byte
+	if qrConfig.Logo {
+		logo, err = loadLogo(ns, models.NamespaceLogoKey)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if logo == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no logo has been uploaded"})
+			return
+		}
+	}
+
+	// Payloads are user supplied and may not fit in a QR code, which is the client's problem.
+	entry, err := r.renderQR(ns, models.NamespaceLogoKey, helpers.QRCacheKey(content, qrConfig, logo), content, qrConfig, logo)
+	var unscannable *helpers.UnscannableError
+	if errors.As(err, &unscannable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, entry.ContentType, entry.Data)
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+func TestHandlePostQR(t *testing.T) {
+	store := setupDomainStore(t)
+	controller := &RedirectorController{
+		KV:    &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)},
+		Logos: &models.KVWrapper{DB: store.DB, Bucket: []byte(models.LogosBucket)},
+	}
+	router := gin.New()
+	router.POST("/api/qr", controller.HandlePostQR)
+
+	tests := []struct {
+		name         string
+		body         gin.H
+		expectStatus int
+		expectType   string
+	}{
+		{
+			name:         "wifi",
+			body:         gin.H{"type": "wifi", "wifi": gin.H{"ssid": "Guest", "password": "secret"}},
+			expectStatus: http.StatusOK,
+			expectType:   "image/png",
+		},
+		{
+			name:         "geo as svg",
+			body:         gin.H{"type": "geo", "geo": gin.H{"latitude": 0, "longitude": 12.5}, "params": gin.H{"format": "svg"}},
+			expectStatus: http.StatusOK,
+			expectType:   "image/svg+xml",
+		},
+		{
+			name:         "vcard",
+			body:         gin.H{"type": "vcard", "vcard": gin.H{"first_name": "Ada", "email": "ada@example.com"}},
+			expectStatus: http.StatusOK,
+			expectType:   "image/png",
+		},
+		{
+			name:         "verified",
+			body:         gin.H{"type": "geo", "geo": gin.H{"latitude": 48.85, "longitude": 2.35}, "params": gin.H{"border": true, "verify": true}},
+			expectStatus: http.StatusOK,
+			expectType:   "image/png",
+		},
+		{
+			name:         "verified without border",
+			body:         gin.H{"type": "geo", "geo": gin.H{"latitude": 48.85, "longitude": 2.35}, "params": gin.H{"verify": true}},
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unscannable",
+			body:         gin.H{"type": "geo", "geo": gin.H{"latitude": 48.85, "longitude": 2.35}, "params": gin.H{"size": 10, "border": true, "verify": true}},
+			expectStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "invalid type",
+			body:         gin.H{"type": "sms"},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "missing payload",
+			body:         gin.H{"type": "mailto"},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid email",
+			body:         gin.H{"type": "mailto", "mailto": gin.H{"to": "nope"}},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "latitude out of range",
+			body:         gin.H{"type": "geo", "geo": gin.H{"latitude": 91, "longitude": 0}},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid params",
+			body:         gin.H{"type": "wifi", "wifi": gin.H{"ssid": "Guest"}, "params": gin.H{"size": 100, "level": "X"}},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "too long",
+			body:         gin.H{"type": "vcard", "vcard": gin.H{"first_name": "Ada", "note": strings.Repeat("x", 4000)}},
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "no logo",
+			body:         gin.H{"type": "wifi", "wifi": gin.H{"ssid": "Guest"}, "params": gin.H{"logo": true}},
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doJSON(router, http.MethodPost, "/api/qr", test.body)
+			assert.Equal(t, test.expectStatus, rec.Code, rec.Body.String())
+			if test.expectType != "" {
+				assert.Equal(t, test.expectType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
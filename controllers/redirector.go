@@ -3,21 +3,119 @@ package controllers
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/matoous/go-nanoid/v2"
-	"github.com/skip2/go-qrcode"
 
 	"github.com/thedeltaflyer/redirector/helpers"
 	"github.com/thedeltaflyer/redirector/logging"
 	"github.com/thedeltaflyer/redirector/models"
+	"github.com/thedeltaflyer/redirector/templates"
 )
 
 // RedirectorController is responsible for handling redirection-related operations using key-value storage.
+// Only KV is required, the stores and policies of the default namespace are left out if they aren't set.
 type RedirectorController struct {
-	KV models.KV
+	KV            models.KV                       // Redirects of the default namespace
+	Namespaces    models.NamespaceResolver        // Resolves registered domains to their own namespaces
+	Templates     *templates.Set                  // HTML "not found" pages for browsers
+	Misses        models.MissRecorder             // Records lookups of unknown keys
+	FallbackURL   string                          // Where lookups of unknown keys go, unless the domain sets its own
+	Logos         models.KV                       // QR code logos
+	QRCache       *helpers.QRCache                // Rendered QR codes
+	URLPolicy     *helpers.URLPolicy              // Restricts where redirects may point to
+	PublicHosts   []string                        // Hosts serving the default namespace, links to them are followed
+	MaxChainDepth int                             // Chains through more links of ours are flattened, unless 0
+	KeyPolicy     *helpers.KeyPolicy              // Validates and normalizes keys, helpers.DefaultKeyPolicy if unset
+	Aliases       models.KV                       // Aliases standing for redirects
+	KeyGenerator  helpers.KeyGenerator            // Generates missing keys, helpers.DefaultKeyGenerator if unset
+	KeyGenerators map[string]helpers.KeyGenerator // Generators requests can pick by name, on top of the default ones
+	Dedupe        models.KV                       // Redirects by the API key that created them and their URL
+	Targets       models.TargetFinder             // Finds redirects by where they lead
+	Terms         models.TermSearcher             // Finds redirects by the words describing them
+	History       models.KV                       // Changes made by bulk operations
+
+	keyGrowth keyGrowth
+}
+
+// qrCacheControl is the Cache-Control header of QR codes. They only change along with their redirect, and clients can
+// revalidate them cheaply using their ETag.
+const qrCacheControl = "public, max-age=300"
+
+// namespace returns the Namespace serving the request's host, falling back to the default namespace.
+func (r *RedirectorController) namespace(c *gin.Context) (*models.Namespace, error) {
+	if r.Namespaces != nil {
+		ns, err := r.Namespaces.Resolve(helpers.NormalizeHost(c.Request.Host))
+		if err != nil || ns != nil {
+			return ns, err
+		}
+	}
+	return r.defaultNamespace(), nil
+}
+
+// defaultNamespace returns the namespace of the hosts that aren't registered domains.
+func (r *RedirectorController) defaultNamespace() *models.Namespace {
+	return &models.Namespace{Redirects: r.KV, Misses: r.Misses, Logos: r.Logos, Aliases: r.Aliases,
+		Dedupe: r.Dedupe, Targets: r.Targets, Terms: r.Terms,
+		History: r.History}
+}
+
+// lookupKey returns the key that key is stored under in ns, along with its redirect, or the normalized key and a nil
+// value if there is no such redirect. Aliases are resolved to the key of the redirect they stand for.
+func (r *RedirectorController) lookupKey(ns *models.Namespace, key string) (string, []byte, error) {
+	stored, value, err := r.findKey(ns, key)
+	if err != nil || value != nil || ns.Aliases == nil {
+		return stored, value, err
+	}
+	target, err := ns.Aliases.Get([]byte(stored))
+	if err != nil || target == nil {
+		return stored, nil, err
+	}
+	value, err = ns.Redirects.Get(target)
+	if err != nil || value == nil {
+		return stored, nil, err
+	}
+	return string(target), value, nil
+}
+
+// findKey is lookupKey without aliases. The normalized key is tried first, then key itself, so that redirects stored
+// before the key policy changed can still be found.
+func (r *RedirectorController) findKey(ns *models.Namespace, key string) (string, []byte, error) {
+	normalized := r.KeyPolicy.Normalize(key)
+	value, err := ns.Redirects.Get([]byte(normalized))
+	if err != nil || value != nil || normalized == key {
+		return normalized, value, err
+	}
+	value, err = ns.Redirects.Get([]byte(key))
+	if err != nil || value == nil {
+		return normalized, nil, err
+	}
+	return key, value, nil
+}
+
+// atomically calls fn with a copy of ns whose redirects, aliases, and logos are bound to a single transaction, so that
+// what fn checks still holds when it writes, and either every write it makes is applied or none is.
+func (r *RedirectorController) atomically(ns *models.Namespace, fn func(ns *models.Namespace) error) error {
+	return models.Atomic(func(kvs ...models.KV) error {
+		bound := *ns
+		bound.Redirects, bound.Aliases, bound.Logos = kvs[0], kvs[1], kvs[2]
+		return fn(&bound)
+	}, ns.Redirects, ns.Aliases, ns.Logos)
+}
+
+// fallbackURL returns the URL unknown keys of the namespace are redirected to, or an empty string if there is none.
+func (r *RedirectorController) fallbackURL(ns *models.Namespace, key string) string {
+	fallback := r.FallbackURL
+	if ns.Domain != nil && ns.Domain.FallbackURL != "" {
+		fallback = ns.Domain.FallbackURL
+	}
+	if fallback == "" {
+		return ""
+	}
+	return helpers.ExpandTemplate(fallback, map[string]string{"key": helpers.EscapeTemplateValue(key)})
 }
 
 // HandleGet handles GET requests to fetch and process a URL key, providing responses in various formats or performing redirects.
@@ -26,8 +124,16 @@ func (r *RedirectorController) HandleGet(c *gin.Context) {
 	key := c.Param("key")
 	mode := c.Param("mode") // Optional, for non-redirection operations.
 
+	// Find the namespace for the requested host
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
 	// Try to get the requested key from the DB
-	value, err := r.KV.Get([]byte(key))
+	key, value, err := r.lookupKey(ns, key)
 	if err != nil {
 		logging.GetLogger().Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -36,29 +142,47 @@ func (r *RedirectorController) HandleGet(c *gin.Context) {
 
 	// A `nil` value means that it doesn't exist in the DB
 	if value == nil {
-		c.String(http.StatusNotFound, "not found")
+		// Keep track of the miss so that mistyped keys can be found later
+		if ns.Misses != nil {
+			if err := ns.Misses.Record([]byte(key)); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+
+		// Plain redirects can be sent to the fallback instead
+		if fallback := r.fallbackURL(ns, key); mode == "/" && fallback != "" {
+			logging.GetLogger().Debugf("redirecting unknown key %q to fallback %q", key, fallback)
+			c.Redirect(http.StatusTemporaryRedirect, fallback)
+			return
+		}
+
+		r.notFound(c, key)
+		return
+	}
+
+	// Decode the stored redirect
+	redirect, err := models.DecodeRedirect([]byte(key), value)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
 	// Check if we want to do something other than redirect
 	switch mode {
 	case "/": // Default state, send them out!
-		logging.GetLogger().Debugf("redirecting %q to %q", key, string(value))
-		c.Redirect(http.StatusTemporaryRedirect, string(value))
+		r.redirect(c, redirect, "")
 		return
 	case "/json": // Where does this url actually go? JSON edition!
-		c.JSON(http.StatusOK, gin.H{"key": key, "url": string(value)})
+		c.JSON(http.StatusOK, gin.H{"key": key, "url": redirect.URL})
 		return
 	case "/text": // Where does this url actually go? Text edition!
-		c.String(http.StatusOK, string(value))
+		c.String(http.StatusOK, redirect.URL)
 		return
 	case "/qr": // Generate a QR code for this URL
-		// Figure out the URL for the QR Code.
-		// Note: This is not compatible with situations where the redirector is proxied behind a sub-path.
-		qrURL := url.URL{
-			Scheme: "https",
-			Host:   c.Request.Host,
-			Path:   key,
+		// Fill in any QR defaults configured for the domain
+		if ns.Domain != nil {
+			helpers.ApplyQueryDefaults(c, ns.Domain.QRDefaults)
 		}
 
 		// Get the QR Code configuration based on optional parameters
@@ -70,37 +194,379 @@ func (r *RedirectorController) HandleGet(c *gin.Context) {
 			})
 			return
 		}
+		warnContrast(c, qrConfig)
 
-		// Create a QR Code struct
-		qrCode, err := qrcode.New(qrURL.String(), qrConfig.Level)
+		// Load the logo of the redirect, or the namespace's if it doesn't have one.
+		var logo []byte
+		if qrConfig.Logo {
+			logo, err = loadLogo(ns, key)
+			if err != nil {
+				logging.GetLogger().Error(err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if logo == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no logo has been uploaded"})
+				return
+			}
+		}
+
+		// The image only depends on the QR Code's content and configuration, the redirect, and the logo, so its ETag
+		// is known before rendering it.
+		content, err := qrContent(c, redirect, qrConfig)
 		if err != nil {
 			logging.GetLogger().Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+		cacheKey := helpers.QRCacheKey(content, qrConfig, value, logo)
+		etag := helpers.QRETag(cacheKey)
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", qrCacheControl)
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
 
-		// Apply possible configurations to the QR Code
-		qrCode.DisableBorder = !qrConfig.Border
-		qrCode.BackgroundColor = qrConfig.BgColor
-		qrCode.ForegroundColor = qrConfig.FgColor
-
-		// Generate a PNG at the requested size.
-		qrData, err := qrCode.PNG(qrConfig.Size)
+		// Render the QR Code in the requested format.
+		entry, err := r.renderQR(ns, key, cacheKey, content, qrConfig, logo)
+		var unscannable *helpers.UnscannableError
+		if errors.As(err, &unscannable) {
+			c.Writer.Header().Del("ETag")
+			c.Writer.Header().Del("Cache-Control")
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			logging.GetLogger().Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 
-		// Return the QR Code as a PNG
-		c.Data(http.StatusOK, "image/png", qrData)
+		// Return the QR Code
+		c.Data(http.StatusOK, entry.ContentType, entry.Data)
 		return
 	default:
+		// Prefix redirects pass the rest of the path through to the destination.
+		if redirect.PathMode != models.PathModeNone {
+			r.redirect(c, redirect, strings.TrimPrefix(mode, "/"))
+			return
+		}
+
 		// Not a supported mode :(
 		logging.GetLogger().Infof("unknown mode %q for key %q", mode, key)
-		c.String(http.StatusNotFound, "not found")
+		r.notFound(c, key)
+		return
+	}
+}
+
+// redirect sends the client to the destination of redirect, passing through extraPath and the request's query string
+// as configured by the redirect.
+func (r *RedirectorController) redirect(c *gin.Context, redirect models.Redirect, extraPath string) {
+	destination, err := redirect.Destination(extraPath, c.Request.URL.Query())
+	if errors.Is(err, models.ErrDotSegment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	logging.GetLogger().Debugf("redirecting %q to %q", redirect.Key, destination)
+	c.Redirect(http.StatusTemporaryRedirect, destination)
+}
+
+// notFound responds with a 404 page for key in the format requested by the client.
+func (r *RedirectorController) notFound(c *gin.Context, key string) {
+	page := templates.Page{Host: helpers.NormalizeHost(c.Request.Host), Key: key}
+	renderPage(c, r.Templates, http.StatusNotFound, templates.NotFound, page, "not found",
+		gin.H{"error": "not found", "key": key})
+}
+
+// shortURL returns the short URL of key on the requested host, which is what QR codes encode.
+// Note: This is not compatible with situations where the redirector is proxied behind a sub-path.
+func shortURL(c *gin.Context, key string) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   c.Request.Host,
+		Path:   key,
+	}
+	return u.String()
+}
+
+// qrContent returns what the QR code of redirect encodes as per conf: its short URL or its destination.
+func qrContent(c *gin.Context, redirect models.Redirect, conf helpers.QRConfig) (string, error) {
+	if conf.Content == helpers.QRContentTarget {
+		return redirect.Destination("", nil)
+	}
+	return shortURL(c, redirect.Key), nil
+}
+
+// renderQR renders the QR code of key encoding content, or returns it from the cache.
+// cacheKey is the key from helpers.QRCacheKey, and logo the undecoded logo if conf asks for one.
+func (r *RedirectorController) renderQR(ns *models.Namespace, key string, cacheKey string, content string,
+	conf helpers.QRConfig, logo []byte) (helpers.QRCacheEntry, error) {
+	if entry, ok := r.QRCache.Get(cacheKey); ok {
+		return entry, nil
+	}
+
+	if logo != nil {
+		image, err := helpers.DecodeLogo(logo)
+		if err != nil {
+			return helpers.QRCacheEntry{}, err
+		}
+		conf.LogoImage = image
+	}
+	data, contentType, err := helpers.RenderQR(content, conf)
+	if err != nil {
+		return helpers.QRCacheEntry{}, err
+	}
+
+	entry := helpers.QRCacheEntry{Data: data, ContentType: contentType}
+	r.QRCache.Add(qrCacheTag(ns, key), cacheKey, entry)
+	return entry, nil
+}
+
+// loadLogo returns the QR code logo of key, falling back to the logo of the namespace.
+// Returns nil if neither has a logo.
+func loadLogo(ns *models.Namespace, key string) ([]byte, error) {
+	if ns.Logos == nil {
+		return nil, nil
+	}
+	for _, logoKey := range []string{key, models.NamespaceLogoKey} {
+		data, err := ns.Logos.Get([]byte(logoKey))
+		if err != nil || data != nil {
+			return data, err
+		}
+	}
+	return nil, nil
+}
+
+// qrCacheTag returns the tag of the cached QR codes of a redirect.
+func qrCacheTag(ns *models.Namespace, key string) string {
+	if ns.Domain == nil {
+		return "/" + key
+	}
+	return ns.Domain.Host + "/" + key
+}
+
+// qrWarningHeader carries the reason a QR code may not scan, when it is rendered anyway.
+const qrWarningHeader = "X-QR-Warning"
+
+// warnContrast sets the warning header if the contrast policy is to warn and the QR code's colors don't contrast enough.
+func warnContrast(c *gin.Context, conf helpers.QRConfig) {
+	if helpers.QRContrastPolicy != helpers.QRContrastWarn {
+		return
+	}
+	if err := helpers.CheckQRContrast(conf); err != nil {
+		c.Header(qrWarningHeader, err.Error())
+	}
+}
+
+// qrParams binds the JSON body of c to request, which holds its QR code parameters in params. params starts from the
+// domain's defaults, so that the request only overrides what it sets. Responds with an error and returns false if the
+// body can't be bound.
+func (r *RedirectorController) qrParams(c *gin.Context, ns *models.Namespace, params *helpers.QRParams,
+	request interface{}) bool {
+	var defaults map[string]string
+	if ns.Domain != nil {
+		defaults = ns.Domain.QRDefaults
+	}
+	var err error
+	if *params, err = helpers.QRParamsFromValues(defaults); err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// HandlePutLogo stores the QR code logo sent as the request body, either for the redirect in the path or for the whole
+// namespace if there is no key. Responds with a 404 status if the redirect doesn't exist, or a 501 status if logos
+// aren't stored.
+func (r *RedirectorController) HandlePutLogo(c *gin.Context) {
+	key := c.Param("key")
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if ns.Logos == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "logos are not stored by this server"})
+		return
+	}
+
+	// Logos can only be added to redirects that exist.
+	if key != "" {
+		var value []byte
+		key, value, err = r.lookupKey(ns, key)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if value == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": helpers.NewDoesNotExistError([]byte(key)).Error()})
+			return
+		}
+	} else {
+		key = models.NamespaceLogoKey
+	}
+
+	// Read and validate the image.
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, helpers.QRLogoMaxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := helpers.DecodeLogo(data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ns.Logos.Put([]byte(key), data); err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	r.QRCache.Invalidate(qrCacheTag(ns, key))
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// HandleDeleteLogo removes the QR code logo of the redirect in the path, or of the whole namespace if there is no key.
+// Responds with a 404 status if there is no such logo, or a 501 status if logos aren't stored.
+func (r *RedirectorController) HandleDeleteLogo(c *gin.Context) {
+	key := c.Param("key")
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if ns.Logos == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "logos are not stored by this server"})
+		return
+	}
+
+	if key == "" {
+		key = models.NamespaceLogoKey
+	} else if key, _, err = r.lookupKey(ns, key); err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := ns.Logos.Delete([]byte(key)); err != nil {
+		var dne *helpers.DoesNotExistError
+		if errors.As(err, &dne) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	r.QRCache.Invalidate(qrCacheTag(ns, key))
+
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// HandleGetMisses lists the unknown keys that were requested in the namespace of the request's host.
+func (r *RedirectorController) HandleGetMisses(c *gin.Context) {
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	misses := make([]models.Miss, 0)
+	if ns.Misses != nil {
+		misses, err = ns.Misses.List()
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"misses": misses})
+}
+
+// checkURL responds with a 422 naming the rule that rejects rawURL if the URL policy doesn't allow it, and reports
+// whether it does.
+func (r *RedirectorController) checkURL(c *gin.Context, rawURL string) bool {
+	return checkURLPolicy(c, r.URLPolicy, rawURL)
+}
+
+// checkURLPolicy responds with a 422 naming the rule that rejects rawURL if policy doesn't allow it, and reports
+// whether it does.
+func checkURLPolicy(c *gin.Context, policy *helpers.URLPolicy, rawURL string) bool {
+	err := policy.Check(c.Request.Context(), rawURL)
+	if err == nil {
+		return true
+	}
+	return rejectURL(c, err)
+}
+
+// rejectURL responds with a 422 naming the rule that rejected the URL if err is a PolicyError, or a 500 otherwise.
+// Always returns false, so that checks can return it.
+func rejectURL(c *gin.Context, err error) bool {
+	var pe *helpers.PolicyError
+	if errors.As(err, &pe) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": pe.Error(), "rule": pe.Rule})
+		return false
+	}
+	logging.GetLogger().Error(err)
+	c.AbortWithStatus(http.StatusInternalServerError)
+	return false
+}
+
+// keyGenerator returns the key generator named by the "generator" query parameter, or the configured one if there is
+// no such parameter.
+func (r *RedirectorController) keyGenerator(c *gin.Context) (helpers.KeyGenerator, error) {
+	name := c.Query("generator")
+	if name == "" {
+		if r.KeyGenerator == nil {
+			return helpers.DefaultKeyGenerator, nil
+		}
+		return r.KeyGenerator, nil
+	}
+	if generator, ok := r.KeyGenerators[name]; ok {
+		return generator, nil
+	}
+	return helpers.NewKeyGenerator(name, "", 0)
+}
+
+// rejectKey responds with a 400 naming the rule that rejected the key if err is a KeyError, or a 500 otherwise.
+func (r *RedirectorController) rejectKey(c *gin.Context, err error) {
+	var ke *helpers.KeyError
+	if errors.As(err, &ke) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ke.Error(), "rule": ke.Rule})
+		return
+	}
+	logging.GetLogger().Error(err)
+	c.AbortWithStatus(http.StatusInternalServerError)
 }
 
 // HandlePost processes POST requests to create a redirection entry, using a generated or provided key.
@@ -115,67 +581,152 @@ func (r *RedirectorController) HandlePost(c *gin.Context) {
 		return
 	}
 
+	// Make sure that the URL is one we're willing to redirect to.
+	if !r.checkURL(c, value.URL) {
+		return
+	}
+
 	// The key in the path takes precedence, use that if it's provided.
 	if key != "" {
 		value.Key = key
 	}
 
-	// If no key was provided, generate a nanoid to use.
+	// Find the namespace for the requested host
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// If no key was provided, generate one, longer if the namespace is running out of keys.
+	var generator helpers.KeyGenerator
 	if value.Key == "" {
-		// Note: We don't check if the key exists already since nanoid has enough entropy that a collision is unlikely...
-		var err error
-		value.Key, err = gonanoid.New(12)
+		generator, err = r.keyGenerator(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var grown helpers.KeyGenerator
+		grown, err = r.keyGrowth.get(ns, generator)
+		if err == nil {
+			value.Key, err = grown.Generate()
+		}
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Make sure that the key is one we can serve, and that it doesn't clash with a route.
+	value.Key = r.KeyPolicy.Normalize(value.Key)
+	if err := r.KeyPolicy.Validate(value.Key); err != nil {
+		r.rejectKey(c, err)
+		return
+	}
+
+	// Make sure that the URL doesn't lead back to the redirect through our own links, and shorten long chains.
+	if !r.checkChain(c, ns, &value) {
+		return
+	}
+
+	// Return the redirect the API key already created for the URL instead, if it's asked for.
+	if generator != nil && c.Query("dedupe") == "true" {
+		existing, err := r.findDuplicate(c, ns, value)
 		if err != nil {
 			logging.GetLogger().Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+		if existing != nil {
+			c.JSON(http.StatusOK, gin.H{"status": "success", "redirect": existing, "deduplicated": true})
+			return
+		}
 	}
 
-	// Make sure that the key is a "sane" length... this is a URL "shortener" after all...
-	if len(value.Key) > 100 {
-		err := fmt.Errorf("key too long (%d)", len(value.Key))
+	// Serialize the redirect for storage
+	data, err := models.EncodeRedirect(value)
+	if err != nil {
 		logging.GetLogger().Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	// Attempt to write the key to the DB, This will fail if the key already exists.
-	err := r.KV.ExclusivePut([]byte(value.Key), []byte(value.URL))
+	// Attempt to write the key to the DB, This will fail if the key already exists, unless it was generated and
+	// another one can be.
+	err = r.createRedirect(ns, &value, data, generator)
 	if err != nil {
 		var ae *helpers.AlreadyExistsError
 		if errors.As(err, &ae) {
 			c.JSON(http.StatusConflict, gin.H{"error": ae.Error()})
 			return
 		} else {
-			logging.GetLogger().Error(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			r.rejectKey(c, err)
 			return
 		}
 	}
 
+	// Remember who shortened the URL, so that it can be deduplicated. The redirect exists either way.
+	if err := r.indexDuplicate(c, ns, value); err != nil {
+		logging.GetLogger().Error(err)
+	}
+
 	// Return a summary of the new redirect.
 	c.JSON(http.StatusOK, gin.H{"status": "success", "redirect": value})
 }
 
 // HandlePutWithKey handles PUT requests to update a redirection entry identified by a specified key.
 // Replaces the existing URL value and returns both the new and replaced redirect details.
-// Responds with a 409 status if the key does not exist or a 500 status for internal server errors.
+// Responds with a 409 status if the key does not exist, a 422 status if the URL policy rejects the new URL, or a 500
+// status for internal server errors.
 func (r *RedirectorController) HandlePutWithKey(c *gin.Context) {
 	// Grab the key
 	key := c.Param("key")
 
 	// Bind the Redirect request; This also performs validations against the URL
-	var value, replaced models.Redirect
+	var value models.Redirect
 	if err := c.ShouldBindJSON(&value); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	value.Key = key
-	replaced.Key = key
+
+	// Make sure that the URL is one we're willing to redirect to.
+	if !r.checkURL(c, value.URL) {
+		return
+	}
+
+	// Find the namespace for the requested host
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Update the redirect the key refers to, which may predate the key policy or be aliased by the key.
+	value.Key, _, err = r.lookupKey(ns, key)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Make sure that the URL doesn't lead back to the redirect through our own links, and shorten long chains.
+	if !r.checkChain(c, ns, &value) {
+		return
+	}
+
+	// Serialize the redirect for storage
+	data, err := models.EncodeRedirect(value)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
 	// Attempt to replace the existing key
-	replacedURL, err := r.KV.Replace([]byte(value.Key), []byte(value.URL))
+	replacedData, err := ns.Redirects.Replace([]byte(value.Key), data)
 	if err != nil {
 		// If the key doesn't already exist, raise a 409, otherwise report a 500
 		var dne *helpers.DoesNotExistError
@@ -189,9 +740,94 @@ func (r *RedirectorController) HandlePutWithKey(c *gin.Context) {
 		}
 	}
 
-	// Populate the value of the URL that was replaced.
-	replaced.URL = string(replacedURL)
+	// Cached QR codes of the redirect are stale now.
+	r.QRCache.Invalidate(qrCacheTag(ns, value.Key))
+
+	// Populate the value of the redirect that was replaced.
+	replaced, err := models.DecodeRedirect([]byte(value.Key), replacedData)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
 	// Return a summary of the changes made.
 	c.JSON(http.StatusOK, gin.H{"status": "success", "redirect": value, "replaced": replaced})
 }
+
+// HandleDelete removes the redirect identified by the key in the path, along with its QR code logo. Aliases aren't
+// resolved, the redirect has to be deleted by its own key.
+// Responds with a 404 status if the key does not exist, or a 409 status if the redirect still has aliases.
+func (r *RedirectorController) HandleDelete(c *gin.Context) {
+	// Grab the key
+	key := c.Param("key")
+
+	// Find the namespace for the requested host
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// The redirect is checked for aliases and deleted in one transaction, so that no alias can be added in between.
+	var value []byte
+	var aliases []models.Alias
+	err = r.atomically(ns, func(ns *models.Namespace) error {
+		var err error
+		key, value, err = r.findKey(ns, key)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return helpers.NewDoesNotExistError([]byte(key))
+		}
+		value = append([]byte(nil), value...)
+
+		// Aliases would be left pointing at nothing, they have to be removed first.
+		aliases, err = models.ListAliases(ns.Aliases, key)
+		if err != nil {
+			return err
+		}
+		if len(aliases) > 0 {
+			return helpers.NewInUseError([]byte(key), fmt.Sprintf("%d aliases", len(aliases)))
+		}
+
+		if err := ns.Redirects.Delete([]byte(key)); err != nil {
+			return err
+		}
+		// The logo goes along with the redirect, if it has one.
+		if ns.Logos != nil {
+			var dne *helpers.DoesNotExistError
+			if err := ns.Logos.Delete([]byte(key)); err != nil && !errors.As(err, &dne) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var dne *helpers.DoesNotExistError
+		var iu *helpers.InUseError
+		switch {
+		case errors.As(err, &dne):
+			c.JSON(http.StatusNotFound, gin.H{"error": dne.Error()})
+		case errors.As(err, &iu):
+			c.JSON(http.StatusConflict, gin.H{"error": iu.Error(), "aliases": aliases})
+		default:
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+	r.QRCache.Invalidate(qrCacheTag(ns, key))
+
+	// Populate the value of the redirect that was deleted.
+	deleted, err := models.DecodeRedirect([]byte(key), value)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "deleted": deleted})
+}
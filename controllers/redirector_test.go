@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -13,6 +15,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/models"
+	"github.com/thedeltaflyer/redirector/templates"
 )
 
 func Test_HandleGet(t *testing.T) {
@@ -27,6 +31,7 @@ func Test_HandleGet(t *testing.T) {
 		expectJSON     gin.H
 		expectText     string
 		expectQR       bool
+		expectType     string
 	}{
 		{
 			name:           "redirect_success",
@@ -60,6 +65,14 @@ func Test_HandleGet(t *testing.T) {
 			expectStatus: http.StatusOK,
 			expectQR:     true,
 		},
+		{
+			name:         "qr_svg",
+			key:          "existingKey",
+			mode:         "/qr?format=svg",
+			mockGetValue: []byte("https://example.com"),
+			expectStatus: http.StatusOK,
+			expectType:   "image/svg+xml",
+		},
 		{
 			name:         "qr_bad_param",
 			key:          "existingKey",
@@ -130,6 +143,9 @@ func Test_HandleGet(t *testing.T) {
 				assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
 				assert.Greater(t, len(rec.Body.Bytes()), 0)
 			}
+			if test.expectType != "" {
+				assert.Equal(t, test.expectType, rec.Header().Get("Content-Type"))
+			}
 		})
 	}
 }
@@ -173,6 +189,30 @@ func Test_HandlePost(t *testing.T) {
 			body:           gin.H{"incorrect_field": "https://example.com"},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:           "valid_path_mode",
+			key:            "docs",
+			body:           gin.H{"url": "https://docs.example.com", "path_mode": "append", "query_mode": "override"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "valid_params",
+			key:            "launch",
+			body:           gin.H{"url": "https://example.com", "params": gin.H{"utm_source": "lnk"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid_params",
+			key:            "launch",
+			body:           gin.H{"url": "https://example.com", "params": gin.H{"": "lnk"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid_path_mode",
+			key:            "docs",
+			body:           gin.H{"url": "https://docs.example.com", "path_mode": "prepend"},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -231,9 +271,14 @@ func Test_HandlePutWithKey(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			router := gin.Default()
-			mockStore := &mockKVWrapper{replaceFunc: func(key []byte, value []byte) ([]byte, error) {
-				return nil, test.mockRepErr
-			}}
+			mockStore := &mockKVWrapper{
+				getFunc: func(key []byte) ([]byte, error) {
+					return nil, nil
+				},
+				replaceFunc: func(key []byte, value []byte) ([]byte, error) {
+					return nil, test.mockRepErr
+				},
+			}
 			controller := &RedirectorController{KV: mockStore}
 			router.PUT("/:key", controller.HandlePutWithKey)
 
@@ -248,3 +293,697 @@ func Test_HandlePutWithKey(t *testing.T) {
 		})
 	}
 }
+
+func Test_HandlePost_URLPolicy(t *testing.T) {
+	router := gin.Default()
+	writes := 0
+	mockStore := &mockKVWrapper{
+		getFunc: func(key []byte) ([]byte, error) {
+			return nil, nil
+		},
+		exclusivePutFunc: func(key []byte, value []byte) error {
+			writes++
+			return nil
+		},
+		replaceFunc: func(key []byte, value []byte) ([]byte, error) {
+			writes++
+			return []byte("https://example.com"), nil
+		},
+	}
+	controller := &RedirectorController{KV: mockStore, URLPolicy: &helpers.URLPolicy{BlockDomains: []string{"*.evil.com"}}}
+	router.POST("/:key", controller.HandlePost)
+	router.PUT("/:key", controller.HandlePutWithKey)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		wantCode int
+		wantRule string
+	}{
+		{"allowed post", http.MethodPost, "https://example.com", http.StatusOK, ""},
+		{"allowed put", http.MethodPut, "https://example.com", http.StatusOK, ""},
+		{"scheme", http.MethodPost, "javascript:alert(1)", http.StatusUnprocessableEntity, helpers.URLRuleScheme},
+		{"blocked domain", http.MethodPost, "https://www.evil.com", http.StatusUnprocessableEntity, helpers.URLRuleBlockedDomain},
+		{"IP literal", http.MethodPut, "http://93.184.215.14/", http.StatusUnprocessableEntity, helpers.URLRuleIPLiteral},
+		{"private address", http.MethodPut, "http://localhost:8080/admin", http.StatusUnprocessableEntity,
+			helpers.URLRulePrivateAddress},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writes = 0
+			body, _ := json.Marshal(gin.H{"url": test.url})
+			req := httptest.NewRequest(test.method, "/abc", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantCode, rec.Code)
+			if test.wantRule == "" {
+				assert.Equal(t, 1, writes)
+				return
+			}
+			var response map[string]string
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, test.wantRule, response["rule"])
+			assert.Contains(t, response["error"], "the URL is not allowed")
+			assert.Equal(t, 0, writes)
+		})
+	}
+}
+
+func Test_HandlePost_KeyPolicy(t *testing.T) {
+	lower, err := helpers.NewKeyPolicy(helpers.DefaultKeyCharset, 3, 20, helpers.KeyNormalizeLower, []string{"health", "api"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		policy   *helpers.KeyPolicy
+		path     string
+		key      string
+		wantCode int
+		wantRule string
+		wantKey  string
+	}{
+		{"default", nil, "/abc", "", http.StatusOK, "", "abc"},
+		{"default keeps case", nil, "/AbC", "", http.StatusOK, "", "AbC"},
+		{"default charset", nil, "/", "a b", http.StatusBadRequest, helpers.KeyRuleCharset, ""},
+		{"slash in body", lower, "/", "a/b/c", http.StatusBadRequest, helpers.KeyRuleCharset, ""},
+		{"too short", lower, "/ab", "", http.StatusBadRequest, helpers.KeyRuleMinLength, ""},
+		{"too long", lower, "/" + strings.Repeat("a", 21), "", http.StatusBadRequest, helpers.KeyRuleMaxLength, ""},
+		{"reserved", lower, "/Health", "", http.StatusBadRequest, helpers.KeyRuleReserved, ""},
+		{"folded", lower, "/AbC", "", http.StatusOK, "", "abc"},
+		{"generated", lower, "/", "", http.StatusOK, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stored string
+			controller := &RedirectorController{KeyPolicy: test.policy, KV: &mockKVWrapper{
+				exclusivePutFunc: func(key []byte, value []byte) error {
+					stored = string(key)
+					return nil
+				},
+			}}
+			router := gin.New()
+			router.POST("/:key", controller.HandlePost)
+			router.POST("/", controller.HandlePost)
+
+			body, _ := json.Marshal(gin.H{"url": "https://example.com", "key": test.key})
+			req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantCode, rec.Code, rec.Body.String())
+			if test.wantRule != "" {
+				var response map[string]string
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, test.wantRule, response["rule"])
+				assert.Empty(t, stored)
+				return
+			}
+			if test.wantKey != "" {
+				assert.Equal(t, test.wantKey, stored)
+			} else {
+				assert.Equal(t, strings.ToLower(stored), stored)
+				assert.NoError(t, test.policy.Validate(stored))
+			}
+		})
+	}
+}
+
+func Test_HandlePost_KeyGenerator(t *testing.T) {
+	base32, err := helpers.NewKeyGenerator(helpers.KeyGeneratorBase32, "", 6)
+	assert.NoError(t, err)
+	short, err := helpers.NewKeyGenerator(helpers.KeyGeneratorNanoid, "xyz", 4)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		generator helpers.KeyGenerator
+		query     string
+		wantCode  int
+		pattern   string
+	}{
+		{"default", nil, "", http.StatusOK, `^[A-Za-z0-9_-]{12}$`},
+		{"configured", base32, "", http.StatusOK, `^[2-9a-km-np-z]{6}$`},
+		{"requested", base32, "?generator=words", http.StatusOK, `^[a-z]+-[a-z]+-[0-9]{2}$`},
+		{"requested configuration", base32, "?generator=nanoid", http.StatusOK, `^[xyz]{4}$`},
+		{"unknown", nil, "?generator=uuid", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stored string
+			controller := &RedirectorController{
+				KeyGenerator:  test.generator,
+				KeyGenerators: map[string]helpers.KeyGenerator{helpers.KeyGeneratorNanoid: short},
+				KV: &mockKVWrapper{exclusivePutFunc: func(key []byte, value []byte) error {
+					stored = string(key)
+					return nil
+				}},
+			}
+			router := gin.New()
+			router.POST("/", controller.HandlePost)
+
+			body, _ := json.Marshal(gin.H{"url": "https://example.com"})
+			req := httptest.NewRequest(http.MethodPost, "/"+test.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantCode, rec.Code, rec.Body.String())
+			if test.pattern != "" {
+				assert.Regexp(t, test.pattern, stored)
+			} else {
+				assert.Empty(t, stored)
+			}
+		})
+	}
+}
+
+func Test_HandleGet_KeyPolicy(t *testing.T) {
+	lower, err := helpers.NewKeyPolicy(helpers.DefaultKeyCharset, 1, 100, helpers.KeyNormalizeLower, nil)
+	assert.NoError(t, err)
+	stored := map[string]string{"abc": "https://example.com/abc", "Legacy": "https://example.com/legacy"}
+	var replaced string
+	mockStore := mapKV(stored)
+	mockStore.replaceFunc = func(key []byte, value []byte) ([]byte, error) {
+		replaced = string(key)
+		return []byte(stored[string(key)]), nil
+	}
+	controller := &RedirectorController{KV: mockStore, KeyPolicy: lower}
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+	router.PUT("/:key", controller.HandlePutWithKey)
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantURL  string
+	}{
+		{"/abc/", http.StatusTemporaryRedirect, "https://example.com/abc"},
+		{"/ABC/", http.StatusTemporaryRedirect, "https://example.com/abc"},
+		{"/Legacy/", http.StatusTemporaryRedirect, "https://example.com/legacy"},
+		{"/legacy/", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.wantCode, rec.Code)
+			assert.Equal(t, test.wantURL, rec.Header().Get("Location"))
+		})
+	}
+
+	t.Run("update", func(t *testing.T) {
+		for path, want := range map[string]string{"/ABC": "abc", "/Legacy": "Legacy"} {
+			body, _ := json.Marshal(gin.H{"url": "https://example.com/new"})
+			req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, want, replaced)
+		}
+	})
+}
+
+func Test_HandleGet_CanonicalKeys(t *testing.T) {
+	canonical, err := helpers.NewKeyPolicy(`\p{L}\p{N}_-`, 1, 100, helpers.KeyNormalizeCanonical, nil)
+	assert.NoError(t, err)
+	controller := &RedirectorController{
+		KV:        mapKV(map[string]string{"launch": "https://example.com/launch", "café": "https://example.com/cafe"}),
+		KeyPolicy: canonical,
+	}
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	for path, want := range map[string]string{
+		"/launch/":        "https://example.com/launch",
+		"/Launch/":        "https://example.com/launch",
+		"/LAUNCH.)/":      "https://example.com/launch",
+		"/Cafe%CC%81/":    "https://example.com/cafe",
+		"/CAF%C3%89!/":    "https://example.com/cafe",
+		"/launch/json":    "",
+		"/launches/":      "",
+		"/launch-/":       "",
+		"/caf%C3%A9s./":   "",
+		"/%C3%A7af%C3%A9": "",
+	} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			if want == "" {
+				assert.NotEqual(t, http.StatusTemporaryRedirect, rec.Code)
+				return
+			}
+			assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+			assert.Equal(t, want, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func Test_HandleGet_Namespaces(t *testing.T) {
+	defaultStore := &mockKVWrapper{getFunc: func(key []byte) ([]byte, error) {
+		return []byte("https://default.example.com"), nil
+	}}
+	teamStore := &mockKVWrapper{getFunc: func(key []byte) ([]byte, error) {
+		return []byte("https://team-a.example.com"), nil
+	}}
+	controller := &RedirectorController{KV: defaultStore, Namespaces: mockResolver{
+		"go.team-a": {Domain: &models.Domain{Host: "go.team-a"}, Redirects: teamStore},
+	}}
+
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	tests := []struct {
+		host           string
+		expectLocation string
+	}{
+		{"go.team-a", "https://team-a.example.com"},
+		{"GO.TEAM-A:443", "https://team-a.example.com"},
+		{"lnk.now", "https://default.example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+			req.Host = test.host
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+			assert.Equal(t, test.expectLocation, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func Test_HandleGet_NotFoundNegotiation(t *testing.T) {
+	mockStore := &mockKVWrapper{getFunc: func(key []byte) ([]byte, error) {
+		return nil, nil
+	}}
+	pages, err := templates.Load("")
+	assert.NoError(t, err)
+	controller := &RedirectorController{KV: mockStore, Templates: pages}
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	tests := []struct {
+		name         string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{"text", "", "text/plain; charset=utf-8", "not found"},
+		{"json", "application/json", "application/json; charset=utf-8", `{"error":"not found","key":"missingKey"}`},
+		{"html", "text/html", "text/html; charset=utf-8", "<code>missingKey</code>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/missingKey/", nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Equal(t, test.expectedType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), test.expectedBody)
+		})
+	}
+}
+
+// mockMisses records misses in memory.
+type mockMisses struct {
+	keys []string
+}
+
+func (m *mockMisses) Record(key []byte) error {
+	m.keys = append(m.keys, string(key))
+	return nil
+}
+
+func (m *mockMisses) List() ([]models.Miss, error) {
+	misses := make([]models.Miss, 0, len(m.keys))
+	for _, key := range m.keys {
+		misses = append(misses, models.Miss{Key: key, Count: 1})
+	}
+	return misses, nil
+}
+
+func Test_HandleGet_Fallback(t *testing.T) {
+	missingStore := &mockKVWrapper{getFunc: func(key []byte) ([]byte, error) {
+		return nil, nil
+	}}
+
+	tests := []struct {
+		name           string
+		host           string
+		path           string
+		fallback       string
+		expectStatus   int
+		expectLocation string
+	}{
+		{
+			name:         "no_fallback",
+			host:         "lnk.now",
+			path:         "/lauch/",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:           "global_fallback",
+			host:           "lnk.now",
+			path:           "/lauch/",
+			fallback:       "https://example.com/search?q={key}",
+			expectStatus:   http.StatusTemporaryRedirect,
+			expectLocation: "https://example.com/search?q=lauch",
+		},
+		{
+			name:           "escaped_key",
+			host:           "lnk.now",
+			path:           "/a%20b&c/",
+			fallback:       "https://example.com/search?q={key}",
+			expectStatus:   http.StatusTemporaryRedirect,
+			expectLocation: "https://example.com/search?q=a%20b%26c",
+		},
+		{
+			name:           "domain_fallback",
+			host:           "go.team-a",
+			path:           "/lauch/",
+			fallback:       "https://example.com/search?q={key}",
+			expectStatus:   http.StatusTemporaryRedirect,
+			expectLocation: "https://team-a.example.com/",
+		},
+		{
+			name:         "fallback_only_for_redirects",
+			host:         "lnk.now",
+			path:         "/lauch/json",
+			fallback:     "https://example.com/",
+			expectStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			misses := &mockMisses{}
+			teamMisses := &mockMisses{}
+			controller := &RedirectorController{
+				KV:          missingStore,
+				Misses:      misses,
+				FallbackURL: test.fallback,
+				Namespaces: mockResolver{"go.team-a": {
+					Domain:    &models.Domain{Host: "go.team-a", FallbackURL: "https://team-a.example.com/"},
+					Redirects: missingStore,
+					Misses:    teamMisses,
+				}},
+			}
+			router := gin.New()
+			router.GET("/:key/*mode", controller.HandleGet)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Host = test.host
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.expectStatus, rec.Code)
+			assert.Equal(t, test.expectLocation, rec.Header().Get("Location"))
+			assert.Equal(t, 1, len(misses.keys)+len(teamMisses.keys))
+		})
+	}
+}
+
+func Test_HandleGetMisses(t *testing.T) {
+	controller := &RedirectorController{Misses: &mockMisses{keys: []string{"lauch"}}}
+	router := gin.New()
+	router.GET("/api/misses", controller.HandleGetMisses)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/misses", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"misses":[{"key":"lauch","count":1,"last_seen":"0001-01-01T00:00:00Z"}]}`, rec.Body.String())
+}
+
+func Test_HandleGet_PathPassthrough(t *testing.T) {
+	records := map[string]string{
+		"docs":  `{"url":"https://docs.example.com","path_mode":"append","query_mode":"override"}`,
+		"gh":    `{"url":"https://github.com/org/{path}","path_mode":"template"}`,
+		"plain": "https://example.com",
+		"utm":   `{"url":"https://example.com/","query_mode":"append","params":{"utm_source":"lnk"}}`,
+	}
+	mockStore := &mockKVWrapper{getFunc: func(key []byte) ([]byte, error) {
+		if value, ok := records[string(key)]; ok {
+			return []byte(value), nil
+		}
+		return nil, nil
+	}}
+	controller := &RedirectorController{KV: mockStore}
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectStatus   int
+		expectLocation string
+	}{
+		{"append", "/docs/some/page?x=1", http.StatusTemporaryRedirect, "https://docs.example.com/some/page?x=1"},
+		{"append_root", "/docs/", http.StatusTemporaryRedirect, "https://docs.example.com"},
+		{"template", "/gh/repo/pulls", http.StatusTemporaryRedirect, "https://github.com/org/repo/pulls"},
+		{"modes_still_work", "/docs/text", http.StatusOK, ""},
+		{"plain_unknown_mode", "/plain/some/page", http.StatusNotFound, ""},
+		{"params", "/utm/?utm_source=mail", http.StatusTemporaryRedirect, "https://example.com/?utm_source=lnk&utm_source=mail"},
+		{"append_dot_segments", "/docs/a/%2e%2e/admin", http.StatusBadRequest, ""},
+		{"template_dot_segments", "/gh/%2E%2E/admin", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, test.expectStatus, rec.Code)
+			assert.Equal(t, test.expectLocation, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func Test_HandleLogo(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	logos := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.LogosBucket)}
+	_ = redirects.Put([]byte("docs"), []byte("https://example.com"))
+	controller := &RedirectorController{KV: redirects, Logos: logos}
+
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+	router.PUT("/api/logo", controller.HandlePutLogo)
+	router.DELETE("/api/logo", controller.HandleDeleteLogo)
+	router.PUT("/api/logo/:key", controller.HandlePutLogo)
+	router.DELETE("/api/logo/:key", controller.HandleDeleteLogo)
+
+	var logo bytes.Buffer
+	_ = png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+
+	put := func(path string, body []byte) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body)))
+		return rec.Code
+	}
+	do := func(method string, path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+
+	// Nothing uploaded yet.
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/docs/qr?logo=true"))
+
+	// Invalid uploads.
+	assert.Equal(t, http.StatusBadRequest, put("/api/logo", []byte("not an image")))
+	assert.Equal(t, http.StatusNotFound, put("/api/logo/missing", logo.Bytes()))
+
+	// The namespace logo is used by every redirect.
+	assert.Equal(t, http.StatusOK, put("/api/logo", logo.Bytes()))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/docs/qr?logo=true"))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/docs/qr?logo=true&format=pdf"))
+
+	// A redirect's own logo.
+	assert.Equal(t, http.StatusOK, put("/api/logo/docs", logo.Bytes()))
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/logo"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/docs/qr?logo=true"))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/logo/docs"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/logo/docs"))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/docs/qr?logo=true"))
+
+	// Without a logo store.
+	controller.Logos = nil
+	assert.Equal(t, http.StatusNotImplemented, put("/api/logo/docs", logo.Bytes()))
+	assert.Equal(t, http.StatusNotImplemented, do(http.MethodDelete, "/api/logo"))
+}
+
+func Test_HandleGet_QRCache(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	_ = redirects.Put([]byte("docs"), []byte("https://example.com"))
+	cache, _ := helpers.NewQRCache(10, 1<<20, "")
+	controller := &RedirectorController{KV: redirects, QRCache: cache}
+
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+	router.PUT("/:key", controller.HandlePutWithKey)
+
+	get := func(path string, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/docs/qr", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, qrCacheControl, first.Header().Get("Cache-Control"))
+	assert.Equal(t, 1, cache.Len())
+
+	// Cached, with the same ETag.
+	second := get("/docs/qr", "")
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+
+	// Conditional requests.
+	assert.Equal(t, http.StatusNotModified, get("/docs/qr", etag).Code)
+	assert.Equal(t, http.StatusNotModified, get("/docs/qr", `"other", `+etag).Code)
+	assert.Equal(t, http.StatusOK, get("/docs/qr", `"other"`).Code)
+
+	// Other parameters are another image.
+	svg := get("/docs/qr?format=svg", "")
+	assert.NotEqual(t, etag, svg.Header().Get("ETag"))
+	target := get("/docs/qr?content=target", "")
+	assert.NotEqual(t, etag, target.Header().Get("ETag"))
+	assert.NotEqual(t, first.Body.Bytes(), target.Body.Bytes())
+	assert.Equal(t, 3, cache.Len())
+
+	// Changing the target invalidates the cached images and their ETags.
+	rec := doJSON(router, http.MethodPut, "/docs", gin.H{"url": "https://example.org"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, cache.Len())
+	third := get("/docs/qr", etag)
+	assert.Equal(t, http.StatusOK, third.Code)
+	assert.NotEqual(t, etag, third.Header().Get("ETag"))
+}
+
+func Test_HandleGet_QRContrast(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	_ = redirects.Put([]byte("docs"), []byte("https://example.com"))
+	controller := &RedirectorController{KV: redirects}
+
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Rejected by default.
+	rec := get("/docs/qr?fg_color=lightyellow")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "doesn't contrast enough")
+
+	// Rendered with a warning.
+	helpers.QRContrastPolicy = helpers.QRContrastWarn
+	defer func() { helpers.QRContrastPolicy = helpers.QRContrastReject }()
+	rec = get("/docs/qr?fg_color=lightyellow")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(qrWarningHeader), "doesn't contrast enough")
+
+	rec = get("/docs/qr?fg_color=navy")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(qrWarningHeader))
+
+	// Not checked at all.
+	helpers.QRContrastPolicy = helpers.QRContrastOff
+	rec = get("/docs/qr?fg_color=lightyellow")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(qrWarningHeader))
+}
+
+func Test_HandleGet_QRVerify(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := &models.KVWrapper{DB: store.DB, Bucket: []byte(models.RedirectsBucket)}
+	_ = redirects.Put([]byte("docs"), []byte("https://example.com"))
+	cache, _ := helpers.NewQRCache(10, 1<<20, "")
+	controller := &RedirectorController{KV: redirects, QRCache: cache}
+
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/docs/qr?verify=true&border=true")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.NotEqual(t, get("/docs/qr").Header().Get("ETag"), rec.Header().Get("ETag"))
+
+	// Readers need a quiet zone around the code.
+	rec = get("/docs/qr?verify=true")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "the code has no quiet zone around it")
+
+	// Too small to be scanned.
+	rec = get("/docs/qr?verify=true&border=true&size=10")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "the modules are too small to be read")
+	assert.Empty(t, rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, get("/docs/qr?size=10").Code)
+
+	// Failures aren't cached.
+	assert.Equal(t, 3, cache.Len())
+	assert.Equal(t, http.StatusUnprocessableEntity, get("/docs/qr?verify=true&border=true&size=10").Code)
+}
+
+func Test_etagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`*`, true},
+		{`"abcd"`, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, etagMatches(test.header, `"abc"`), test.header)
+	}
+}
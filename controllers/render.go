@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/templates"
+)
+
+// renderPage responds with a page in the format the client prefers: plain text by default, JSON for API clients, or
+// the named HTML template for browsers. HTML falls back to plain text if no templates are configured.
+func renderPage(c *gin.Context, set *templates.Set, status int, name string, page templates.Page, text string, json gin.H) {
+	switch c.NegotiateFormat(gin.MIMEPlain, gin.MIMEJSON, gin.MIMEHTML) {
+	case gin.MIMEJSON:
+		c.JSON(status, json)
+		return
+	case gin.MIMEHTML:
+		if set == nil {
+			break
+		}
+		var buf bytes.Buffer
+		if err := set.Render(&buf, page.Host, name, page); err != nil {
+			logging.GetLogger().Error(err)
+			break
+		}
+		c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.String(status, text)
+}
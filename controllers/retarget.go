@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// errRetargetConflict is returned when a redirect changes between planning and applying a retarget.
+var errRetargetConflict = errors.New("redirects changed while they were being retargeted, try again")
+
+// retargetRequest is the body of a request to rewrite the destinations of redirects.
+type retargetRequest struct {
+	Match       models.RetargetMatch `json:"match"`
+	Replacement string               `json:"replacement"`
+	DryRun      bool                 `json:"dry_run"`
+}
+
+// retarget is the change of the URL of a redirect, along with the rule refusing the new URL if the URL policy does.
+type retarget struct {
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	NewURL string `json:"new_url"`
+	Error  string `json:"error,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+// HandlePostRetarget rewrites the URLs of the redirects of the namespace of the request's host that match the request,
+// all at once, and records every change in the history. With "dry_run", the changes are listed but not applied.
+// Responds with a 400 status if the match is invalid, a 422 status listing the changes if any new URL is refused, in
+// which case nothing is changed, or a 409 status if redirects changed while they were being retargeted.
+func (r *RedirectorController) HandlePostRetarget(c *gin.Context) {
+	var request retargetRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	retargeter, err := models.NewRetargeter(request.Match, request.Replacement)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Find the redirects to change first, they're checked once the scan is over.
+	var redirects []models.Redirect
+	err = ns.Redirects.Scan(nil, func(key []byte, value []byte) error {
+		redirect, err := models.DecodeRedirect(key, value)
+		if err != nil {
+			return err
+		}
+		if _, ok := retargeter.Rewrite(redirect.URL); ok {
+			redirects = append(redirects, redirect)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Every change is checked against the others, so that they can't make loops or long chains together.
+	changes := make([]retarget, len(redirects))
+	planned := make(map[string]models.Redirect, len(redirects))
+	for i := range redirects {
+		changes[i] = retarget{Key: redirects[i].Key, URL: redirects[i].URL}
+		changes[i].NewURL, _ = retargeter.Rewrite(redirects[i].URL)
+		redirects[i].URL = changes[i].NewURL
+		planned[linkID(ns, redirects[i].Key)] = redirects[i]
+	}
+	refused := 0
+	for i, redirect := range redirects {
+		if err := r.checkRetarget(c.Request.Context(), ns, redirect, planned); err != nil {
+			var pe *helpers.PolicyError
+			if !errors.As(err, &pe) {
+				logging.GetLogger().Error(err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			changes[i].Error, changes[i].Rule = pe.Error(), pe.Rule
+			refused++
+		}
+	}
+
+	if request.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "changes": changes})
+		return
+	}
+	if refused > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   fmt.Sprintf("%d redirects can't be retargeted", refused),
+			"changes": changes,
+		})
+		return
+	}
+
+	if err := r.applyRetargets(ns, changes); err != nil {
+		if errors.Is(err, errRetargetConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Cached QR codes of the redirects are stale now.
+	for _, change := range changes {
+		r.QRCache.Invalidate(qrCacheTag(ns, change.Key))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": false, "changes": changes})
+}
+
+// checkRetarget returns a PolicyError if redirect may not lead to its URL: the URL must be absolute, allowed by the URL
+// policy, and not lead back to the redirect, planned being the redirects of the batch as they'll be once retargeted.
+// Long chains aren't flattened, as the redirect's URL is what was asked for.
+func (r *RedirectorController) checkRetarget(ctx context.Context, ns *models.Namespace, redirect models.Redirect,
+	planned map[string]models.Redirect) error {
+	if u, err := url.Parse(redirect.URL); err != nil || !u.IsAbs() {
+		return helpers.NewPolicyError(helpers.URLRuleInvalid, "the URL is not absolute")
+	}
+	if err := r.URLPolicy.Check(ctx, redirect.URL); err != nil {
+		return err
+	}
+	_, _, err := r.followPlannedChain(ns, redirect, planned)
+	return err
+}
+
+// applyRetargets changes the URLs of the redirects of ns in a single transaction, recording each change in its history.
+// Returns errRetargetConflict, and changes nothing, if a redirect no longer has the URL it was retargeted from.
+func (r *RedirectorController) applyRetargets(ns *models.Namespace, changes []retarget) error {
+	now := time.Now().UTC()
+	return models.Atomic(func(kvs ...models.KV) error {
+		for _, change := range changes {
+			value, err := kvs[0].Get([]byte(change.Key))
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				return errRetargetConflict
+			}
+			redirect, err := models.DecodeRedirect([]byte(change.Key), value)
+			if err != nil {
+				return err
+			}
+			if redirect.URL != change.URL {
+				return errRetargetConflict
+			}
+
+			redirect.URL = change.NewURL
+			data, err := models.EncodeRedirect(redirect)
+			if err != nil {
+				return err
+			}
+			if _, err := kvs[0].Replace([]byte(change.Key), data); err != nil {
+				return err
+			}
+			if kvs[1] != nil {
+				err := models.RecordChange(kvs[1], models.Change{Key: change.Key, From: change.URL, To: change.NewURL,
+					Reason: models.ChangeRetarget, Time: now})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, ns.Redirects, ns.History)
+}
+
+// HandleGetHistory lists the recorded changes of the redirect of the key in the "key" query parameter, oldest first.
+// The history of deleted redirects is kept. Responds with a 400 status if there is no key.
+func (r *RedirectorController) HandleGetHistory(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a key is required"})
+		return
+	}
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// The key may be an alias, or predate the key policy.
+	key, _, err = r.lookupKey(ns, key)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	history, err := models.ListHistory(ns.History, key)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "history": history})
+}
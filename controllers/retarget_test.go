@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// retargetResponse is the response to a retarget request.
+type retargetResponse struct {
+	DryRun  bool       `json:"dry_run"`
+	Changes []retarget `json:"changes"`
+}
+
+func setupRetargetRouter(t *testing.T) (*gin.Engine, *models.KVWrapper) {
+	store := setupDomainStore(t)
+	redirects := models.NamespaceRedirects(store.DB, "")
+	controller := &RedirectorController{
+		KV:        redirects,
+		Targets:   models.NamespaceTargets(store.DB, ""),
+		History:   &models.KVWrapper{DB: store.DB, Bucket: []byte(models.HistoryBucket)},
+		URLPolicy: &helpers.URLPolicy{BlockDomains: []string{"blocked.example.com"}},
+	}
+	for key, target := range map[string]string{
+		"docs":  "https://old.example.com/docs",
+		"blog":  "https://old.example.com:8443/blog?x=1",
+		"other": "https://example.com/old.example.com",
+	} {
+		_ = redirects.Put([]byte(key), []byte(target))
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/:key/*mode", controller.HandleGet)
+	router.GET("/api/search", controller.HandleSearch)
+	router.POST("/api/retarget", controller.HandlePostRetarget)
+	router.GET("/api/history", controller.HandleGetHistory)
+	return router, redirects
+}
+
+func Test_HandlePostRetarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          interface{}
+		expectStatus  int
+		expectChanges []retarget
+	}{
+		{"host", gin.H{"match": gin.H{"host": "old.example.com"}, "replacement": "new.example.com"}, http.StatusOK,
+			[]retarget{
+				{Key: "blog", URL: "https://old.example.com:8443/blog?x=1", NewURL: "https://new.example.com:8443/blog?x=1"},
+				{Key: "docs", URL: "https://old.example.com/docs", NewURL: "https://new.example.com/docs"},
+			}},
+		{"prefix", gin.H{"match": gin.H{"prefix": "https://old.example.com/"}, "replacement": "https://docs.example.com/"},
+			http.StatusOK, []retarget{
+				{Key: "docs", URL: "https://old.example.com/docs", NewURL: "https://docs.example.com/docs"},
+			}},
+		{"regex", gin.H{"match": gin.H{"regex": `\?x=1$`}, "replacement": ""}, http.StatusOK, []retarget{
+			{Key: "blog", URL: "https://old.example.com:8443/blog?x=1", NewURL: "https://old.example.com:8443/blog"},
+		}},
+		{"nothing matches", gin.H{"match": gin.H{"host": "example.org"}, "replacement": "example.net"}, http.StatusOK,
+			[]retarget{}},
+		{"refused", gin.H{"match": gin.H{"host": "old.example.com"}, "replacement": "blocked.example.com"},
+			http.StatusUnprocessableEntity, nil},
+		{"relative", gin.H{"match": gin.H{"prefix": "https://old.example.com"}, "replacement": ""},
+			http.StatusUnprocessableEntity, nil},
+		{"no match", gin.H{"replacement": "new.example.com"}, http.StatusBadRequest, nil},
+		{"invalid regex", gin.H{"match": gin.H{"regex": "("}, "replacement": ""}, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, redirects := setupRetargetRouter(t)
+
+			// A dry run only lists the changes.
+			body, _ := json.Marshal(test.body)
+			var dryRun map[string]interface{}
+			_ = json.Unmarshal(body, &dryRun)
+			dryRun["dry_run"] = true
+			rec := doJSON(router, http.MethodPost, "/api/retarget", dryRun)
+			if test.expectStatus == http.StatusBadRequest {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, rec.Code)
+			}
+			value, _ := redirects.Get([]byte("docs"))
+			assert.Equal(t, "https://old.example.com/docs", string(value))
+
+			rec = doJSON(router, http.MethodPost, "/api/retarget", test.body)
+			assert.Equal(t, test.expectStatus, rec.Code)
+			if test.expectStatus != http.StatusOK {
+				value, _ := redirects.Get([]byte("docs"))
+				assert.Equal(t, "https://old.example.com/docs", string(value))
+				return
+			}
+			var response retargetResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, test.expectChanges, response.Changes)
+
+			for _, change := range test.expectChanges {
+				rec := doJSON(router, http.MethodGet, "/"+change.Key+"/json", nil)
+				assert.Contains(t, rec.Body.String(), change.NewURL)
+
+				rec = doJSON(router, http.MethodGet, "/api/history?key="+change.Key, nil)
+				var history struct {
+					History []models.Change `json:"history"`
+				}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+				if assert.Len(t, history.History, 1) {
+					assert.Equal(t, change.URL, history.History[0].From)
+					assert.Equal(t, change.NewURL, history.History[0].To)
+					assert.Equal(t, models.ChangeRetarget, history.History[0].Reason)
+				}
+			}
+		})
+	}
+}
+
+func Test_HandlePostRetarget_Index(t *testing.T) {
+	router, _ := setupRetargetRouter(t)
+
+	rec := doJSON(router, http.MethodPost, "/api/retarget",
+		gin.H{"match": gin.H{"host": "old.example.com"}, "replacement": "new.example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The reverse index follows the new targets.
+	rec = doJSON(router, http.MethodGet, "/api/search?target=old.example.com", nil)
+	assert.JSONEq(t, `{"target":"old.example.com","redirects":[]}`, rec.Body.String())
+	rec = doJSON(router, http.MethodGet, "/api/search?target=new.example.com", nil)
+	assert.Contains(t, rec.Body.String(), `"key":"blog"`)
+	assert.Contains(t, rec.Body.String(), `"key":"docs"`)
+}
+
+func Test_HandleGetHistory(t *testing.T) {
+	router, _ := setupRetargetRouter(t)
+
+	rec := doJSON(router, http.MethodGet, "/api/history?key=docs", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"key":"docs","history":[]}`, rec.Body.String())
+
+	rec = doJSON(router, http.MethodGet, "/api/history", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func Test_HandlePostRetarget_Loop(t *testing.T) {
+	store := setupDomainStore(t)
+	redirects := models.NamespaceRedirects(store.DB, "")
+	controller := &RedirectorController{KV: redirects, PublicHosts: []string{"lnk.now"}}
+	_ = redirects.Put([]byte("a"), []byte("https://old.example.com/to-b"))
+	_ = redirects.Put([]byte("b"), []byte("https://old.example.com/to-a"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/retarget", controller.HandlePostRetarget)
+
+	// Each change is fine on its own, but together they make a loop.
+	rec := doJSON(router, http.MethodPost, "/api/retarget",
+		gin.H{"match": gin.H{"prefix": "https://old.example.com/to-"}, "replacement": "https://lnk.now/"})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var response retargetResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	if assert.Len(t, response.Changes, 2) {
+		for _, change := range response.Changes {
+			assert.Equal(t, helpers.URLRuleLoop, change.Rule)
+		}
+	}
+	value, _ := redirects.Get([]byte("a"))
+	assert.Equal(t, "https://old.example.com/to-b", string(value))
+}
@@ -1,11 +1,40 @@
 package controllers
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+	"github.com/thedeltaflyer/redirector/templates"
+)
+
+// DefaultRootText is the root page text used when the requested domain doesn't provide its own.
+const DefaultRootText = "Welcome to lnk.now. This is a private URL shortener for perpetualtag.com."
 
 // RootController provides an interface for "static" pages.
-type RootController struct{}
+// Namespaces (optional) allows registered domains to override the root page text, and Templates (optional) enables
+// HTML responses for browsers.
+type RootController struct {
+	Namespaces models.NamespaceResolver
+	Templates  *templates.Set
+}
 
-// HandleGet returns a basic string to let us know that the service is working if we don't specify a key.
-func (_ *RootController) HandleGet(c *gin.Context) {
-	c.String(200, "Welcome to lnk.now. This is a private URL shortener for perpetualtag.com.")
+// HandleGet returns a basic page to let us know that the service is working if we don't specify a key.
+// The page is rendered as text, JSON, or HTML depending on the Accept header.
+func (rc *RootController) HandleGet(c *gin.Context) {
+	host := helpers.NormalizeHost(c.Request.Host)
+	text := DefaultRootText
+	if rc.Namespaces != nil {
+		ns, err := rc.Namespaces.Resolve(host)
+		if err != nil {
+			logging.GetLogger().Error(err)
+		} else if ns != nil && ns.Domain.RootText != "" {
+			text = ns.Domain.RootText
+		}
+	}
+	renderPage(c, rc.Templates, http.StatusOK, templates.Root, templates.Page{Host: host, Text: text}, text,
+		gin.H{"message": text})
 }
@@ -7,6 +7,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/models"
+	"github.com/thedeltaflyer/redirector/templates"
 )
 
 func TestHandleGet(t *testing.T) {
@@ -42,3 +45,68 @@ func TestHandleGet(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleGet_Domain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	rc := &RootController{Namespaces: mockResolver{
+		"go.team-a": {Domain: &models.Domain{Host: "go.team-a", RootText: "Team A links"}},
+		"lnk.now":   {Domain: &models.Domain{Host: "lnk.now"}},
+	}}
+	r.GET("/", rc.HandleGet)
+
+	tests := []struct {
+		host         string
+		expectedBody string
+	}{
+		{"go.team-a:8080", "Team A links"},
+		{"lnk.now", DefaultRootText},
+		{"unknown.example", DefaultRootText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestHandleGet_Negotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	pages, err := templates.Load("")
+	assert.NoError(t, err)
+	rc := &RootController{Templates: pages}
+	r.GET("/", rc.HandleGet)
+
+	tests := []struct {
+		name         string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{"no_accept", "", "text/plain; charset=utf-8", DefaultRootText},
+		{"any", "*/*", "text/plain; charset=utf-8", DefaultRootText},
+		{"json", "application/json", "application/json; charset=utf-8", `{"message":"` + DefaultRootText + `"}`},
+		{"browser", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<p>" + DefaultRootText + "</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
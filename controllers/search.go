@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// defaultSearchLimit is the number of redirects a search returns unless it asks for another one.
+const defaultSearchLimit = 20
+
+// searchQuery is the query of a search request, with either a target or terms.
+type searchQuery struct {
+	Target string `form:"target"`
+	Q      string `form:"q"`
+	After  string `form:"after"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// HandleSearch lists the redirects of the namespace of the request's host, ordered by key, that either:
+//   - lead to the "target" query parameter, which is either a URL, matching the redirects to the same normalized URL,
+//     or a host, matching every redirect to that host.
+//   - match every term of the "q" query parameter, which match the words of the key, URL, title, tags, and notes of
+//     redirects they're a prefix of.
+//
+// Results are paginated: "limit" (20 unless set, at most 100) redirects are returned, following the key in "after".
+// The "next" key of the response is the "after" of the next page, if there is one.
+// Responds with a 400 status if there is neither a target nor terms, or both.
+func (r *RedirectorController) HandleSearch(c *gin.Context) {
+	var query searchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (query.Target == "") == (query.Q == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either a target or a query is required"})
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultSearchLimit
+	}
+
+	ns, err := r.namespace(c)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	var keys []string
+	switch {
+	case query.Target != "" && ns.Targets != nil:
+		keys, err = ns.Targets.FindTarget(query.Target)
+	case query.Q != "" && ns.Terms != nil:
+		keys, err = ns.Terms.SearchTerms(query.Q)
+	}
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// Skip to the page following the key in "after".
+	keys = keys[sort.Search(len(keys), func(i int) bool { return keys[i] > query.After }):]
+
+	redirects := make([]models.Redirect, 0)
+	next := ""
+	for _, key := range keys {
+		if len(redirects) == query.Limit {
+			next = redirects[len(redirects)-1].Key
+			break
+		}
+		value, err := ns.Redirects.Get([]byte(key))
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if value == nil {
+			continue
+		}
+		redirect, err := models.DecodeRedirect([]byte(key), value)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		redirects = append(redirects, redirect)
+	}
+
+	response := gin.H{"redirects": redirects}
+	if query.Target != "" {
+		response["target"] = query.Target
+	} else {
+		response["q"] = query.Q
+	}
+	if next != "" {
+		response["next"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
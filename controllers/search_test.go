@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+func Test_HandleSearch(t *testing.T) {
+	store := setupDomainStore(t)
+	controller := &RedirectorController{
+		KV:      models.NamespaceRedirects(store.DB, ""),
+		Targets: models.NamespaceTargets(store.DB, ""),
+		Terms:   models.NamespaceTerms(store.DB, ""),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/:key", controller.HandlePost)
+	router.PUT("/:key", controller.HandlePutWithKey)
+	router.DELETE("/:key", controller.HandleDelete)
+	router.GET("/api/search", controller.HandleSearch)
+
+	for key, target := range map[string]string{
+		"docs":   "https://docs.example.com/guide",
+		"guide":  "https://Docs.example.com:443/guide",
+		"api":    "https://docs.example.com/api",
+		"home":   "https://example.com",
+		"moving": "https://old.example.com",
+	} {
+		assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, "/"+key, gin.H{"url": target}).Code)
+	}
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPut, "/moving", gin.H{"url": "https://docs.example.com"}).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, http.MethodDelete, "/api", nil).Code)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectStatus int
+		expectKeys   []string
+	}{
+		{"host", "target=docs.example.com", http.StatusOK, []string{"docs", "guide", "moving"}},
+		{"host in another case", "target=Docs.Example.com", http.StatusOK, []string{"docs", "guide", "moving"}},
+		{"URL", "target=" + url.QueryEscape("https://docs.example.com/guide"), http.StatusOK, []string{"docs", "guide"}},
+		{"URL without a path", "target=" + url.QueryEscape("https://example.com"), http.StatusOK, []string{"home"}},
+		{"former target", "target=old.example.com", http.StatusOK, []string{}},
+		{"deleted target", "target=" + url.QueryEscape("https://docs.example.com/api"), http.StatusOK, []string{}},
+		{"paginated", "target=docs.example.com&limit=2&after=docs", http.StatusOK, []string{"guide", "moving"}},
+		{"no target", "target=", http.StatusBadRequest, nil},
+		{"target and terms", "target=example.com&q=docs", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doJSON(router, http.MethodGet, "/api/search?"+test.query, nil)
+			assert.Equal(t, test.expectStatus, rec.Code)
+			if test.expectKeys == nil {
+				return
+			}
+			var body struct {
+				Redirects []models.Redirect `json:"redirects"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			keys := make([]string, 0)
+			for _, redirect := range body.Redirects {
+				keys = append(keys, redirect.Key)
+			}
+			assert.Equal(t, test.expectKeys, keys)
+		})
+	}
+}
+
+func Test_HandleSearch_Terms(t *testing.T) {
+	store := setupDomainStore(t)
+	controller := &RedirectorController{
+		KV:    models.NamespaceRedirects(store.DB, ""),
+		Terms: models.NamespaceTerms(store.DB, ""),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/:key", controller.HandlePost)
+	router.PUT("/:key", controller.HandlePutWithKey)
+	router.GET("/api/search", controller.HandleSearch)
+
+	for key, body := range map[string]gin.H{
+		"onboarding": {"url": "https://wiki.example.com/start", "title": "Onboarding doc", "tags": []string{"hr"}},
+		"handbook":   {"url": "https://wiki.example.com/handbook", "notes": "Read this during onboarding"},
+		"benefits":   {"url": "https://wiki.example.com/benefits", "tags": []string{"HR", "onboarding"}},
+		"q4":         {"url": "https://reports.example.com/q4", "title": "Quarterly figures"},
+	} {
+		assert.Equal(t, http.StatusOK, doJSON(router, http.MethodPost, "/"+key, body).Code)
+	}
+	assert.Equal(t, http.StatusOK,
+		doJSON(router, http.MethodPut, "/q4", gin.H{"url": "https://reports.example.com/q4", "title": "Onboarding stats"}).Code)
+
+	search := func(query string) ([]string, string) {
+		rec := doJSON(router, http.MethodGet, "/api/search?"+query, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Redirects []models.Redirect `json:"redirects"`
+			Next      string            `json:"next"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		keys := make([]string, 0)
+		for _, redirect := range body.Redirects {
+			keys = append(keys, redirect.Key)
+		}
+		return keys, body.Next
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		expectKeys []string
+		expectNext string
+	}{
+		{"key, title, tags, and notes", "q=onboarding", []string{"benefits", "handbook", "onboarding", "q4"}, ""},
+		{"prefix", "q=onboard", []string{"benefits", "handbook", "onboarding", "q4"}, ""},
+		{"every term", "q=onboard+hr", []string{"benefits", "onboarding"}, ""},
+		{"URL", "q=wiki+handbook", []string{"handbook"}, ""},
+		{"replaced title", "q=quarterly", []string{}, ""},
+		{"no match", "q=payroll", []string{}, ""},
+		{"first page", "q=onboard&limit=3", []string{"benefits", "handbook", "onboarding"}, "onboarding"},
+		{"next page", "q=onboard&limit=3&after=onboarding", []string{"q4"}, ""},
+		{"exact page", "q=onboard&limit=2&after=handbook", []string{"onboarding", "q4"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, next := search(test.query)
+			assert.Equal(t, test.expectKeys, keys)
+			assert.Equal(t, test.expectNext, next)
+		})
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, http.MethodGet, "/api/search?q=docs&limit=1000", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, http.MethodPost, "/long",
+		gin.H{"url": "https://example.com", "title": strings.Repeat("a", 257)}).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, http.MethodPost, "/empty-tag",
+		gin.H{"url": "https://example.com", "tags": []string{""}}).Code)
+}
@@ -26,10 +26,11 @@ func InitDB(path string, migrate bool) {
 	}
 }
 
-// MigrateDB initializes required database buckets for storing redirects, API keys, and health checks. It panics on failure.
+// MigrateDB initializes required database buckets for storing redirects, API keys, domains, and health checks.
+// It panics on failure.
 func MigrateDB() {
 	database := GetDB()
-	buckets := []string{"redirects", "api_keys", "health_checks"}
+	buckets := []string{"redirects", "api_keys", "domains", "health_checks"}
 	err := database.Update(func(tx *bolt.Tx) error {
 		for _, bucket := range buckets {
 			createErr := checkOrCreateBucket(tx, []byte(bucket))
@@ -48,7 +48,7 @@ func TestInitDB(t *testing.T) {
 		}
 
 		// Check for buckets created during migration
-		buckets := []string{"redirects", "api_keys", "health_checks"}
+		buckets := []string{"redirects", "api_keys", "domains", "health_checks"}
 		err := db.View(func(tx *bolt.Tx) error {
 			for _, bucket := range buckets {
 				if tx.Bucket([]byte(bucket)) == nil {
@@ -72,7 +72,7 @@ func TestMigrateDB(t *testing.T) {
 	MigrateDB()
 
 	// Verify the buckets are created
-	buckets := []string{"redirects", "api_keys", "health_checks"}
+	buckets := []string{"redirects", "api_keys", "domains", "health_checks"}
 	err := db.View(func(tx *bolt.Tx) error {
 		for _, bucket := range buckets {
 			if tx.Bucket([]byte(bucket)) == nil {
@@ -3,6 +3,7 @@ package helpers
 import (
 	"fmt"
 	"image/color"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -49,3 +50,151 @@ func HexToRGBA(hex string) (color.RGBA, error) {
 
 	return c, nil
 }
+
+// ParseColor converts a CSS color to an RGBA color. Supported forms are hex values (see HexToRGBA), named colors
+// (including "transparent"), and the rgb(), rgba(), hsl(), and hsla() functions with comma or space separated
+// arguments, e.g. "rgb(255 0 0 / 50%)". Like HexToRGBA, the alpha is not premultiplied.
+func ParseColor(value string) (color.RGBA, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if named, ok := cssColors[value]; ok {
+		return named, nil
+	}
+	if value == "transparent" {
+		return color.RGBA{}, nil
+	}
+
+	name, args, ok := strings.Cut(value, "(")
+	if !ok {
+		return HexToRGBA(value)
+	}
+	if !strings.HasSuffix(args, ")") {
+		return color.RGBA{}, fmt.Errorf("invalid color: %s", value)
+	}
+
+	// Split the arguments, the alpha can be separated with a "/" in the space separated syntax.
+	args = strings.TrimSuffix(args, ")")
+	args = strings.ReplaceAll(args, "/", " ")
+	fields := strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) != 3 && len(fields) != 4 {
+		return color.RGBA{}, fmt.Errorf("invalid number of arguments for a color: %s", value)
+	}
+
+	alpha := 1.0
+	if len(fields) == 4 {
+		a, err := parseColorNumber(fields[3], 1)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid alpha in color %s: %w", value, err)
+		}
+		alpha = a
+	}
+
+	var r, g, b float64
+	switch name {
+	case "rgb", "rgba":
+		var channels [3]float64
+		for i := range channels {
+			channel, err := parseColorNumber(fields[i], 255)
+			if err != nil {
+				return color.RGBA{}, fmt.Errorf("invalid channel in color %s: %w", value, err)
+			}
+			channels[i] = channel / 255
+		}
+		r, g, b = channels[0], channels[1], channels[2]
+	case "hsl", "hsla":
+		hue, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "deg"), 64)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid hue in color %s", value)
+		}
+		saturation, err := parseColorNumber(fields[1], 100)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid saturation in color %s: %w", value, err)
+		}
+		lightness, err := parseColorNumber(fields[2], 100)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid lightness in color %s: %w", value, err)
+		}
+		r, g, b = hslToRGB(hue, saturation/100, lightness/100)
+	default:
+		return color.RGBA{}, fmt.Errorf("unsupported color function: %s", name)
+	}
+
+	return color.RGBA{R: colorByte(r), G: colorByte(g), B: colorByte(b), A: colorByte(alpha)}, nil
+}
+
+// parseColorNumber parses a color argument, either a number from 0 to max or a percentage of max.
+func parseColorNumber(value string, max float64) (float64, error) {
+	percent := strings.HasSuffix(value, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number: %s", value)
+	}
+	if percent {
+		n = n / 100 * max
+	}
+	if n < 0 || n > max {
+		return 0, fmt.Errorf("out of range: %s", value)
+	}
+	return n, nil
+}
+
+// hslToRGB converts a hue (in degrees), saturation, and lightness (from 0 to 1) to RGB channels from 0 to 1.
+func hslToRGB(hue float64, saturation float64, lightness float64) (float64, float64, float64) {
+	hue = math.Mod(math.Mod(hue, 360)+360, 360)
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// colorByte converts a channel from 0 to 1 to a byte.
+func colorByte(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+// RelativeLuminance returns the WCAG relative luminance of an opaque color, from 0 (black) to 1 (white).
+func RelativeLuminance(c color.RGBA) float64 {
+	linear := func(channel uint8) float64 {
+		v := float64(channel) / 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// ContrastRatio returns the WCAG contrast ratio of two opaque colors, from 1 to 21. The order of the colors doesn't
+// matter, so light-on-dark pairs have the same ratio as their dark-on-light counterparts.
+func ContrastRatio(a color.RGBA, b color.RGBA) float64 {
+	la, lb := RelativeLuminance(a), RelativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// flattenColor composites a (not premultiplied) color over an opaque backdrop.
+func flattenColor(c color.RGBA, backdrop color.RGBA) color.RGBA {
+	alpha := float64(c.A) / 255
+	mix := func(u uint8, v uint8) uint8 {
+		return uint8(math.Round(float64(u)*alpha + float64(v)*(1-alpha)))
+	}
+	return color.RGBA{R: mix(c.R, backdrop.R), G: mix(c.G, backdrop.G), B: mix(c.B, backdrop.B), A: 255}
+}
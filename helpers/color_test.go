@@ -81,3 +81,63 @@ func TestHexToRGBA(t *testing.T) {
 		})
 	}
 }
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{value: "#112233", want: color.RGBA{R: 17, G: 34, B: 51, A: 255}},
+		{value: "RebeccaPurple", want: color.RGBA{R: 102, G: 51, B: 153, A: 255}},
+		{value: " navy ", want: color.RGBA{B: 128, A: 255}},
+		{value: "transparent", want: color.RGBA{}},
+		{value: "rgb(17, 34, 51)", want: color.RGBA{R: 17, G: 34, B: 51, A: 255}},
+		{value: "rgba(17,34,51,0.2667)", want: color.RGBA{R: 17, G: 34, B: 51, A: 68}},
+		{value: "rgb(100% 0% 50% / 50%)", want: color.RGBA{R: 255, B: 128, A: 128}},
+		{value: "hsl(0, 100%, 50%)", want: color.RGBA{R: 255, A: 255}},
+		{value: "hsl(120deg 100% 25%)", want: color.RGBA{G: 128, A: 255}},
+		{value: "hsla(240, 100%, 50%, 0)", want: color.RGBA{B: 255}},
+		{value: "hsl(-120, 100%, 50%)", want: color.RGBA{B: 255, A: 255}},
+		{value: "notacolor", wantErr: true},
+		{value: "rgb(1, 2)", wantErr: true},
+		{value: "rgb(256, 0, 0)", wantErr: true},
+		{value: "rgb(0, 0, 0", wantErr: true},
+		{value: "cmyk(0, 0, 0, 0)", wantErr: true},
+		{value: "rgba(0, 0, 0, 2)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseColor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContrastRatio(t *testing.T) {
+	black := color.RGBA{A: 255}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+	if got := ContrastRatio(black, white); got < 20.99 || got > 21.01 {
+		t.Errorf("expected black on white to be 21:1, got %v", got)
+	}
+	if ContrastRatio(black, white) != ContrastRatio(white, black) {
+		t.Error("expected the contrast ratio to be symmetric")
+	}
+	if got := ContrastRatio(white, white); got != 1 {
+		t.Errorf("expected white on white to be 1:1, got %v", got)
+	}
+}
+
+func TestFlattenColor(t *testing.T) {
+	got := flattenColor(color.RGBA{A: 128}, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	if got != (color.RGBA{R: 127, G: 127, B: 127, A: 255}) {
+		t.Errorf("expected grey, got %v", got)
+	}
+}
@@ -57,3 +57,121 @@ func NewDoesNotExistError(key []byte) *DoesNotExistError {
 		err: fmt.Errorf("key %q does not exist", key),
 	}
 }
+
+// InUseError represents an error indicating that a key or entry cannot be removed because other data still depends on it.
+type InUseError struct {
+	err error
+}
+
+// Error returns the error message. If the receiver or wrapped error is nil, it returns "<nil>".
+func (e *InUseError) Error() string {
+	if e == nil || e.err == nil {
+		return "<nil>"
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error if it exists; otherwise, it returns nil.
+func (e *InUseError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.err
+}
+
+// NewInUseError creates a new InUseError with a message explaining why the given key is still in use.
+func NewInUseError(key []byte, reason string) *InUseError {
+	return &InUseError{
+		err: fmt.Errorf("key %q is still in use: %s", key, reason),
+	}
+}
+
+// UnscannableError represents an error indicating that a rendered QR code can't be read back as what it encodes.
+type UnscannableError struct {
+	err error
+}
+
+// Error returns the error message. If the receiver or wrapped error is nil, it returns "<nil>".
+func (e *UnscannableError) Error() string {
+	if e == nil || e.err == nil {
+		return "<nil>"
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error if it exists; otherwise, it returns nil.
+func (e *UnscannableError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.err
+}
+
+// NewUnscannableError creates a new UnscannableError with a message explaining why the QR code can't be read.
+func NewUnscannableError(reason error) *UnscannableError {
+	return &UnscannableError{
+		err: fmt.Errorf("the QR code can't be scanned: %w", reason),
+	}
+}
+
+// PolicyError represents an error indicating that a redirect's URL is rejected by the URL policy, along with the rule
+// that rejected it.
+type PolicyError struct {
+	Rule string
+	err  error
+}
+
+// Error returns the error message. If the receiver or wrapped error is nil, it returns "<nil>".
+func (e *PolicyError) Error() string {
+	if e == nil || e.err == nil {
+		return "<nil>"
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error if it exists; otherwise, it returns nil.
+func (e *PolicyError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.err
+}
+
+// NewPolicyError creates a new PolicyError for the given rule, with a message explaining why the URL is rejected.
+func NewPolicyError(rule string, reason string) *PolicyError {
+	return &PolicyError{
+		Rule: rule,
+		err:  fmt.Errorf("the URL is not allowed: %s", reason),
+	}
+}
+
+// KeyError represents an error indicating that a key is rejected by the key policy, along with the rule that rejected
+// it.
+type KeyError struct {
+	Rule string
+	err  error
+}
+
+// Error returns the error message. If the receiver or wrapped error is nil, it returns "<nil>".
+func (e *KeyError) Error() string {
+	if e == nil || e.err == nil {
+		return "<nil>"
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error if it exists; otherwise, it returns nil.
+func (e *KeyError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.err
+}
+
+// NewKeyError creates a new KeyError for the given rule, with a message explaining why the key is rejected.
+func NewKeyError(rule string, reason string) *KeyError {
+	return &KeyError{
+		Rule: rule,
+		err:  fmt.Errorf("invalid key: %s", reason),
+	}
+}
@@ -144,3 +144,123 @@ func TestNewDoesNotExistError(t *testing.T) {
 		})
 	}
 }
+
+func TestInUseError(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorObj  *InUseError
+		want      string
+		wantInner error
+	}{
+		{"NilErrorObject", nil, "<nil>", nil},
+		{"NilWrappedError", &InUseError{}, "<nil>", nil},
+		{"NonNilWrappedError", &InUseError{err: errors.New("test error")}, "test error", errors.New("test error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.errorObj.Error(); got != tt.want {
+				t.Errorf("Error() = %v, want %v", got, tt.want)
+			}
+			got := tt.errorObj.Unwrap()
+			if got == nil && tt.wantInner == nil {
+				return
+			}
+			if got == nil || tt.wantInner == nil || got.Error() != tt.wantInner.Error() {
+				t.Errorf("Unwrap() = %v, want %v", got, tt.wantInner)
+			}
+		})
+	}
+}
+
+func TestNewInUseError(t *testing.T) {
+	err := NewInUseError([]byte("test"), "2 aliases")
+	if err == nil {
+		t.Fatalf("Expected non-nil error")
+	}
+	if want := `key "test" is still in use: 2 aliases`; err.Error() != want {
+		t.Errorf("NewInUseError() = %v, want %v", err.Error(), want)
+	}
+}
+
+func TestPolicyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorObj  *PolicyError
+		want      string
+		wantInner error
+	}{
+		{"NilErrorObject", nil, "<nil>", nil},
+		{"NilWrappedError", &PolicyError{}, "<nil>", nil},
+		{"NonNilWrappedError", &PolicyError{err: errors.New("test error")}, "test error", errors.New("test error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.errorObj.Error(); got != tt.want {
+				t.Errorf("Error() = %v, want %v", got, tt.want)
+			}
+			got := tt.errorObj.Unwrap()
+			if got == nil && tt.wantInner == nil {
+				return
+			}
+			if got == nil || tt.wantInner == nil || got.Error() != tt.wantInner.Error() {
+				t.Errorf("Unwrap() = %v, want %v", got, tt.wantInner)
+			}
+		})
+	}
+}
+
+func TestNewPolicyError(t *testing.T) {
+	err := NewPolicyError(URLRuleScheme, `the "file" scheme is not allowed`)
+	if err == nil {
+		t.Fatalf("Expected non-nil error")
+	}
+	if err.Rule != URLRuleScheme {
+		t.Errorf("NewPolicyError().Rule = %v, want %v", err.Rule, URLRuleScheme)
+	}
+	if want := `the URL is not allowed: the "file" scheme is not allowed`; err.Error() != want {
+		t.Errorf("NewPolicyError() = %v, want %v", err.Error(), want)
+	}
+}
+
+func TestKeyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorObj  *KeyError
+		want      string
+		wantInner error
+	}{
+		{"NilErrorObject", nil, "<nil>", nil},
+		{"NilWrappedError", &KeyError{}, "<nil>", nil},
+		{"NonNilWrappedError", &KeyError{err: errors.New("test error")}, "test error", errors.New("test error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.errorObj.Error(); got != tt.want {
+				t.Errorf("Error() = %v, want %v", got, tt.want)
+			}
+			got := tt.errorObj.Unwrap()
+			if got == nil && tt.wantInner == nil {
+				return
+			}
+			if got == nil || tt.wantInner == nil || got.Error() != tt.wantInner.Error() {
+				t.Errorf("Unwrap() = %v, want %v", got, tt.wantInner)
+			}
+		})
+	}
+}
+
+func TestNewKeyError(t *testing.T) {
+	err := NewKeyError(KeyRuleReserved, `"health" is reserved`)
+	if err == nil {
+		t.Fatalf("Expected non-nil error")
+	}
+	if err.Rule != KeyRuleReserved {
+		t.Errorf("NewKeyError().Rule = %v, want %v", err.Rule, KeyRuleReserved)
+	}
+	if want := `invalid key: "health" is reserved`; err.Error() != want {
+		t.Errorf("NewKeyError() = %v, want %v", err.Error(), want)
+	}
+}
@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeHost lowercases a request host and strips any port and trailing dot, so that "LNK.now:443" and "lnk.now."
+// both resolve to "lnk.now".
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// defaultPorts are the ports that URLs of a scheme use when they don't name one.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// NormalizeURL returns rawURL in a canonical form, so that URLs leading to the same place compare equal: the host is
+// normalized, the scheme's default port and an empty path are dropped, and query parameters are sorted. URLs that
+// can't be parsed are returned as they are.
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	if u.RawQuery != "" {
+		if query, err := url.ParseQuery(u.RawQuery); err == nil {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
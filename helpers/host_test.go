@@ -0,0 +1,57 @@
+package helpers
+
+import "testing"
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"plain host", "lnk.now", "lnk.now"},
+		{"uppercase host", "LNK.Now", "lnk.now"},
+		{"host with port", "lnk.now:8080", "lnk.now"},
+		{"trailing dot", "lnk.now.", "lnk.now"},
+		{"ipv6 with port", "[::1]:8080", "::1"},
+		{"empty host", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeHost(tt.host); got != tt.want {
+				t.Errorf("NormalizeHost(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"canonical", "https://example.com/a?b=1", "https://example.com/a?b=1"},
+		{"case", "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"default port", "https://example.com:443/", "https://example.com/"},
+		{"other port", "https://example.com:8443/", "https://example.com:8443/"},
+		{"http default port", "http://example.com:80", "http://example.com/"},
+		{"empty path", "https://example.com", "https://example.com/"},
+		{"trailing dot", "https://example.com./", "https://example.com/"},
+		{"sorted query", "https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"fragment", "https://example.com/#top", "https://example.com/#top"},
+		{"ipv6", "http://[::1]:80/", "http://[::1]/"},
+		{"ipv6 port", "http://[::1]:8080/", "http://[::1]:8080/"},
+		{"whitespace", " https://example.com/ ", "https://example.com/"},
+		{"no host", "mailto:hello@example.com", "mailto:hello@example.com"},
+		{"invalid", "https://exa mple.com/%zz", "https://exa mple.com/%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeURL(tt.url); got != tt.want {
+				t.Errorf("NormalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
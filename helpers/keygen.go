@@ -0,0 +1,228 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/matoous/go-nanoid/v2"
+)
+
+// Names of the key generators, as accepted by NewKeyGenerator.
+const (
+	KeyGeneratorNanoid = "nanoid" // Random characters out of a configurable alphabet, e.g. "V1StGXR8_Z5j"
+	KeyGeneratorBase32 = "base32" // Random lowercase letters and digits that can't be mistaken for each other, e.g. "k7fq2xmz9c4h"
+	KeyGeneratorWords  = "words"  // Random words followed by digits, e.g. "brave-otter-42"
+)
+
+// KeyGeneratorNames lists the names of the key generators.
+var KeyGeneratorNames = []string{KeyGeneratorNanoid, KeyGeneratorBase32, KeyGeneratorWords}
+
+// Defaults of the key generators.
+const (
+	DefaultNanoidAlphabet = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	DefaultNanoidLength   = 12
+	DefaultBase32Length   = 12
+	DefaultWordDigits     = 2
+)
+
+// Base32Alphabet is the alphabet of base32 keys: lowercase letters and digits, without the "0", "1", "l", and "o" that
+// are easily mistaken for one another when read aloud or copied by hand.
+const Base32Alphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+// DefaultKeyGenerator is the key generator used where none is configured.
+var DefaultKeyGenerator KeyGenerator = NanoidGenerator{Alphabet: DefaultNanoidAlphabet, Length: DefaultNanoidLength}
+
+// KeyGenerator generates random keys for redirects created without one.
+type KeyGenerator interface {
+	Generate() (string, error)
+}
+
+// SizedKeyGenerator is a KeyGenerator that knows how many different keys it can generate, and that can generate longer
+// keys to make room for more.
+type SizedKeyGenerator interface {
+	KeyGenerator
+	Keyspace() float64
+	Longer() SizedKeyGenerator
+}
+
+// CharsetKeyGenerator is a KeyGenerator that knows which characters its keys are made of.
+type CharsetKeyGenerator interface {
+	KeyGenerator
+	Charset() string
+}
+
+// maxKeyGrowth bounds how much longer GrowKeyGenerator makes keys.
+const maxKeyGrowth = 64
+
+// GrowKeyGenerator returns generator, made longer until count keys fill at most maxDensity of its keyspace, which is
+// about the chance that a generated key is already taken. Generators that aren't SizedKeyGenerators are returned as
+// they are.
+func GrowKeyGenerator(generator KeyGenerator, count int, maxDensity float64) KeyGenerator {
+	sized, ok := generator.(SizedKeyGenerator)
+	if !ok {
+		return generator
+	}
+	for i := 0; i < maxKeyGrowth && float64(count) > sized.Keyspace()*maxDensity; i++ {
+		sized = sized.Longer()
+	}
+	return sized
+}
+
+// NewKeyGenerator creates the key generator called name. length is the number of characters of nanoid and base32
+// keys, or the number of digits ending word keys, and alphabet the characters of nanoid keys. Zero values pick the
+// generator's defaults.
+func NewKeyGenerator(name string, alphabet string, length int) (KeyGenerator, error) {
+	if length < 0 {
+		return nil, fmt.Errorf("invalid key length: %d", length)
+	}
+	if alphabet != "" && name != KeyGeneratorNanoid {
+		return nil, fmt.Errorf("a key alphabet can only be set for %s keys", KeyGeneratorNanoid)
+	}
+
+	switch name {
+	case KeyGeneratorNanoid:
+		if alphabet == "" {
+			alphabet = DefaultNanoidAlphabet
+		}
+		if n := utf8.RuneCountInString(alphabet); n < 2 || n > 255 {
+			return nil, fmt.Errorf("invalid key alphabet %q (must have 2 to 255 characters)", alphabet)
+		}
+		return NanoidGenerator{Alphabet: alphabet, Length: defaultInt(length, DefaultNanoidLength)}, nil
+	case KeyGeneratorBase32:
+		return NanoidGenerator{Alphabet: Base32Alphabet, Length: defaultInt(length, DefaultBase32Length)}, nil
+	case KeyGeneratorWords:
+		return WordGenerator{Digits: defaultInt(length, DefaultWordDigits)}, nil
+	default:
+		return nil, fmt.Errorf("invalid key generator (must be one of %s): %s", strings.Join(KeyGeneratorNames, ","), name)
+	}
+}
+
+// defaultInt returns value, or fallback if value is zero.
+func defaultInt(value int, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// NanoidGenerator generates keys of Length random characters out of Alphabet.
+type NanoidGenerator struct {
+	Alphabet string
+	Length   int
+}
+
+// Generate returns a new random key.
+func (g NanoidGenerator) Generate() (string, error) {
+	return gonanoid.Generate(g.Alphabet, g.Length)
+}
+
+// Keyspace returns the number of different keys the generator can generate.
+func (g NanoidGenerator) Keyspace() float64 {
+	return math.Pow(float64(utf8.RuneCountInString(g.Alphabet)), float64(g.Length))
+}
+
+// Charset returns the characters keys are made of.
+func (g NanoidGenerator) Charset() string {
+	return g.Alphabet
+}
+
+// Longer returns the generator of keys one character longer.
+func (g NanoidGenerator) Longer() SizedKeyGenerator {
+	g.Length++
+	return g
+}
+
+// WordGenerator generates keys made of an adjective and an animal followed by Digits random digits, such as
+// "brave-otter-42", which are easy to read aloud and to remember.
+type WordGenerator struct {
+	Digits int
+}
+
+// Generate returns a new random key.
+func (g WordGenerator) Generate() (string, error) {
+	adjective, err := randomIndex(len(keyAdjectives))
+	if err != nil {
+		return "", err
+	}
+	animal, err := randomIndex(len(keyAnimals))
+	if err != nil {
+		return "", err
+	}
+	key := keyAdjectives[adjective] + "-" + keyAnimals[animal]
+	if g.Digits > 0 {
+		digits, err := gonanoid.Generate("0123456789", g.Digits)
+		if err != nil {
+			return "", err
+		}
+		key += "-" + digits
+	}
+	return key, nil
+}
+
+// Keyspace returns the number of different keys the generator can generate.
+func (g WordGenerator) Keyspace() float64 {
+	return float64(len(keyAdjectives)*len(keyAnimals)) * math.Pow(10, float64(g.Digits))
+}
+
+// Charset returns the characters keys are made of: those of the words, the hyphens between them, and the digits.
+func (g WordGenerator) Charset() string {
+	var charset strings.Builder
+	seen := map[rune]bool{}
+	add := func(chars string) {
+		for _, r := range chars {
+			if !seen[r] {
+				seen[r] = true
+				charset.WriteRune(r)
+			}
+		}
+	}
+	for _, words := range [][]string{keyAdjectives, keyAnimals} {
+		for _, word := range words {
+			add(word)
+		}
+	}
+	add("-")
+	if g.Digits > 0 {
+		add("0123456789")
+	}
+	return charset.String()
+}
+
+// Longer returns the generator of keys ending with one more digit.
+func (g WordGenerator) Longer() SizedKeyGenerator {
+	g.Digits++
+	return g
+}
+
+// randomIndex returns a uniformly random index below n.
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// Words of word keys. They're short, common, and spelled the way they sound, so that keys survive being read aloud.
+var (
+	keyAdjectives = []string{
+		"able", "bold", "brave", "brief", "bright", "busy", "calm", "clean", "clear", "cool", "cozy", "crisp", "eager",
+		"early", "easy", "fair", "fast", "fine", "firm", "fresh", "glad", "gold", "good", "grand", "great", "green",
+		"happy", "jolly", "keen", "kind", "large", "lively", "lucky", "merry", "mild", "modern", "neat", "nice",
+		"noble", "plain", "polite", "proud", "quick", "quiet", "rapid", "ready", "rich", "royal", "safe", "sharp",
+		"shiny", "silver", "simple", "smart", "smooth", "snowy", "solid", "steady", "sunny", "swift", "tidy", "warm",
+		"wise", "witty",
+	}
+	keyAnimals = []string{
+		"badger", "bat", "bear", "beaver", "bee", "bison", "camel", "cat", "cobra", "crab", "crane", "crow", "deer",
+		"dingo", "dog", "dolphin", "dove", "duck", "eagle", "falcon", "ferret", "finch", "fox", "frog", "gecko",
+		"goat", "goose", "hare", "hawk", "heron", "horse", "koala", "lemur", "lion", "llama", "lynx", "mole", "moose",
+		"mouse", "newt", "otter", "owl", "panda", "parrot", "pelican", "penguin", "pony", "puffin", "rabbit",
+		"raven", "robin", "salmon", "seal", "shark", "sheep", "snail", "swan", "tiger", "toad", "trout", "turtle",
+		"walrus", "whale", "wolf",
+	}
+)
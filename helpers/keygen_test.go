@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator string
+		alphabet  string
+		length    int
+		pattern   string
+		wantErr   string
+	}{
+		{"nanoid", KeyGeneratorNanoid, "", 0, `^[A-Za-z0-9_-]{12}$`, ""},
+		{"nanoid alphabet", KeyGeneratorNanoid, "abc", 8, `^[abc]{8}$`, ""},
+		{"base32", KeyGeneratorBase32, "", 0, `^[2-9a-km-np-z]{12}$`, ""},
+		{"base32 length", KeyGeneratorBase32, "", 6, `^[2-9a-km-np-z]{6}$`, ""},
+		{"words", KeyGeneratorWords, "", 0, `^[a-z]+-[a-z]+-[0-9]{2}$`, ""},
+		{"words digits", KeyGeneratorWords, "", 4, `^[a-z]+-[a-z]+-[0-9]{4}$`, ""},
+		{"unknown", "uuid", "", 0, "", "invalid key generator (must be one of nanoid,base32,words): uuid"},
+		{"negative length", KeyGeneratorNanoid, "", -1, "", "invalid key length: -1"},
+		{"short alphabet", KeyGeneratorNanoid, "a", 0, "", `invalid key alphabet "a" (must have 2 to 255 characters)`},
+		{"alphabet of another generator", KeyGeneratorBase32, "abc", 0, "", "a key alphabet can only be set for nanoid keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := NewKeyGenerator(tt.generator, tt.alphabet, tt.length)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pattern := regexp.MustCompile(tt.pattern)
+			for i := 0; i < 100; i++ {
+				key, err := generator.Generate()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !pattern.MatchString(key) {
+					t.Fatalf("expected a key matching %s, got %q", tt.pattern, key)
+				}
+			}
+		})
+	}
+}
+
+func TestBase32Alphabet(t *testing.T) {
+	if len(Base32Alphabet) != 32 {
+		t.Errorf("expected 32 characters, got %d", len(Base32Alphabet))
+	}
+	if strings.ContainsAny(Base32Alphabet, "0O1lI") {
+		t.Errorf("expected no ambiguous characters in %q", Base32Alphabet)
+	}
+}
+
+func TestWordGenerator_Words(t *testing.T) {
+	for _, words := range [][]string{keyAdjectives, keyAnimals} {
+		seen := map[string]bool{}
+		for _, word := range words {
+			if seen[word] {
+				t.Errorf("duplicate word %q", word)
+			}
+			seen[word] = true
+			if err := DefaultKeyPolicy.Validate(word); err != nil || strings.ContainsAny(word, "-_") {
+				t.Errorf("word %q can't be part of a key: %v", word, err)
+			}
+		}
+	}
+}
+
+// fixedKeyGenerator always generates the same key.
+type fixedKeyGenerator string
+
+func (g fixedKeyGenerator) Generate() (string, error) {
+	return string(g), nil
+}
+
+func TestGrowKeyGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator KeyGenerator
+		count     int
+		expected  KeyGenerator
+	}{
+		{"sparse", NanoidGenerator{Alphabet: Base32Alphabet, Length: 2}, 1, NanoidGenerator{Alphabet: Base32Alphabet, Length: 2}},
+		{"dense", NanoidGenerator{Alphabet: Base32Alphabet, Length: 2}, 2, NanoidGenerator{Alphabet: Base32Alphabet, Length: 3}},
+		{"very dense", NanoidGenerator{Alphabet: "ab", Length: 1}, 2, NanoidGenerator{Alphabet: "ab", Length: 11}},
+		{"words", WordGenerator{Digits: 0}, 5, WordGenerator{Digits: 1}},
+		{"words sparse", WordGenerator{Digits: 2}, 409, WordGenerator{Digits: 2}},
+		{"unsized", fixedKeyGenerator("abc"), 1000, fixedKeyGenerator("abc")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GrowKeyGenerator(tt.generator, tt.count, 0.001); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules of the key policy, reported by KeyError.
+const (
+	KeyRuleMinLength = "min_length"
+	KeyRuleMaxLength = "max_length"
+	KeyRuleCharset   = "charset"
+	KeyRuleReserved  = "reserved"
+)
+
+// Normalization policies of keys.
+const (
+	KeyNormalizeNone      = "none"      // Keys are kept as they are, "ABC" and "abc" are different keys
+	KeyNormalizeLower     = "lower"     // Keys are lowercased, "ABC" and "abc" are the same key
+	KeyNormalizeCanonical = "canonical" // Keys are case-folded, NFC normalized, and trimmed of trailing punctuation
+)
+
+// Defaults of the key policy. The character set is the one generated keys use.
+const (
+	DefaultKeyCharset   = "A-Za-z0-9_-"
+	DefaultKeyMinLength = 1
+	DefaultKeyMaxLength = 100
+)
+
+// DefaultKeyPolicy is the key policy used where none is configured.
+var DefaultKeyPolicy = mustKeyPolicy(NewKeyPolicy(DefaultKeyCharset, DefaultKeyMinLength, DefaultKeyMaxLength,
+	KeyNormalizeNone, nil))
+
+// KeyPolicy decides which keys redirects may use, and how keys are normalized before they're stored or looked up.
+// A nil *KeyPolicy is the DefaultKeyPolicy.
+type KeyPolicy struct {
+	charset   string
+	pattern   *regexp.Regexp
+	minLength int
+	maxLength int
+	normalize string
+	reserved  map[string]bool
+}
+
+// NewKeyPolicy creates a KeyPolicy allowing keys of minLength to maxLength characters out of charset, a regular
+// expression character class such as "a-z0-9_-". Keys are normalized as per normalize, and the reserved keys are
+// refused regardless of their case.
+func NewKeyPolicy(charset string, minLength int, maxLength int, normalize string, reserved []string) (*KeyPolicy, error) {
+	pattern, err := regexp.Compile("^[" + charset + "]*$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid key charset %q: %w", charset, err)
+	}
+	if minLength < 1 || maxLength < minLength {
+		return nil, fmt.Errorf("invalid key lengths (min %d, max %d)", minLength, maxLength)
+	}
+	switch normalize {
+	case KeyNormalizeNone, KeyNormalizeLower, KeyNormalizeCanonical:
+	default:
+		return nil, fmt.Errorf("invalid key normalization (must be one of %s,%s,%s): %s",
+			KeyNormalizeNone, KeyNormalizeLower, KeyNormalizeCanonical, normalize)
+	}
+
+	p := &KeyPolicy{
+		charset:   charset,
+		pattern:   pattern,
+		minLength: minLength,
+		maxLength: maxLength,
+		normalize: normalize,
+		reserved:  map[string]bool{},
+	}
+	p.Reserve(reserved...)
+	return p, nil
+}
+
+// mustKeyPolicy returns p, and panics if err isn't nil.
+func mustKeyPolicy(p *KeyPolicy, err error) *KeyPolicy {
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Reserve adds keys to the reserved keys. It isn't safe to call while the policy is in use.
+func (p *KeyPolicy) Reserve(keys ...string) {
+	for _, key := range keys {
+		if key != "" {
+			p.reserved[strings.ToLower(key)] = true
+		}
+	}
+}
+
+// Normalize returns key the way it's stored and looked up.
+//
+// Canonical keys are case-folded and NFC normalized, so that "Launch" and "LAUNCH", or an "é" typed as one character
+// or as an "e" and an accent, are the same key. Trailing punctuation that keys can't contain is trimmed too, it comes
+// along when links are copied out of sentences, as in "see lnk.now/launch.".
+func (p *KeyPolicy) Normalize(key string) string {
+	if p == nil {
+		p = DefaultKeyPolicy
+	}
+	switch p.normalize {
+	case KeyNormalizeLower:
+		key = strings.ToLower(key)
+	case KeyNormalizeCanonical:
+		key = norm.NFC.String(cases.Fold().String(norm.NFC.String(key)))
+		key = strings.TrimRightFunc(key, func(r rune) bool {
+			return unicode.IsPunct(r) && !p.pattern.MatchString(string(r))
+		})
+	}
+	return key
+}
+
+// Normalizes reports whether the policy changes keys at all.
+func (p *KeyPolicy) Normalizes() bool {
+	if p == nil {
+		p = DefaultKeyPolicy
+	}
+	return p.normalize != KeyNormalizeNone
+}
+
+// Validate returns a KeyError naming the rule that rejects the normalized key, or nil if the policy allows it.
+func (p *KeyPolicy) Validate(key string) error {
+	if p == nil {
+		p = DefaultKeyPolicy
+	}
+
+	if n := utf8.RuneCountInString(key); n < p.minLength {
+		return NewKeyError(KeyRuleMinLength, fmt.Sprintf("key too short (%d, min %d)", n, p.minLength))
+	} else if n > p.maxLength {
+		return NewKeyError(KeyRuleMaxLength, fmt.Sprintf("key too long (%d, max %d)", n, p.maxLength))
+	}
+
+	// Keys are a single path segment, whatever the charset.
+	if !utf8.ValidString(key) || strings.Contains(key, "/") || !p.pattern.MatchString(key) {
+		for _, r := range key {
+			if r == '/' || r == utf8.RuneError || !p.pattern.MatchString(string(r)) {
+				return NewKeyError(KeyRuleCharset, fmt.Sprintf("%q isn't allowed in keys (allowed: [%s])", r, p.charset))
+			}
+		}
+	}
+
+	if p.reserved[strings.ToLower(key)] {
+		return NewKeyError(KeyRuleReserved, fmt.Sprintf("%q is reserved", key))
+	}
+	return nil
+}
+
+// CheckGenerator returns a KeyError if generator makes keys out of characters that the policy doesn't allow once
+// they're normalized, which would have most generated keys refused. Generators that don't tell their characters are
+// assumed to fit.
+func (p *KeyPolicy) CheckGenerator(generator KeyGenerator) error {
+	if p == nil {
+		p = DefaultKeyPolicy
+	}
+	charset, ok := generator.(CharsetKeyGenerator)
+	if !ok {
+		return nil
+	}
+	for _, r := range charset.Charset() {
+		if c := p.Normalize(string(r)); c == "" || strings.Contains(c, "/") || !p.pattern.MatchString(c) {
+			return NewKeyError(KeyRuleCharset,
+				fmt.Sprintf("generated keys may contain %q, which isn't allowed in keys (allowed: [%s])", r, p.charset))
+		}
+	}
+	return nil
+}
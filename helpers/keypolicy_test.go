@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		charset   string
+		min, max  int
+		normalize string
+		wantErr   string
+	}{
+		{"default", DefaultKeyCharset, 1, 100, KeyNormalizeNone, ""},
+		{"lower", "a-z0-9", 3, 3, KeyNormalizeLower, ""},
+		{"bad charset", "z-a", 1, 100, KeyNormalizeNone, "invalid key charset \"z-a\""},
+		{"no min", DefaultKeyCharset, 0, 100, KeyNormalizeNone, "invalid key lengths (min 0, max 100)"},
+		{"max below min", DefaultKeyCharset, 5, 4, KeyNormalizeNone, "invalid key lengths (min 5, max 4)"},
+		{"bad normalization", DefaultKeyCharset, 1, 100, "upper", "invalid key normalization (must be one of none,lower,canonical): upper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyPolicy(tt.charset, tt.min, tt.max, tt.normalize, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_Validate(t *testing.T) {
+	policy, err := NewKeyPolicy(DefaultKeyCharset, 3, 10, KeyNormalizeNone, []string{"health", "api"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   *KeyPolicy
+		key      string
+		wantRule string
+		wantErr  string
+	}{
+		{"valid", policy, "abc-123_X", "", ""},
+		{"too short", policy, "ab", KeyRuleMinLength, "invalid key: key too short (2, min 3)"},
+		{"too long", policy, "abcdefghijk", KeyRuleMaxLength, "invalid key: key too long (11, max 10)"},
+		{"slash", policy, "a/b/c", KeyRuleCharset, `invalid key: '/' isn't allowed in keys (allowed: [A-Za-z0-9_-])`},
+		{"whitespace", policy, "a b c", KeyRuleCharset, `invalid key: ' ' isn't allowed in keys (allowed: [A-Za-z0-9_-])`},
+		{"confusable", policy, "pаypal", KeyRuleCharset, `invalid key: 'а' isn't allowed in keys (allowed: [A-Za-z0-9_-])`},
+		{"invalid UTF-8", policy, "ab\xffc", KeyRuleCharset, `invalid key: '�' isn't allowed in keys (allowed: [A-Za-z0-9_-])`},
+		{"reserved", policy, "health", KeyRuleReserved, `invalid key: "health" is reserved`},
+		{"reserved in another case", policy, "HEALTH", KeyRuleReserved, `invalid key: "HEALTH" is reserved`},
+		{"nil policy", nil, strings.Repeat("a", 100), "", ""},
+		{"nil policy too long", nil, strings.Repeat("a", 101), KeyRuleMaxLength, "invalid key: key too long (101, max 100)"},
+		{"nil policy charset", nil, "a.b", KeyRuleCharset, `invalid key: '.' isn't allowed in keys (allowed: [A-Za-z0-9_-])`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.key)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var keyErr *KeyError
+			if !errors.As(err, &keyErr) {
+				t.Fatalf("expected a KeyError, got %v", err)
+			}
+			if keyErr.Rule != tt.wantRule {
+				t.Errorf("expected rule %q, got %q", tt.wantRule, keyErr.Rule)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("expected %q, got %q", tt.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_Unicode(t *testing.T) {
+	policy, err := NewKeyPolicy(`\p{L}\p{N}-`, 1, 4, KeyNormalizeNone, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Lengths are in characters, not bytes.
+	if err := policy.Validate("ñandú"); err == nil || err.Error() != "invalid key: key too long (5, max 4)" {
+		t.Errorf("expected the key to be too long, got %v", err)
+	}
+	if err := policy.Validate("日本語"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestKeyPolicy_Normalize(t *testing.T) {
+	lower, err := NewKeyPolicy(DefaultKeyCharset, 1, 100, KeyNormalizeLower, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	canonical, err := NewKeyPolicy(DefaultKeyCharset, 1, 100, KeyNormalizeCanonical, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unicodeCanonical, err := NewKeyPolicy(`\p{L}\p{N}_.-`, 1, 100, KeyNormalizeCanonical, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		policy *KeyPolicy
+		key    string
+		want   string
+	}{
+		{"nil policy", nil, "AbC", "AbC"},
+		{"sensitive", DefaultKeyPolicy, "AbC", "AbC"},
+		{"lower", lower, "AbC", "abc"},
+		{"lower keeps punctuation", lower, "AbC.", "abc."},
+		{"canonical", canonical, "Launch", "launch"},
+		{"canonical folds", canonical, "STRASSE", "strasse"},
+		{"canonical full folding", unicodeCanonical, "Straße", "strasse"},
+		{"canonical composes", unicodeCanonical, "Cafe\u0301", "café"},
+		{"canonical composed", unicodeCanonical, "CAFÉ", "café"},
+		{"canonical trims punctuation", canonical, "launch.", "launch"},
+		{"canonical trims all trailing punctuation", canonical, "launch!?)", "launch"},
+		{"canonical keeps allowed punctuation", canonical, "launch-_", "launch-_"},
+		{"canonical keeps charset punctuation", unicodeCanonical, "v1.2.", "v1.2."},
+		{"canonical keeps inner punctuation", canonical, "a.b", "a.b"},
+		{"canonical keeps trailing symbols", canonical, "a+", "a+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Normalize(tt.key); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_CheckGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		charset   string
+		normalize string
+		generator KeyGenerator
+		wantErr   bool
+	}{
+		{"default", DefaultKeyCharset, KeyNormalizeNone, DefaultKeyGenerator, false},
+		{"base32", "a-z0-9", KeyNormalizeNone, NanoidGenerator{Alphabet: Base32Alphabet, Length: 12}, false},
+		{"words", "a-z0-9-", KeyNormalizeNone, WordGenerator{Digits: 2}, false},
+		{"words without digits", "a-z-", KeyNormalizeNone, WordGenerator{Digits: 0}, false},
+		{"words without hyphens", "a-z0-9", KeyNormalizeNone, WordGenerator{Digits: 2}, true},
+		{"uppercase", "a-z0-9", KeyNormalizeNone, NanoidGenerator{Alphabet: "abcXYZ", Length: 12}, true},
+		{"uppercase lowered", "a-z0-9", KeyNormalizeLower, NanoidGenerator{Alphabet: "abcXYZ", Length: 12}, false},
+		{"trimmed punctuation", DefaultKeyCharset, KeyNormalizeCanonical, NanoidGenerator{Alphabet: "ab.", Length: 12}, true},
+		{"slash", "a-z/", KeyNormalizeNone, NanoidGenerator{Alphabet: "ab/", Length: 12}, true},
+		{"unknown characters", "a-z", KeyNormalizeNone, fixedKeyGenerator("ABC"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewKeyPolicy(tt.charset, 1, 100, tt.normalize, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = p.CheckGenerator(tt.generator)
+			var ke *KeyError
+			if tt.wantErr && (!errors.As(err, &ke) || ke.Rule != KeyRuleCharset) {
+				t.Errorf("expected a charset KeyError, got %v", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -2,43 +2,104 @@ package helpers
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/skip2/go-qrcode"
 )
 
-// QRConfig defines the configuration for generating a QR code, including size, error recovery level, colors, and border.
+// What the QR code of a redirect encodes.
+const (
+	QRContentShort  = "short"  // The short URL, so that scans go through the redirector
+	QRContentTarget = "target" // The destination, so that scans work offline or without the redirector
+)
+
+// QR contrast policies, what happens to QR codes with colors that don't contrast enough to be scanned reliably.
+const (
+	QRContrastReject = "reject" // The QR code is refused
+	QRContrastWarn   = "warn"   // The QR code is rendered, with a warning header
+	QRContrastOff    = "off"    // Contrast isn't checked
+)
+
+var (
+	// QRMinContrast is the lowest WCAG contrast ratio between the colors of the modules and the background that is
+	// considered scannable.
+	QRMinContrast = 3.0
+	// QRContrastPolicy is what happens to QR codes below QRMinContrast.
+	QRContrastPolicy = QRContrastReject
+)
+
+// QRConfig defines the configuration for generating a QR code, including size, error recovery level, colors, border,
+// output format, and whether a logo is overlaid. LogoImage holds the logo to overlay once it has been loaded.
+// Style is the shape of the modules, FinderColor (optional) is the color of the finder patterns, and GradientColor
+// (optional) makes the modules fade from FgColor to it in the GradientDirection. Content is what a redirect's QR code
+// encodes, its short URL or its destination. Verify makes rendering fail if the code can't be read back.
 type QRConfig struct {
-	Size    int
-	Level   qrcode.RecoveryLevel
-	BgColor color.Color
-	FgColor color.Color
-	Border  bool
+	Size              int
+	Level             qrcode.RecoveryLevel
+	BgColor           color.Color
+	FgColor           color.Color
+	Border            bool
+	Format            string
+	Logo              bool
+	LogoImage         image.Image
+	Style             string
+	FinderColor       color.Color
+	GradientColor     color.Color
+	GradientDirection string
+	Content           string
+	Verify            bool
 }
 
-// QRParams defines query parameters for configuring a QR code, including size, error correction level, colors, and border.
+// QRParams defines query parameters (or JSON fields) for configuring a QR code, including size, error correction level,
+// colors, border, output format, and module styling.
 type QRParams struct {
-	Size    int    `form:"size"`
-	Level   string `form:"level"`
-	BgColor string `form:"bg_color"`
-	FgColor string `form:"fg_color"`
-	Border  bool   `form:"border"`
+	Size          int    `form:"size" json:"size,omitempty"`
+	Level         string `form:"level" json:"level,omitempty"`
+	BgColor       string `form:"bg_color" json:"bg_color,omitempty"`
+	FgColor       string `form:"fg_color" json:"fg_color,omitempty"`
+	Border        *bool  `form:"border" json:"border,omitempty"`
+	Format        string `form:"format" json:"format,omitempty"`
+	Logo          bool   `form:"logo" json:"logo,omitempty"`
+	Style         string `form:"style" json:"style,omitempty"`
+	FinderColor   string `form:"finder_color" json:"finder_color,omitempty"`
+	GradientColor string `form:"gradient_color" json:"gradient_color,omitempty"`
+	Gradient      string `form:"gradient" json:"gradient,omitempty"`
+	Content       string `form:"content" json:"content,omitempty"`
+	Verify        *bool  `form:"verify" json:"verify,omitempty"`
 }
 
 // GetQRParamsFromContext extracts QR code configuration from the provided gin.Context query parameters.
 // It returns a QRConfig struct with parsed values and an error if any parsing issue occurs.
 func GetQRParamsFromContext(c *gin.Context) (QRConfig, error) {
-	// Create an empty QRConfig.
-	conf := QRConfig{}
-
 	// Bind the query parameters, return an error if there's any trouble parsing.
 	var params QRParams
 	err := c.ShouldBindQuery(&params)
 	if err != nil {
-		return conf, err
+		return QRConfig{}, err
 	}
+	return ParseQRParams(params)
+}
+
+// QRParamsFromValues binds QR code parameters from query string style values, e.g. a domain's QR defaults.
+func QRParamsFromValues(values map[string]string) (QRParams, error) {
+	form := make(map[string][]string, len(values))
+	for name, value := range values {
+		form[name] = []string{value}
+	}
+	var params QRParams
+	err := binding.MapFormWithTag(&params, form, "form")
+	return params, err
+}
+
+// ParseQRParams validates QR code parameters and returns the QRConfig they describe.
+// It returns a QRConfig struct with parsed values and an error if any parsing issue occurs.
+func ParseQRParams(params QRParams) (QRConfig, error) {
+	// Create an empty QRConfig.
+	conf := QRConfig{}
 
 	// Check for sane Size values.
 	if params.Size == 0 {
@@ -53,7 +114,12 @@ func GetQRParamsFromContext(c *gin.Context) (QRConfig, error) {
 	// Map the QR Levels to L, M, H, or B
 	switch strings.ToUpper(params.Level) {
 	case "":
-		conf.Level = qrcode.Medium
+		// A logo hides part of the code, so it needs more error correction.
+		if params.Logo {
+			conf.Level = qrcode.High
+		} else {
+			conf.Level = qrcode.Medium
+		}
 	case "L":
 		conf.Level = qrcode.Low
 	case "M":
@@ -70,7 +136,7 @@ func GetQRParamsFromContext(c *gin.Context) (QRConfig, error) {
 	if params.BgColor == "" {
 		conf.BgColor = color.White
 	} else {
-		if bgRGBA, err := HexToRGBA(params.BgColor); err == nil {
+		if bgRGBA, err := ParseColor(params.BgColor); err == nil {
 			conf.BgColor = bgRGBA
 		} else {
 			return conf, err
@@ -81,7 +147,7 @@ func GetQRParamsFromContext(c *gin.Context) (QRConfig, error) {
 	if params.FgColor == "" {
 		conf.FgColor = color.Black
 	} else {
-		if fgRGBA, err := HexToRGBA(params.FgColor); err == nil {
+		if fgRGBA, err := ParseColor(params.FgColor); err == nil {
 			conf.FgColor = fgRGBA
 		} else {
 			return conf, err
@@ -89,7 +155,150 @@ func GetQRParamsFromContext(c *gin.Context) (QRConfig, error) {
 	}
 
 	// Set if a border is needed
-	conf.Border = params.Border
+	conf.Border = params.Border != nil && *params.Border
+
+	// Check the output format, fall back to PNG if not specified
+	conf.Format = strings.ToLower(params.Format)
+	if conf.Format == "" {
+		conf.Format = QRFormatPNG
+	} else if _, ok := qrContentTypes[conf.Format]; !ok {
+		return conf, fmt.Errorf("invalid QR format (must be one of png,svg,pdf,eps): %s", params.Format)
+	}
+
+	// Parse the module styling.
+	conf.Style = strings.ToLower(params.Style)
+	switch conf.Style {
+	case "":
+		conf.Style = QRStyleSquare
+	case QRStyleSquare, QRStyleDot, QRStyleRounded:
+	default:
+		return conf, fmt.Errorf("invalid QR style (must be one of square,dot,rounded): %s", params.Style)
+	}
+	if params.FinderColor != "" {
+		finderRGBA, err := ParseColor(params.FinderColor)
+		if err != nil {
+			return conf, err
+		}
+		conf.FinderColor = finderRGBA
+	}
+	if params.GradientColor != "" {
+		gradientRGBA, err := ParseColor(params.GradientColor)
+		if err != nil {
+			return conf, err
+		}
+		conf.GradientColor = gradientRGBA
+		conf.GradientDirection = QRGradientDiagonal
+	}
+	switch direction := strings.ToLower(params.Gradient); direction {
+	case "":
+	case QRGradientHorizontal, QRGradientVertical, QRGradientDiagonal:
+		if conf.GradientColor == nil {
+			return conf, fmt.Errorf("a gradient direction requires a gradient_color")
+		}
+		conf.GradientDirection = direction
+	default:
+		return conf, fmt.Errorf("invalid QR gradient (must be one of horizontal,vertical,diagonal): %s", params.Gradient)
+	}
+	if conf.styled() && conf.Format != QRFormatPNG && conf.Format != QRFormatSVG {
+		return conf, fmt.Errorf("styles, finder colors and gradients are only supported for png and svg: %s", conf.Format)
+	}
+
+	// Make sure that phones can tell the modules from the background.
+	if QRContrastPolicy == QRContrastReject {
+		if err := CheckQRContrast(conf); err != nil {
+			return conf, err
+		}
+	}
+
+	// Styled codes are drawn in full color, which is a lot slower. Keep them to a reasonable size.
+	if conf.styled() {
+		if conf.Size > 2048 {
+			conf.Size = 2048
+		} else if conf.Size < -48 {
+			conf.Size = -48 // This is ~2100px with no border
+		}
+	}
+
+	// Check what the code encodes, fall back to the short URL if not specified
+	switch content := strings.ToLower(params.Content); content {
+	case "":
+		conf.Content = QRContentShort
+	case QRContentShort, QRContentTarget:
+		conf.Content = content
+	default:
+		return conf, fmt.Errorf("invalid QR content (must be one of short,target): %s", params.Content)
+	}
+
+	// Only verify the code if asked to
+	conf.Verify = params.Verify != nil && *params.Verify
+
+	// Logos cover modules, make sure that there's enough error correction to recover them.
+	if params.Logo {
+		if conf.Level < qrcode.High {
+			return conf, fmt.Errorf("invalid QR level for a logo (must be one of H,B): %s", params.Level)
+		}
+		if conf.Format != QRFormatPNG && conf.Format != QRFormatSVG {
+			return conf, fmt.Errorf("logos are only supported for png and svg: %s", conf.Format)
+		}
+		conf.Logo = true
+	}
 
 	return conf, nil
 }
+
+// CheckQRContrast returns an error if any of the colors the modules are drawn with doesn't contrast enough with the
+// background to be scanned reliably. Light-on-dark (inverted) codes are held to the same ratio. Translucent colors are
+// checked as they would look printed on white.
+func CheckQRContrast(conf QRConfig) error {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	bg := flattenColor(straightRGBA(conf.BgColor), white)
+
+	colors := []struct {
+		name  string
+		color color.Color
+	}{
+		{"fg_color", conf.FgColor},
+		{"finder_color", conf.FinderColor},
+		{"gradient_color", conf.GradientColor},
+	}
+	for _, c := range colors {
+		if c.color == nil {
+			continue
+		}
+		fg := flattenColor(straightRGBA(c.color), bg)
+		if ratio := ContrastRatio(fg, bg); ratio < QRMinContrast {
+			return fmt.Errorf("%s doesn't contrast enough with the background to be scanned (%.2f:1, min %.2f:1)",
+				c.name, ratio, QRMinContrast)
+		}
+	}
+	return nil
+}
+
+// straightRGBA returns a color's channels without premultiplied alpha. Colors parsed by ParseColor already are.
+func straightRGBA(c color.Color) color.RGBA {
+	if rgba, ok := c.(color.RGBA); ok {
+		return rgba
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{R: n.R, G: n.G, B: n.B, A: n.A}
+}
+
+// straightNRGBA returns a color as an NRGBA color, which Go's image packages read as straight alpha, unlike the
+// color.RGBA that ParseColor returns.
+func straightNRGBA(c color.Color) color.NRGBA {
+	return color.NRGBA(straightRGBA(c))
+}
+
+// ApplyQueryDefaults adds each of the defaults to the request's query string unless the request already sets it.
+func ApplyQueryDefaults(c *gin.Context, defaults map[string]string) {
+	if len(defaults) == 0 {
+		return
+	}
+	query := c.Request.URL.Query()
+	for name, value := range defaults {
+		if !query.Has(name) {
+			query.Set(name, value)
+		}
+	}
+	c.Request.URL.RawQuery = query.Encode()
+}
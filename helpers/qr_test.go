@@ -3,6 +3,7 @@ package helpers
 import (
 	"image/color"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -20,31 +21,31 @@ func TestGetQRParamsFromContext(t *testing.T) {
 		{
 			name:       "default values",
 			query:      "",
-			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
 			name:       "custom size within range",
 			query:      "size=300",
-			wantConfig: QRConfig{Size: 300, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: 300, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
 			name:       "size below minimum",
 			query:      "size=-200",
-			wantConfig: QRConfig{Size: -164, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: -164, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
 			name:       "size above maximum",
 			query:      "size=5000",
-			wantConfig: QRConfig{Size: 4096, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: 4096, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
 			name:       "level set to Low",
 			query:      "level=L",
-			wantConfig: QRConfig{Size: 256, Level: qrcode.Low, BgColor: color.White, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Low, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
@@ -56,7 +57,7 @@ func TestGetQRParamsFromContext(t *testing.T) {
 		{
 			name:       "custom background color",
 			query:      "bg_color=#ff0000",
-			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.RGBA{R: 255, G: 0, B: 0, A: 255}, FgColor: color.Black, Border: false},
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.RGBA{R: 255, G: 0, B: 0, A: 255}, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 		{
@@ -68,9 +69,33 @@ func TestGetQRParamsFromContext(t *testing.T) {
 		{
 			name:       "custom foreground color",
 			query:      "fg_color=#00ff00",
-			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.RGBA{R: 0, G: 255, B: 0, A: 255}, Border: false},
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.RGBA{R: 0, G: 255, B: 0, A: 255}, Border: false, Format: QRFormatPNG, Style: QRStyleSquare},
+			wantErr:    "fg_color doesn't contrast enough with the background to be scanned (1.37:1, min 3.00:1)",
+		},
+		{
+			name:       "dark foreground color",
+			query:      "fg_color=#006400",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.RGBA{R: 0, G: 100, B: 0, A: 255}, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "css colors",
+			query:      "fg_color=LightYellow&bg_color=rgb(0,0,128)&finder_color=hsl(60,100%25,50%25)",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.RGBA{B: 128, A: 255}, FgColor: color.RGBA{R: 255, G: 255, B: 224, A: 255}, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, FinderColor: color.RGBA{R: 255, G: 255, A: 255}, Content: QRContentShort},
 			wantErr:    "",
 		},
+		{
+			name:       "inverted low contrast",
+			query:      "fg_color=silver&bg_color=gray",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.RGBA{R: 128, G: 128, B: 128, A: 255}, FgColor: color.RGBA{R: 192, G: 192, B: 192, A: 255}, Border: false, Format: QRFormatPNG, Style: QRStyleSquare},
+			wantErr:    "fg_color doesn't contrast enough with the background to be scanned",
+		},
+		{
+			name:       "low contrast finder",
+			query:      "finder_color=whitesmoke",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, FinderColor: color.RGBA{R: 245, G: 245, B: 245, A: 255}},
+			wantErr:    "finder_color doesn't contrast enough",
+		},
 		{
 			name:       "invalid foreground color",
 			query:      "fg_color=#12345g",
@@ -80,13 +105,103 @@ func TestGetQRParamsFromContext(t *testing.T) {
 		{
 			name:       "border enabled",
 			query:      "border=true",
-			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true},
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "svg format",
+			query:      "format=SVG",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatSVG, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "invalid format",
+			query:      "format=gif",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: "gif"},
+			wantErr:    "invalid QR format (must be one of png,svg,pdf,eps): gif",
+		},
+		{
+			name:       "logo defaults to high level",
+			query:      "logo=true",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.High, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Logo: true, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "logo with low level",
+			query:      "logo=true&level=M",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "invalid QR level for a logo (must be one of H,B): M",
+		},
+		{
+			name:       "logo with pdf format",
+			query:      "logo=true&format=pdf",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.High, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPDF, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "logos are only supported for png and svg: pdf",
+		},
+		{
+			name:       "transparent background",
+			query:      "bg_color=transparent",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.RGBA{}, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "styled modules",
+			query:      "style=Dot&finder_color=#f00&gradient_color=#00f&gradient=vertical",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleDot, FinderColor: color.RGBA{R: 255, A: 255}, GradientColor: color.RGBA{B: 255, A: 255}, GradientDirection: QRGradientVertical, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "gradient defaults to diagonal",
+			query:      "gradient_color=#00f",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, GradientColor: color.RGBA{B: 255, A: 255}, GradientDirection: QRGradientDiagonal, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "styled size above maximum",
+			query:      "size=4096&style=rounded",
+			wantConfig: QRConfig{Size: 2048, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleRounded, Content: QRContentShort},
+			wantErr:    "",
+		},
+		{
+			name:       "invalid style",
+			query:      "style=star",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: "star"},
+			wantErr:    "invalid QR style (must be one of square,dot,rounded): star",
+		},
+		{
+			name:       "gradient without a color",
+			query:      "gradient=vertical",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare},
+			wantErr:    "a gradient direction requires a gradient_color",
+		},
+		{
+			name:       "styled pdf",
+			query:      "style=rounded&format=pdf",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPDF, Style: QRStyleRounded},
+			wantErr:    "styles, finder colors and gradients are only supported for png and svg: pdf",
+		},
+		{
+			name:       "target content",
+			query:      "content=target",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentTarget},
+			wantErr:    "",
+		},
+		{
+			name:       "invalid content",
+			query:      "content=both",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare},
+			wantErr:    "invalid QR content (must be one of short,target): both",
+		},
+		{
+			name:       "verify",
+			query:      "verify=true",
+			wantConfig: QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: false, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort, Verify: true},
 			wantErr:    "",
 		},
 		{
 			name:       "multiple parameters",
 			query:      "size=512&level=H&fg_color=#0000ff&bg_color=#ffffff&border=true",
-			wantConfig: QRConfig{Size: 512, Level: qrcode.High, BgColor: color.RGBA{R: 255, G: 255, B: 255, A: 255}, FgColor: color.RGBA{R: 0, G: 0, B: 255, A: 255}, Border: true},
+			wantConfig: QRConfig{Size: 512, Level: qrcode.High, BgColor: color.RGBA{R: 255, G: 255, B: 255, A: 255}, FgColor: color.RGBA{R: 0, G: 0, B: 255, A: 255}, Border: true, Format: QRFormatPNG, Style: QRStyleSquare, Content: QRContentShort},
 			wantErr:    "",
 		},
 	}
@@ -108,3 +223,54 @@ func TestGetQRParamsFromContext(t *testing.T) {
 		})
 	}
 }
+
+func TestQRParamsFromValues(t *testing.T) {
+	params, err := QRParamsFromValues(map[string]string{"size": "512", "border": "true", "fg_color": "#f00"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	border := true
+	want := QRParams{Size: 512, Border: &border, FgColor: "#f00"}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("expected params: %+v, got: %+v", want, params)
+	}
+
+	if _, err := QRParamsFromValues(map[string]string{"size": "big"}); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestCheckQRContrast(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    QRConfig
+		wantErr bool
+	}{
+		{"black on white", QRConfig{BgColor: color.White, FgColor: color.Black}, false},
+		{"white on black", QRConfig{BgColor: color.Black, FgColor: color.White}, false},
+		{"transparent background", QRConfig{BgColor: color.RGBA{}, FgColor: color.Black}, false},
+		{"white on transparent", QRConfig{BgColor: color.RGBA{}, FgColor: color.White}, true},
+		{"translucent foreground", QRConfig{BgColor: color.White, FgColor: color.RGBA{A: 40}}, true},
+		{"light gradient", QRConfig{BgColor: color.White, FgColor: color.Black, GradientColor: color.RGBA{R: 255, G: 255, A: 255}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckQRContrast(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("CheckQRContrast() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("warn policy", func(t *testing.T) {
+		QRContrastPolicy = QRContrastWarn
+		defer func() { QRContrastPolicy = QRContrastReject }()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/?fg_color=white", nil)
+		if _, err := GetQRParamsFromContext(c); err != nil {
+			t.Errorf("expected low contrast to be allowed, got %v", err)
+		}
+	})
+}
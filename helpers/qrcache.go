@@ -0,0 +1,213 @@
+package helpers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/thedeltaflyer/redirector/logging"
+)
+
+// qrCacheExt is the extension of the files of an on-disk QRCache, only files with it are ever removed from its directory.
+const qrCacheExt = ".qr"
+
+// QRCacheEntry is a rendered QR code.
+type QRCacheEntry struct {
+	Data        []byte
+	ContentType string
+}
+
+// qrCacheItem is an entry of the cache's LRU list. Data is only kept in memory if the cache has no directory.
+type qrCacheItem struct {
+	key   string
+	tag   string
+	size  int64
+	entry QRCacheEntry
+}
+
+// QRCache is a bounded LRU cache of rendered QR codes, keyed by QRCacheKey.
+// Entries are held in memory, or written to Dir if it is set, in which case only their index is kept in memory.
+// Entries are tagged (e.g. with the redirect they were rendered for) so that they can be dropped together.
+// A nil *QRCache caches nothing.
+type QRCache struct {
+	maxEntries int
+	maxBytes   int64
+	dir        string
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+	bytes int64
+}
+
+// NewQRCache creates a cache of up to maxEntries entries and maxBytes bytes of rendered images.
+// If dir is not empty, images are stored in it instead of in memory. Files left in it by a previous run are removed.
+func NewQRCache(maxEntries int, maxBytes int64, dir string) (*QRCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		stale, err := filepath.Glob(filepath.Join(dir, "*"+qrCacheExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range stale {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &QRCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		dir:        dir,
+		lru:        list.New(),
+		items:      map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+	}, nil
+}
+
+// QRCacheKey returns the cache key of a QR code encoding content, rendered with conf. versions are any other inputs
+// the image depends on (e.g. the stored redirect and the logo), so that changing them changes the key.
+// Verified codes have their own keys, so that a cached code is known to have been verified if it had to be.
+func QRCacheKey(content string, conf QRConfig, versions ...[]byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n%d|%d|%s|%s|%t|%s|%t|%s|%s|%s|%s|%s|%t\n", content, conf.Size, conf.Level,
+		cacheColor(conf.BgColor), cacheColor(conf.FgColor), conf.Border, strings.ToLower(conf.Format), conf.Logo,
+		conf.Style, cacheColor(conf.FinderColor), cacheColor(conf.GradientColor), conf.GradientDirection, conf.Content,
+		conf.Verify)
+	for _, version := range versions {
+		fmt.Fprintf(h, "%d:", len(version))
+		h.Write(version)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// QRETag returns the strong ETag of the QR code with the given cache key.
+func QRETag(key string) string {
+	return `"` + key[:32] + `"`
+}
+
+// cacheColor normalizes a color so that equal colors of different types have the same key.
+func cacheColor(c color.Color) string {
+	if c == nil {
+		return "-"
+	}
+	n := straightNRGBA(c)
+	return fmt.Sprintf("%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// Get returns the entry cached for key, if any.
+func (c *QRCache) Get(key string) (QRCacheEntry, bool) {
+	if c == nil {
+		return QRCacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	element, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return QRCacheEntry{}, false
+	}
+	c.lru.MoveToFront(element)
+	item := element.Value.(*qrCacheItem)
+	entry := item.entry
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return entry, true
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return QRCacheEntry{}, false
+	}
+	entry.Data = data
+	return entry, true
+}
+
+// Add caches entry under key, tagged with tag. The least recently used entries are evicted to stay within bounds, and
+// entries larger than the whole cache aren't cached at all.
+func (c *QRCache) Add(tag string, key string, entry QRCacheEntry) {
+	size := int64(len(entry.Data))
+	if c == nil || c.maxEntries <= 0 || size > c.maxBytes {
+		return
+	}
+
+	item := &qrCacheItem{key: key, tag: tag, size: size, entry: entry}
+	if c.dir != "" {
+		if err := os.WriteFile(c.path(key), entry.Data, 0600); err != nil {
+			logging.GetLogger().Error(err)
+			return
+		}
+		item.entry.Data = nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element, false)
+	}
+	c.items[key] = c.lru.PushFront(item)
+	if c.tags[tag] == nil {
+		c.tags[tag] = map[string]struct{}{}
+	}
+	c.tags[tag][key] = struct{}{}
+	c.bytes += size
+
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back(), true)
+	}
+}
+
+// Invalidate drops every entry tagged with tag.
+func (c *QRCache) Invalidate(tag string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.tags[tag] {
+		c.remove(c.items[key], true)
+	}
+}
+
+// Len returns the number of cached entries.
+func (c *QRCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// remove drops an element from the cache, and its file if deleteFile is set. The lock must be held.
+func (c *QRCache) remove(element *list.Element, deleteFile bool) {
+	item := element.Value.(*qrCacheItem)
+	c.lru.Remove(element)
+	delete(c.items, item.key)
+	delete(c.tags[item.tag], item.key)
+	if len(c.tags[item.tag]) == 0 {
+		delete(c.tags, item.tag)
+	}
+	c.bytes -= item.size
+
+	if deleteFile && c.dir != "" {
+		if err := os.Remove(c.path(item.key)); err != nil && !os.IsNotExist(err) {
+			logging.GetLogger().Error(err)
+		}
+	}
+}
+
+// path returns the file an entry is stored in.
+func (c *QRCache) path(key string) string {
+	return filepath.Join(c.dir, key+qrCacheExt)
+}
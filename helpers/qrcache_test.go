@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestQRCacheKey(t *testing.T) {
+	conf := QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Format: QRFormatPNG}
+	key := QRCacheKey("https://lnk.now/abc", conf, []byte("v1"))
+
+	// Equal colors of different types share a key.
+	same := conf
+	same.BgColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	if got := QRCacheKey("https://lnk.now/abc", same, []byte("v1")); got != key {
+		t.Errorf("expected equal configurations to have the same key")
+	}
+	translucent, straight := conf, conf
+	translucent.FgColor = color.RGBA{R: 200, A: 128}
+	straight.FgColor = color.NRGBA{R: 200, A: 128}
+	if QRCacheKey("https://lnk.now/abc", translucent, []byte("v1")) !=
+		QRCacheKey("https://lnk.now/abc", straight, []byte("v1")) {
+		t.Errorf("expected parsed translucent colors to be read as straight alpha")
+	}
+
+	changed := conf
+	changed.Size = 512
+	for name, other := range map[string]string{
+		"content": QRCacheKey("https://lnk.now/abd", conf, []byte("v1")),
+		"config":  QRCacheKey("https://lnk.now/abc", changed, []byte("v1")),
+		"version": QRCacheKey("https://lnk.now/abc", conf, []byte("v2")),
+		"split":   QRCacheKey("https://lnk.now/abc", conf, []byte("v"), []byte("1")),
+	} {
+		if other == key {
+			t.Errorf("expected a different %s to change the key", name)
+		}
+	}
+
+	if etag := QRETag(key); len(etag) != 34 || etag[0] != '"' || etag[33] != '"' {
+		t.Errorf("expected a quoted strong ETag, got %s", etag)
+	}
+}
+
+func TestQRCache(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		name := "memory"
+		if dir != "" {
+			name = "disk"
+		}
+		t.Run(name, func(t *testing.T) {
+			cache, err := NewQRCache(2, 10, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cache.Add("/a", "k1", QRCacheEntry{Data: []byte("1234"), ContentType: "image/png"})
+			entry, ok := cache.Get("k1")
+			if !ok || !bytes.Equal(entry.Data, []byte("1234")) || entry.ContentType != "image/png" {
+				t.Fatalf("expected k1 to be cached, got %v %v", entry, ok)
+			}
+
+			// Entries are evicted by count, least recently used first.
+			cache.Add("/b", "k2", QRCacheEntry{Data: []byte("12")})
+			cache.Get("k1")
+			cache.Add("/b", "k3", QRCacheEntry{Data: []byte("12")})
+			if _, ok := cache.Get("k2"); ok {
+				t.Error("expected k2 to be evicted")
+			}
+			if _, ok := cache.Get("k1"); !ok {
+				t.Error("expected k1 to still be cached")
+			}
+
+			// And by size.
+			cache.Add("/c", "k4", QRCacheEntry{Data: []byte("123456789")})
+			if cache.Len() != 1 {
+				t.Errorf("expected 1 entry, got %d", cache.Len())
+			}
+
+			// Entries larger than the cache aren't cached.
+			cache.Add("/c", "k5", QRCacheEntry{Data: []byte("12345678901")})
+			if _, ok := cache.Get("k5"); ok {
+				t.Error("expected k5 not to be cached")
+			}
+
+			cache.Invalidate("/c")
+			if cache.Len() != 0 {
+				t.Errorf("expected an empty cache, got %d entries", cache.Len())
+			}
+			if dir != "" {
+				files, _ := filepath.Glob(filepath.Join(dir, "*"+qrCacheExt))
+				if len(files) != 0 {
+					t.Errorf("expected the files to be removed, got %v", files)
+				}
+			}
+		})
+	}
+
+	t.Run("stale files", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "old"+qrCacheExt), []byte("x"), 0600)
+		_ = os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("x"), 0600)
+		if _, err := NewQRCache(1, 1, dir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old"+qrCacheExt)); !os.IsNotExist(err) {
+			t.Error("expected the stale entry to be removed")
+		}
+		if _, err := os.Stat(filepath.Join(dir, "keep.txt")); err != nil {
+			t.Error("expected other files to be kept")
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var cache *QRCache
+		cache.Add("/a", "k1", QRCacheEntry{Data: []byte("1")})
+		if _, ok := cache.Get("k1"); ok {
+			t.Error("expected a nil cache to cache nothing")
+		}
+		cache.Invalidate("/a")
+	})
+}
@@ -0,0 +1,144 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // Register GIF decoding for logos
+	_ "image/jpeg" // Register JPEG decoding for logos
+	"image/png"
+	"math"
+)
+
+const (
+	// QRLogoMaxBytes is the largest logo upload accepted.
+	QRLogoMaxBytes = 1 << 20
+	// QRLogoMaxDimension is the largest width or height of an accepted logo.
+	QRLogoMaxDimension = 2048
+	// qrLogoArea is the fraction of the QR symbol's area (excluding the border) that a logo, padding included, may
+	// cover. This stays well within what High error correction can recover.
+	qrLogoArea = 0.06
+)
+
+// DecodeLogo decodes and validates an uploaded logo image (PNG, JPEG, or GIF).
+func DecodeLogo(data []byte) (image.Image, error) {
+	if len(data) > QRLogoMaxBytes {
+		return nil, fmt.Errorf("logo too large (%d bytes, max %d)", len(data), QRLogoMaxBytes)
+	}
+	// Check the dimensions the header declares before decoding, a small file can declare a huge image.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo image: %w", err)
+	}
+	if config.Width > QRLogoMaxDimension || config.Height > QRLogoMaxDimension {
+		return nil, fmt.Errorf("logo dimensions too large (%dx%d %s, max %d)", config.Width, config.Height, format, QRLogoMaxDimension)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo image: %w", err)
+	}
+	return img, nil
+}
+
+// qrLogoBox returns the square, centered on a symbol of symbolSize units, that a logo may be placed in.
+// The first value is the offset of the box from the symbol's top-left corner and the second its side.
+func qrLogoBox(symbolSize float64) (float64, float64) {
+	side := symbolSize * math.Sqrt(qrLogoArea)
+	return (symbolSize - side) / 2, side
+}
+
+// fitLogo returns the size of logo scaled to fit within a square of side units, keeping its aspect ratio.
+func fitLogo(logo image.Image, side float64) (float64, float64) {
+	bounds := logo.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	scale := side / math.Max(w, h)
+	return w * scale, h * scale
+}
+
+// overlayLogo draws logo in the center of img on a padded square of the background color.
+// quiet is the width of the border around the symbol, in pixels.
+func overlayLogo(img draw.Image, logo image.Image, quiet float64, bg color.Color) {
+	bounds := img.Bounds()
+	symbol := float64(bounds.Dx()) - 2*quiet
+	offset, side := qrLogoBox(symbol)
+	origin := quiet + offset
+
+	// Clear the area behind the logo, so modules don't show through transparent pixels.
+	pad := image.Rect(int(origin), int(origin), int(math.Ceil(origin+side)), int(math.Ceil(origin+side)))
+	draw.Draw(img, pad, image.NewUniform(straightNRGBA(bg)), image.Point{}, draw.Src)
+
+	// Leave a small margin between the logo and the modules around it.
+	inner := side * 0.85
+	w, h := fitLogo(logo, inner)
+	x := origin + (side-w)/2
+	y := origin + (side-h)/2
+	scaled := scaleImage(logo, int(math.Round(w)), int(math.Round(h)))
+	target := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x))+scaled.Bounds().Dx(), int(math.Round(y))+scaled.Bounds().Dy())
+	draw.Draw(img, target, scaled, image.Point{}, draw.Over)
+}
+
+// svgLogo returns an SVG image element drawing logo in the center of a symbol of modules units, offset by quiet modules,
+// on a padded square of the background color.
+func svgLogo(logo image.Image, modules int, quiet int, bg color.Color) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, logo); err != nil {
+		return "", err
+	}
+
+	symbol := float64(modules - 2*quiet)
+	offset, side := qrLogoBox(symbol)
+	origin := float64(quiet) + offset
+	w, h := fitLogo(logo, side*0.85)
+
+	return fmt.Sprintf(`<rect x="%s" y="%s" width="%s" height="%s" %s/>`+"\n"+
+		`<image x="%s" y="%s" width="%s" height="%s" href="data:image/png;base64,%s"/>`+"\n",
+		formatFloat(origin), formatFloat(origin), formatFloat(side), formatFloat(side), svgFill(bg),
+		formatFloat(origin+(side-w)/2), formatFloat(origin+(side-h)/2), formatFloat(w), formatFloat(h),
+		base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// scaleImage resizes src to w x h pixels, averaging the source pixels covered by each destination pixel.
+func scaleImage(src image.Image, w int, h int) *image.RGBA {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	bounds := src.Bounds()
+	sx := float64(bounds.Dx()) / float64(w)
+	sy := float64(bounds.Dy()) / float64(h)
+
+	for y := 0; y < h; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*sy)
+		y1 := max(bounds.Min.Y+int(float64(y+1)*sy), y0+1)
+		for x := 0; x < w; x++ {
+			x0 := bounds.Min.X + int(float64(x)*sx)
+			x1 := max(bounds.Min.X+int(float64(x+1)*sx), x0+1)
+
+			// Average the (premultiplied) source pixels.
+			var r, g, b, a, n uint64
+			for yy := y0; yy < y1 && yy < bounds.Max.Y; yy++ {
+				for xx := x0; xx < x1 && xx < bounds.Max.X; xx++ {
+					cr, cg, cb, ca := src.At(xx, yy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,128 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// encodeTestLogo returns a w x h PNG filled with c.
+func encodeTestLogo(t *testing.T, w int, h int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode logo: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// declareLogoSize rewrites the header of the PNG data to declare a w x h image, without the pixels to go with it.
+func declareLogoSize(t *testing.T, data []byte, w uint32, h uint32) []byte {
+	t.Helper()
+	data = bytes.Clone(data)
+	if string(data[12:16]) != "IHDR" {
+		t.Fatal("expected the PNG to start with an IHDR chunk")
+	}
+	binary.BigEndian.PutUint32(data[16:20], w)
+	binary.BigEndian.PutUint32(data[20:24], h)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestDecodeLogo(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "valid png", data: encodeTestLogo(t, 40, 20, color.RGBA{R: 255, A: 255})},
+		{name: "not an image", data: []byte("hello"), wantErr: "invalid logo image"},
+		{name: "too many bytes", data: make([]byte, QRLogoMaxBytes+1), wantErr: "logo too large"},
+		{name: "too wide", data: encodeTestLogo(t, QRLogoMaxDimension+1, 1, color.Black), wantErr: "logo dimensions too large"},
+		{name: "declared too large", data: declareLogoSize(t, encodeTestLogo(t, 1, 1, color.Black), 60000, 60000),
+			wantErr: "logo dimensions too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeLogo(tt.data)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if img == nil {
+					t.Fatal("expected an image")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		// Left half black, right half white.
+		c := color.RGBA{A: 255}
+		if x >= 2 {
+			c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		}
+		src.Set(x, 0, c)
+		src.Set(x, 1, c)
+	}
+
+	dst := scaleImage(src, 2, 1)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("expected a 2x1 image, got %v", dst.Bounds())
+	}
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{A: 255}) {
+		t.Errorf("expected black, got %v", got)
+	}
+	if got := dst.RGBAAt(1, 0); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("expected white, got %v", got)
+	}
+
+	if dst := scaleImage(src, 0, 0); dst.Bounds().Dx() != 1 || dst.Bounds().Dy() != 1 {
+		t.Errorf("expected a 1x1 image, got %v", dst.Bounds())
+	}
+}
+
+func TestOverlayLogo(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	red := color.RGBA{R: 255, A: 255}
+	overlayLogo(img, image.NewRGBA(image.Rect(0, 0, 10, 10)), 0, color.White)
+
+	// The center is cleared to the background color, even behind transparent logo pixels.
+	if got := img.RGBAAt(50, 50); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("expected the background in the center, got %v", got)
+	}
+	// Corners are untouched.
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("expected the corner to be untouched, got %v", got)
+	}
+
+	square := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			square.Set(x, y, red)
+		}
+	}
+	overlayLogo(img, square, 0, color.White)
+	if got := img.RGBAAt(50, 50); got != red {
+		t.Errorf("expected the logo in the center, got %v", got)
+	}
+}
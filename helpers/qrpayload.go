@@ -0,0 +1,184 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Supported types of structured QR code payloads.
+const (
+	QRPayloadVCard  = "vcard"
+	QRPayloadWiFi   = "wifi"
+	QRPayloadMailto = "mailto"
+	QRPayloadGeo    = "geo"
+)
+
+// QRPayload is a structured, non-URL QR code payload. Type selects which of the other fields is encoded.
+type QRPayload struct {
+	Type   string         `json:"type" binding:"required,oneof=vcard wifi mailto geo"`
+	VCard  *VCardPayload  `json:"vcard"`
+	WiFi   *WiFiPayload   `json:"wifi"`
+	Mailto *MailtoPayload `json:"mailto"`
+	Geo    *GeoPayload    `json:"geo"`
+}
+
+// VCardPayload is a contact card. At least one of the names or the organization is required.
+type VCardPayload struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Organization string `json:"organization"`
+	Title        string `json:"title"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email" binding:"omitempty,email"`
+	URL          string `json:"url" binding:"omitempty,url"`
+	Address      string `json:"address"`
+	Note         string `json:"note"`
+}
+
+// WiFiPayload is a network to join. Security defaults to WPA if there's a password, and no security otherwise.
+type WiFiPayload struct {
+	SSID     string `json:"ssid" binding:"required"`
+	Password string `json:"password"`
+	Security string `json:"security" binding:"omitempty,oneof=WPA WEP nopass"`
+	Hidden   bool   `json:"hidden"`
+}
+
+// MailtoPayload is an email to write.
+type MailtoPayload struct {
+	To      string `json:"to" binding:"required,email"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// GeoPayload is a location. Pointers tell a missing coordinate from 0.
+type GeoPayload struct {
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// Encode returns the text the payload is encoded as in a QR code.
+func (p *QRPayload) Encode() (string, error) {
+	switch p.Type {
+	case QRPayloadVCard:
+		if p.VCard == nil {
+			return "", fmt.Errorf("missing vcard payload")
+		}
+		return p.VCard.Encode()
+	case QRPayloadWiFi:
+		if p.WiFi == nil {
+			return "", fmt.Errorf("missing wifi payload")
+		}
+		return p.WiFi.Encode(), nil
+	case QRPayloadMailto:
+		if p.Mailto == nil {
+			return "", fmt.Errorf("missing mailto payload")
+		}
+		return p.Mailto.Encode(), nil
+	case QRPayloadGeo:
+		if p.Geo == nil {
+			return "", fmt.Errorf("missing geo payload")
+		}
+		return p.Geo.Encode(), nil
+	default:
+		return "", fmt.Errorf("invalid QR payload type (must be one of vcard,wifi,mailto,geo): %s", p.Type)
+	}
+}
+
+// Encode returns the contact as a vCard 3.0.
+func (v *VCardPayload) Encode() (string, error) {
+	if v.FirstName == "" && v.LastName == "" && v.Organization == "" {
+		return "", fmt.Errorf("a vcard needs a name or an organization")
+	}
+
+	fullName := strings.TrimSpace(v.FirstName + " " + v.LastName)
+	if fullName == "" {
+		fullName = v.Organization
+	}
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"N:" + escapeVCard(v.LastName) + ";" + escapeVCard(v.FirstName) + ";;;",
+		"FN:" + escapeVCard(fullName),
+	}
+	optional := []struct{ name, value string }{
+		{"ORG", v.Organization},
+		{"TITLE", v.Title},
+		{"TEL", v.Phone},
+		{"EMAIL", v.Email},
+		{"URL", v.URL},
+		{"ADR", v.Address},
+		{"NOTE", v.Note},
+	}
+	for _, field := range optional {
+		if field.value == "" {
+			continue
+		}
+		value := escapeVCard(field.value)
+		if field.name == "ADR" {
+			// The whole address goes in the street component.
+			value = ";;" + value + ";;;;"
+		}
+		lines = append(lines, field.name+":"+value)
+	}
+	lines = append(lines, "END:VCARD")
+	return strings.Join(lines, "\r\n"), nil
+}
+
+// Encode returns the network in the "WIFI:" format understood by phone cameras.
+func (w *WiFiPayload) Encode() string {
+	security := w.Security
+	if security == "" {
+		security = "nopass"
+		if w.Password != "" {
+			security = "WPA"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "WIFI:T:%s;S:%s;", security, escapeWiFi(w.SSID))
+	if security != "nopass" {
+		fmt.Fprintf(&b, "P:%s;", escapeWiFi(w.Password))
+	}
+	if w.Hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
+// Encode returns the email as a "mailto:" URI.
+func (m *MailtoPayload) Encode() string {
+	var query []string
+	if m.Subject != "" {
+		query = append(query, "subject="+EscapeTemplateValue(m.Subject))
+	}
+	if m.Body != "" {
+		query = append(query, "body="+EscapeTemplateValue(m.Body))
+	}
+	uri := "mailto:" + m.To
+	if len(query) > 0 {
+		uri += "?" + strings.Join(query, "&")
+	}
+	return uri
+}
+
+// Encode returns the location as a "geo:" URI.
+func (g *GeoPayload) Encode() string {
+	return "geo:" + strconv.FormatFloat(*g.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(*g.Longitude, 'f', -1, 64)
+}
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+// escapeVCard escapes the characters that have a meaning in vCard values.
+func escapeVCard(value string) string {
+	return vCardEscaper.Replace(value)
+}
+
+var wifiEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, ":", `\:`, `"`, `\"`)
+
+// escapeWiFi escapes the characters that have a meaning in "WIFI:" values.
+func escapeWiFi(value string) string {
+	return wifiEscaper.Replace(value)
+}
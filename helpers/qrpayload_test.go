@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQRPayloadEncode(t *testing.T) {
+	lat, lon := 37.786971, -122.399677
+
+	tests := []struct {
+		name    string
+		payload QRPayload
+		want    string
+		wantErr string
+	}{
+		{
+			name: "vcard",
+			payload: QRPayload{Type: QRPayloadVCard, VCard: &VCardPayload{
+				FirstName: "Ada", LastName: "Lovelace", Organization: "Analytical, Inc.", Phone: "+44 20 1234",
+				Address: "12 St James's Square; London",
+			}},
+			want: "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Lovelace;Ada;;;\r\nFN:Ada Lovelace\r\nORG:Analytical\\, Inc.\r\n" +
+				"TEL:+44 20 1234\r\nADR:;;12 St James's Square\\; London;;;;\r\nEND:VCARD",
+		},
+		{
+			name:    "vcard organization",
+			payload: QRPayload{Type: QRPayloadVCard, VCard: &VCardPayload{Organization: "ACME"}},
+			want:    "BEGIN:VCARD\r\nVERSION:3.0\r\nN:;;;;\r\nFN:ACME\r\nORG:ACME\r\nEND:VCARD",
+		},
+		{
+			name:    "vcard without a name",
+			payload: QRPayload{Type: QRPayloadVCard, VCard: &VCardPayload{Phone: "123"}},
+			wantErr: "a vcard needs a name or an organization",
+		},
+		{
+			name:    "wifi",
+			payload: QRPayload{Type: QRPayloadWiFi, WiFi: &WiFiPayload{SSID: `Cafe;"Free"`, Password: "p:ss", Hidden: true}},
+			want:    `WIFI:T:WPA;S:Cafe\;\"Free\";P:p\:ss;H:true;;`,
+		},
+		{
+			name:    "open wifi",
+			payload: QRPayload{Type: QRPayloadWiFi, WiFi: &WiFiPayload{SSID: "Guest"}},
+			want:    "WIFI:T:nopass;S:Guest;;",
+		},
+		{
+			name:    "mailto",
+			payload: QRPayload{Type: QRPayloadMailto, Mailto: &MailtoPayload{To: "hi@example.com", Subject: "Hello there", Body: "a&b"}},
+			want:    "mailto:hi@example.com?subject=Hello%20there&body=a%26b",
+		},
+		{
+			name:    "geo",
+			payload: QRPayload{Type: QRPayloadGeo, Geo: &GeoPayload{Latitude: &lat, Longitude: &lon}},
+			want:    "geo:37.786971,-122.399677",
+		},
+		{
+			name:    "missing payload",
+			payload: QRPayload{Type: QRPayloadGeo},
+			wantErr: "missing geo payload",
+		},
+		{
+			name:    "invalid type",
+			payload: QRPayload{Type: "sms"},
+			wantErr: "invalid QR payload type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.payload.Encode()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Supported QR code output formats.
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+	QRFormatPDF = "pdf"
+	QRFormatEPS = "eps"
+)
+
+// qrContentTypes maps every supported output format to its Content-Type.
+var qrContentTypes = map[string]string{
+	QRFormatPNG: "image/png",
+	QRFormatSVG: "image/svg+xml",
+	QRFormatPDF: "application/pdf",
+	QRFormatEPS: "application/postscript",
+}
+
+// qrRect is a horizontal run of dark modules, in module coordinates.
+type qrRect struct {
+	X, Y, W int
+}
+
+// RenderQR encodes content as a QR code using conf and renders it in the configured format.
+// It returns the rendered image along with its Content-Type. If conf.Verify is set, an UnscannableError is returned
+// instead if the image can't be scanned.
+func RenderQR(content string, conf QRConfig) ([]byte, string, error) {
+	// Create a QR Code struct
+	qrCode, err := qrcode.New(content, conf.Level)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Apply possible configurations to the QR Code
+	qrCode.DisableBorder = !conf.Border
+	qrCode.BackgroundColor = conf.BgColor
+	qrCode.ForegroundColor = conf.FgColor
+
+	// Vector formats are drawn from the same modules as the raster image, so that's what gets verified for them.
+	bitmap := qrCode.Bitmap()
+	var img draw.Image
+	if conf.Verify || conf.Format == QRFormatPNG || conf.Format == "" {
+		img = rasterQR(bitmap, conf)
+	}
+	if conf.Verify {
+		if err := verifyQR(img, bitmap, content, conf); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var data []byte
+	switch conf.Format {
+	case QRFormatPNG, "":
+		data, err = encodePNG(img)
+	case QRFormatSVG:
+		data, err = renderSVG(bitmap, conf)
+	case QRFormatPDF:
+		data = renderPDF(bitmap, conf)
+	case QRFormatEPS:
+		data = renderEPS(bitmap, conf)
+	default:
+		err = fmt.Errorf("unsupported QR format: %s", conf.Format)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := qrContentTypes[conf.Format]
+	if contentType == "" {
+		contentType = qrContentTypes[QRFormatPNG]
+	}
+	return data, contentType, nil
+}
+
+// qrVectorSize returns the width and height of a vector QR code with the given number of modules per side.
+// It follows the PNG semantics: a positive size is the full width, a negative size is the width of a single module.
+func qrVectorSize(size int, modules int) float64 {
+	if size < 0 {
+		return float64(-size * modules)
+	}
+	if size < modules {
+		return float64(modules)
+	}
+	return float64(size)
+}
+
+// qrRuns merges the dark modules of each row of a bitmap into horizontal runs.
+func qrRuns(bitmap [][]bool) []qrRect {
+	var runs []qrRect
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			runs = append(runs, qrRect{X: start, Y: y, W: x - start})
+		}
+	}
+	return runs
+}
+
+// qrQuietZone returns the width of the border around the symbol, in modules.
+func qrQuietZone(conf QRConfig) int {
+	if conf.Border {
+		return 4
+	}
+	return 0
+}
+
+// renderSVG renders a bitmap as an SVG image using a viewBox in module units.
+func renderSVG(bitmap [][]bool, conf QRConfig) ([]byte, error) {
+	modules := len(bitmap)
+	size := qrVectorSize(conf.Size, modules)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%s" height="%s" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		formatFloat(size), formatFloat(size), modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" %s/>`+"\n", modules, modules, svgFill(conf.BgColor))
+
+	if conf.styled() {
+		buf.WriteString(svgStyledModules(bitmap, conf))
+	} else {
+		var path strings.Builder
+		for _, run := range qrRuns(bitmap) {
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", run.X, run.Y, run.W, run.W)
+		}
+		fmt.Fprintf(&buf, `<path d="%s" %s/>`+"\n", path.String(), svgFill(conf.FgColor))
+	}
+	if conf.LogoImage != nil {
+		logo, err := svgLogo(conf.LogoImage, modules, qrQuietZone(conf), conf.BgColor)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(logo)
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// renderPDF renders a bitmap as a single page PDF document, sized in points.
+// PDF has no simple alpha support, so colors are drawn opaque and a fully transparent background is left out.
+func renderPDF(bitmap [][]bool, conf QRConfig) []byte {
+	modules := len(bitmap)
+	size := qrVectorSize(conf.Size, modules)
+	scale := size / float64(modules)
+
+	// Page content, flipped so that module coordinates can be used as-is.
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "%s 0 0 %s 0 %s cm\n", formatFloat(scale), formatFloat(-scale), formatFloat(size))
+	if !isTransparent(conf.BgColor) {
+		fmt.Fprintf(&content, "%s rg\n0 0 %d %d re f\n", rgbOperands(conf.BgColor), modules, modules)
+	}
+	fmt.Fprintf(&content, "%s rg\n", rgbOperands(conf.FgColor))
+	for _, run := range qrRuns(bitmap) {
+		fmt.Fprintf(&content, "%d %d %d 1 re\n", run.X, run.Y, run.W)
+	}
+	content.WriteString("f\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Contents 4 0 R /Resources << >> >>",
+			formatFloat(size), formatFloat(size)),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// renderEPS renders a bitmap as an Encapsulated PostScript image, sized in points.
+// Like PDF, colors are drawn opaque and a fully transparent background is left out.
+func renderEPS(bitmap [][]bool, conf QRConfig) []byte {
+	modules := len(bitmap)
+	size := qrVectorSize(conf.Size, modules)
+	scale := size / float64(modules)
+
+	var buf bytes.Buffer
+	buf.WriteString("%!PS-Adobe-3.0 EPSF-3.0\n")
+	fmt.Fprintf(&buf, "%%%%BoundingBox: 0 0 %d %d\n", int(math.Ceil(size)), int(math.Ceil(size)))
+	fmt.Fprintf(&buf, "%%%%HiResBoundingBox: 0 0 %s %s\n", formatFloat(size), formatFloat(size))
+	buf.WriteString("%%Pages: 1\n%%EndComments\n")
+	fmt.Fprintf(&buf, "0 %s translate\n%s %s scale\n", formatFloat(size), formatFloat(scale), formatFloat(-scale))
+	if !isTransparent(conf.BgColor) {
+		fmt.Fprintf(&buf, "%s setrgbcolor\n0 0 %d %d rectfill\n", rgbOperands(conf.BgColor), modules, modules)
+	}
+	fmt.Fprintf(&buf, "%s setrgbcolor\n", rgbOperands(conf.FgColor))
+	for _, run := range qrRuns(bitmap) {
+		fmt.Fprintf(&buf, "%d %d %d 1 rectfill\n", run.X, run.Y, run.W)
+	}
+	buf.WriteString("showpage\n%%EOF\n")
+	return buf.Bytes()
+}
+
+// svgFill returns the fill attributes of an SVG element for a color, including its opacity if it isn't opaque.
+func svgFill(c color.Color) string {
+	n := straightNRGBA(c)
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, n.R, n.G, n.B)
+	if n.A != 255 {
+		fill += fmt.Sprintf(` fill-opacity="%s"`, formatFloat(float64(n.A)/255))
+	}
+	return fill
+}
+
+// rgbOperands returns the color as the "r g b" operands of the PDF and PostScript color operators. Those don't take an
+// alpha, so translucent colors are drawn opaque.
+func rgbOperands(c color.Color) string {
+	n := straightNRGBA(c)
+	return fmt.Sprintf("%s %s %s", formatFloat(float64(n.R)/255), formatFloat(float64(n.G)/255), formatFloat(float64(n.B)/255))
+}
+
+// isTransparent reports whether a color is fully transparent.
+func isTransparent(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a == 0
+}
+
+// formatFloat formats a float with up to 4 decimals and no trailing zeros.
+func formatFloat(f float64) string {
+	s := fmt.Sprintf("%.4f", f)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
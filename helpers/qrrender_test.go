@@ -0,0 +1,200 @@
+package helpers
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestRenderQR(t *testing.T) {
+	base := QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true}
+
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		prefix      string
+		contains    []string
+	}{
+		{name: "png", format: QRFormatPNG, contentType: "image/png", prefix: "\x89PNG"},
+		{name: "default", format: "", contentType: "image/png", prefix: "\x89PNG"},
+		{
+			name:        "svg",
+			format:      QRFormatSVG,
+			contentType: "image/svg+xml",
+			prefix:      "<?xml",
+			contains:    []string{`width="256"`, `viewBox="0 0 33 33"`, `fill="#ffffff"`, `fill="#000000"`, "</svg>"},
+		},
+		{
+			name:        "pdf",
+			format:      QRFormatPDF,
+			contentType: "application/pdf",
+			prefix:      "%PDF-1.4",
+			contains:    []string{"/MediaBox [0 0 256 256]", "1 1 1 rg", "0 0 0 rg", "startxref", "%%EOF"},
+		},
+		{
+			name:        "eps",
+			format:      QRFormatEPS,
+			contentType: "application/postscript",
+			prefix:      "%!PS-Adobe-3.0 EPSF-3.0",
+			contains:    []string{"%%BoundingBox: 0 0 256 256", "rectfill", "%%EOF"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := base
+			conf.Format = tt.format
+			data, contentType, err := RenderQR("https://lnk.now/abc", conf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if contentType != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, contentType)
+			}
+			if !bytes.HasPrefix(data, []byte(tt.prefix)) {
+				t.Errorf("expected output to start with %q", tt.prefix)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(data), s) {
+					t.Errorf("expected output to contain %q", s)
+				}
+			}
+		})
+	}
+
+	t.Run("png size", func(t *testing.T) {
+		data, _, err := RenderQR("https://lnk.now/abc", base)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+		if img.Bounds().Dx() != 256 {
+			t.Errorf("expected a 256px image, got %d", img.Bounds().Dx())
+		}
+	})
+
+	t.Run("transparent background", func(t *testing.T) {
+		conf := base
+		conf.BgColor = color.RGBA{}
+		conf.Format = QRFormatSVG
+		data, _, _ := RenderQR("https://lnk.now/abc", conf)
+		if !strings.Contains(string(data), `fill="#000000" fill-opacity="0"`) {
+			t.Errorf("expected a transparent background in %s", data)
+		}
+		conf.Format = QRFormatPDF
+		data, _, _ = RenderQR("https://lnk.now/abc", conf)
+		if strings.Contains(string(data), "1 1 1 rg") || strings.Count(string(data), " rg") != 1 {
+			t.Errorf("expected the background to be left out")
+		}
+	})
+
+	t.Run("translucent colors", func(t *testing.T) {
+		// Parsed colors aren't premultiplied, whichever form they're given in.
+		for _, value := range []string{"#c8000080", "rgba(200, 0, 0, 0.5)", "hsla(0 100% 39.2% / 50%)"} {
+			fg, err := ParseColor(value)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			conf := base
+			conf.FgColor = fg
+			conf.Format = QRFormatSVG
+			data, _, _ := RenderQR("https://lnk.now/abc", conf)
+			if s := `fill="#c80000" fill-opacity="0.502"`; !strings.Contains(string(data), s) {
+				t.Errorf("%s: expected the svg to contain %q", value, s)
+			}
+			conf.Format = QRFormatPDF
+			data, _, _ = RenderQR("https://lnk.now/abc", conf)
+			if s := "0.7843 0 0 rg"; !strings.Contains(string(data), s) {
+				t.Errorf("%s: expected the pdf to contain %q", value, s)
+			}
+		}
+	})
+
+	t.Run("logo", func(t *testing.T) {
+		logo, err := DecodeLogo(encodeTestLogo(t, 16, 16, color.RGBA{R: 255, A: 255}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		conf := base
+		conf.Level = qrcode.High
+		conf.Logo = true
+		conf.LogoImage = logo
+
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+		r, g, b, _ := img.At(128, 128).RGBA()
+		if r>>8 != 255 || g != 0 || b != 0 {
+			t.Errorf("expected the logo in the center of the image, got %v", img.At(128, 128))
+		}
+
+		conf.Format = QRFormatSVG
+		data, _, err = RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(string(data), `href="data:image/png;base64,`) {
+			t.Errorf("expected an embedded logo in %s", data)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		conf := base
+		conf.Format = "gif"
+		if _, _, err := RenderQR("https://lnk.now/abc", conf); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestQRVectorSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		modules int
+		want    float64
+	}{
+		{"fixed size", 256, 29, 256},
+		{"module size", -4, 29, 116},
+		{"too small", 10, 29, 29},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := qrVectorSize(tt.size, tt.modules); got != tt.want {
+				t.Errorf("qrVectorSize(%d, %d) = %v, want %v", tt.size, tt.modules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRRuns(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false, true},
+		{false, false, false, false},
+		{false, true, true, true},
+	}
+	runs := qrRuns(bitmap)
+	want := []qrRect{{X: 0, Y: 0, W: 2}, {X: 3, Y: 0, W: 1}, {X: 1, Y: 2, W: 3}}
+	if len(runs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, runs)
+	}
+	for i := range want {
+		if runs[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, runs)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// Supported QR module styles.
+const (
+	QRStyleSquare  = "square"  // Square modules, like a plain QR code
+	QRStyleDot     = "dot"     // Round dots, finder patterns stay square so that they remain easy to locate
+	QRStyleRounded = "rounded" // Squares with the corners that don't touch another module rounded off
+)
+
+// Supported QR gradient directions.
+const (
+	QRGradientHorizontal = "horizontal" // From left to right
+	QRGradientVertical   = "vertical"   // From top to bottom
+	QRGradientDiagonal   = "diagonal"   // From the top-left corner to the bottom-right one
+)
+
+const (
+	// qrDotRadius is the radius of a dot, in modules. It leaves a small gap between adjacent dots.
+	qrDotRadius = 0.45
+	// qrCornerRadius is the radius of the rounded corners of a module, in modules.
+	qrCornerRadius = 0.5
+	// qrFinderSize is the width of a finder pattern, in modules.
+	qrFinderSize = 7
+	// qrSamples is the number of samples per side taken for pixels on the edge of a module's shape.
+	qrSamples = 4
+)
+
+// qrCorners tells which corners of a module are rounded off: top-left, top-right, bottom-right, and bottom-left.
+type qrCorners [4]bool
+
+// qrStyler answers the styling questions the renderers ask about each dark module of a bitmap.
+type qrStyler struct {
+	bitmap  [][]bool
+	modules int
+	quiet   int
+	conf    QRConfig
+}
+
+func newQRStyler(bitmap [][]bool, conf QRConfig) *qrStyler {
+	return &qrStyler{bitmap: bitmap, modules: len(bitmap), quiet: qrQuietZone(conf), conf: conf}
+}
+
+// styled reports whether the configuration needs more than plain, single colored square modules.
+func (c QRConfig) styled() bool {
+	return (c.Style != "" && c.Style != QRStyleSquare) || c.FinderColor != nil || c.GradientColor != nil
+}
+
+// dark reports whether the module at x, y is dark. Modules outside of the bitmap are light.
+func (s *qrStyler) dark(x int, y int) bool {
+	return y >= 0 && y < s.modules && x >= 0 && x < s.modules && s.bitmap[y][x]
+}
+
+// finder reports whether the module at x, y is part of one of the three finder patterns.
+func (s *qrStyler) finder(x int, y int) bool {
+	x, y = x-s.quiet, y-s.quiet
+	symbol := s.modules - 2*s.quiet
+	inStart := func(v int) bool { return v >= 0 && v < qrFinderSize }
+	inEnd := func(v int) bool { return v >= symbol-qrFinderSize && v < symbol }
+	return (inStart(x) && inStart(y)) || (inEnd(x) && inStart(y)) || (inStart(x) && inEnd(y))
+}
+
+// shape returns the style the module at x, y is drawn with.
+func (s *qrStyler) shape(x int, y int) string {
+	if s.conf.Style == QRStyleDot && s.finder(x, y) {
+		return QRStyleSquare
+	}
+	if s.conf.Style == "" {
+		return QRStyleSquare
+	}
+	return s.conf.Style
+}
+
+// corners returns which corners of the module at x, y are rounded off in the rounded style: the ones where neither of
+// the adjacent modules is dark.
+func (s *qrStyler) corners(x int, y int) qrCorners {
+	up, right, down, left := s.dark(x, y-1), s.dark(x+1, y), s.dark(x, y+1), s.dark(x-1, y)
+	return qrCorners{!up && !left, !up && !right, !down && !right, !down && !left}
+}
+
+// contains reports whether the point fx, fy (in [0, 1) within the module) is inside the dark module at x, y.
+func (s *qrStyler) contains(x int, y int, fx float64, fy float64) bool {
+	switch s.shape(x, y) {
+	case QRStyleDot:
+		dx, dy := fx-0.5, fy-0.5
+		return dx*dx+dy*dy <= qrDotRadius*qrDotRadius
+	case QRStyleRounded:
+		corners := s.corners(x, y)
+		r := qrCornerRadius
+		centers := [4][2]float64{{r, r}, {1 - r, r}, {1 - r, 1 - r}, {r, 1 - r}}
+		for i, center := range centers {
+			// Points past the center of a rounded corner's arc, towards the corner, must be within its radius.
+			pastX := ((i == 0 || i == 3) && fx < center[0]) || ((i == 1 || i == 2) && fx > center[0])
+			pastY := (i < 2 && fy < center[1]) || (i >= 2 && fy > center[1])
+			if corners[i] && pastX && pastY {
+				dx, dy := fx-center[0], fy-center[1]
+				if dx*dx+dy*dy > r*r {
+					return false
+				}
+			}
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// gradientPosition returns how far the point x, y (in modules) is along the gradient, from 0 to 1.
+func (s *qrStyler) gradientPosition(x float64, y float64) float64 {
+	size := float64(s.modules)
+	var t float64
+	switch s.conf.GradientDirection {
+	case QRGradientHorizontal:
+		t = x / size
+	case QRGradientVertical:
+		t = y / size
+	default:
+		t = (x + y) / (2 * size)
+	}
+	return math.Max(0, math.Min(1, t))
+}
+
+// color returns the (premultiplied) color of a dark module at the point x, y (in modules).
+func (s *qrStyler) color(x float64, y float64) color.RGBA64 {
+	c := s.conf.FgColor
+	if s.conf.FinderColor != nil && s.finder(int(x), int(y)) {
+		c = s.conf.FinderColor
+	} else if s.conf.GradientColor != nil {
+		c = mixColors(s.conf.FgColor, s.conf.GradientColor, s.gradientPosition(x, y))
+	}
+	return color.RGBA64Model.Convert(straightNRGBA(c)).(color.RGBA64)
+}
+
+// coverage returns how much of the pixel spanning x0, y0 to x1, y1 (in modules) is covered by dark modules, from 0
+// to 1. Module shapes are convex, so a pixel whose corners all fall within the same module is either fully covered or
+// not at all; only pixels on the edge of a shape are supersampled.
+func (s *qrStyler) coverage(x0 float64, y0 float64, x1 float64, y1 float64) float64 {
+	inside := func(x float64, y float64) bool {
+		mx, my := int(x), int(y)
+		return s.dark(mx, my) && s.contains(mx, my, x-float64(mx), y-float64(my))
+	}
+
+	// Sample just inside of the pixel's corners, so they fall within the pixel's own modules.
+	const epsilon = 1e-9
+	mx, my := int(x0), int(y0)
+	if int(x1-epsilon) == mx && int(y1-epsilon) == my {
+		corners := 0
+		for _, corner := range [4][2]float64{{x0, y0}, {x1 - epsilon, y0}, {x0, y1 - epsilon}, {x1 - epsilon, y1 - epsilon}} {
+			if inside(corner[0], corner[1]) {
+				corners++
+			}
+		}
+		if corners == 0 && !s.dark(mx, my) {
+			return 0
+		}
+		if corners == 4 {
+			return 1
+		}
+	}
+
+	covered := 0
+	for sy := 0; sy < qrSamples; sy++ {
+		y := y0 + (y1-y0)*(float64(sy)+0.5)/qrSamples
+		for sx := 0; sx < qrSamples; sx++ {
+			if inside(x0+(x1-x0)*(float64(sx)+0.5)/qrSamples, y) {
+				covered++
+			}
+		}
+	}
+	return float64(covered) / (qrSamples * qrSamples)
+}
+
+// mixColors linearly interpolates between the straight alpha channels of a and b, t being the weight of b.
+func mixColors(a color.Color, b color.Color, t float64) color.Color {
+	na, nb := straightNRGBA(a), straightNRGBA(b)
+	mix := func(u uint8, v uint8) uint8 {
+		return uint8(math.Round(float64(u)*(1-t) + float64(v)*t))
+	}
+	return color.NRGBA{R: mix(na.R, nb.R), G: mix(na.G, nb.G), B: mix(na.B, nb.B), A: mix(na.A, nb.A)}
+}
+
+// qrImageSize returns the width and height in pixels of a raster QR code with the given number of modules per side.
+// Like go-qrcode, a positive size is the full width, a negative size is the width of a single module.
+func qrImageSize(size int, modules int) int {
+	if size < 0 {
+		size = -size * modules
+	}
+	if size < modules {
+		size = modules
+	}
+	return size
+}
+
+// renderImage draws a bitmap as an image.
+// Plain codes are drawn on a palette, one color per module, like go-qrcode does. Styled codes are drawn in full color,
+// with the edges of round shapes supersampled so that they come out smooth.
+func renderImage(bitmap [][]bool, conf QRConfig) draw.Image {
+	s := newQRStyler(bitmap, conf)
+	size := qrImageSize(conf.Size, s.modules)
+	rect := image.Rect(0, 0, size, size)
+	modulesPerPixel := float64(s.modules) / float64(size)
+
+	if !conf.styled() && conf.LogoImage == nil {
+		img := image.NewPaletted(rect, color.Palette{straightNRGBA(conf.BgColor), straightNRGBA(conf.FgColor)})
+		for y := 0; y < size; y++ {
+			my := int(float64(y) * modulesPerPixel)
+			for x := 0; x < size; x++ {
+				if bitmap[my][int(float64(x)*modulesPerPixel)] {
+					img.SetColorIndex(x, y, 1)
+				}
+			}
+		}
+		return img
+	}
+
+	// Blending is done on premultiplied colors, but pixels are stored straight so translucent colors come out as given.
+	img := image.NewNRGBA(rect)
+	bg := color.RGBA64Model.Convert(straightNRGBA(conf.BgColor)).(color.RGBA64)
+	for y := 0; y < size; y++ {
+		y0, y1 := float64(y)*modulesPerPixel, float64(y+1)*modulesPerPixel
+		for x := 0; x < size; x++ {
+			x0, x1 := float64(x)*modulesPerPixel, float64(x+1)*modulesPerPixel
+
+			// Square modules are mapped to the nearest pixels to keep their edges crisp.
+			var coverage float64
+			if conf.Style == QRStyleSquare || conf.Style == "" {
+				if s.dark(int(x0), int(y0)) {
+					coverage = 1
+				}
+			} else {
+				coverage = s.coverage(x0, y0, x1, y1)
+			}
+
+			c := bg
+			if coverage > 0 {
+				c = blendColors(bg, s.color((x0+x1)/2, (y0+y1)/2), coverage)
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// blendColors linearly interpolates between the premultiplied colors a and b, t being the weight of b.
+func blendColors(a color.RGBA64, b color.RGBA64, t float64) color.RGBA64 {
+	if t >= 1 {
+		return b
+	}
+	mix := func(u uint16, v uint16) uint16 {
+		return uint16(math.Round(float64(u)*(1-t) + float64(v)*t))
+	}
+	return color.RGBA64{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: mix(a.A, b.A)}
+}
+
+// rasterQR renders a bitmap as an image, with conf's logo in its center if there is one.
+func rasterQR(bitmap [][]bool, conf QRConfig) draw.Image {
+	img := renderImage(bitmap, conf)
+
+	if conf.LogoImage != nil {
+		modules := len(bitmap)
+		quiet := float64(qrQuietZone(conf)) * float64(img.Bounds().Dx()) / float64(modules)
+		overlayLogo(img, conf.LogoImage, quiet, conf.BgColor)
+	}
+	return img
+}
+
+// encodePNG encodes a rendered QR code as a PNG image.
+func encodePNG(img draw.Image) ([]byte, error) {
+	// Full color images don't compress much further, and take a lot longer to try.
+	level := png.BestCompression
+	if _, ok := img.(*image.NRGBA); ok {
+		level = png.DefaultCompression
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: level}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// svgStyledModules returns the SVG elements drawing the dark modules of a bitmap in conf's style and colors.
+func svgStyledModules(bitmap [][]bool, conf QRConfig) string {
+	s := newQRStyler(bitmap, conf)
+
+	var buf, modules, finders strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			path := &modules
+			if conf.FinderColor != nil && s.finder(x, y) {
+				path = &finders
+			}
+			switch s.shape(x, y) {
+			case QRStyleDot:
+				fmt.Fprintf(path, "M%s %sa%s %s 0 1 0 %s 0a%s %s 0 1 0 -%s 0z",
+					formatFloat(float64(x)+0.5-qrDotRadius), formatFloat(float64(y)+0.5),
+					formatFloat(qrDotRadius), formatFloat(qrDotRadius), formatFloat(2*qrDotRadius),
+					formatFloat(qrDotRadius), formatFloat(qrDotRadius), formatFloat(2*qrDotRadius))
+			case QRStyleRounded:
+				path.WriteString(svgRoundedModule(x, y, s.corners(x, y)))
+			default:
+				fmt.Fprintf(path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	fill := svgFill(conf.FgColor)
+	if conf.GradientColor != nil {
+		x2, y2 := s.modules, s.modules
+		switch conf.GradientDirection {
+		case QRGradientHorizontal:
+			y2 = 0
+		case QRGradientVertical:
+			x2 = 0
+		}
+		fmt.Fprintf(&buf, `<defs><linearGradient id="qr-gradient" gradientUnits="userSpaceOnUse" x1="0" y1="0" x2="%d" y2="%d">`, x2, y2)
+		fmt.Fprintf(&buf, `<stop offset="0" %s/><stop offset="1" %s/></linearGradient></defs>`+"\n",
+			svgStop(conf.FgColor), svgStop(conf.GradientColor))
+		fill = `fill="url(#qr-gradient)"`
+	}
+	fmt.Fprintf(&buf, `<path d="%s" %s/>`+"\n", modules.String(), fill)
+	if finders.Len() > 0 {
+		fmt.Fprintf(&buf, `<path d="%s" %s/>`+"\n", finders.String(), svgFill(conf.FinderColor))
+	}
+	return buf.String()
+}
+
+// svgRoundedModule returns the path of a module at x, y with the given corners rounded off.
+func svgRoundedModule(x int, y int, corners qrCorners) string {
+	r := formatFloat(qrCornerRadius)
+	radius := func(rounded bool) float64 {
+		if rounded {
+			return qrCornerRadius
+		}
+		return 0
+	}
+	arc := func(rounded bool, dx string, dy string) string {
+		if !rounded {
+			return ""
+		}
+		return fmt.Sprintf("a%s %s 0 0 1 %s %s", r, r, dx, dy)
+	}
+
+	var path strings.Builder
+	fmt.Fprintf(&path, "M%s %d", formatFloat(float64(x)+radius(corners[0])), y)
+	fmt.Fprintf(&path, "H%s%s", formatFloat(float64(x+1)-radius(corners[1])), arc(corners[1], r, r))
+	fmt.Fprintf(&path, "V%s%s", formatFloat(float64(y+1)-radius(corners[2])), arc(corners[2], "-"+r, r))
+	fmt.Fprintf(&path, "H%s%s", formatFloat(float64(x)+radius(corners[3])), arc(corners[3], "-"+r, "-"+r))
+	fmt.Fprintf(&path, "V%s%sz", formatFloat(float64(y)+radius(corners[0])), arc(corners[0], r, "-"+r))
+	return path.String()
+}
+
+// svgStop returns the color attributes of an SVG gradient stop.
+func svgStop(c color.Color) string {
+	n := straightNRGBA(c)
+	stop := fmt.Sprintf(`stop-color="#%02x%02x%02x"`, n.R, n.G, n.B)
+	if n.A != 255 {
+		stop += fmt.Sprintf(` stop-opacity="%s"`, formatFloat(float64(n.A)/255))
+	}
+	return stop
+}
@@ -0,0 +1,202 @@
+package helpers
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestQRStylerCorners(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false},
+		{false, true, false},
+		{false, false, false},
+	}
+	s := newQRStyler(bitmap, QRConfig{Style: QRStyleRounded})
+
+	tests := []struct {
+		x, y int
+		want qrCorners
+	}{
+		{0, 0, qrCorners{true, false, false, true}},
+		{1, 0, qrCorners{false, true, false, false}},
+		{1, 1, qrCorners{false, false, true, true}},
+	}
+	for _, tt := range tests {
+		if got := s.corners(tt.x, tt.y); got != tt.want {
+			t.Errorf("corners(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	// The rounded off top-left corner of the first module is outside of it, its top-right corner isn't.
+	if s.contains(0, 0, 0.05, 0.05) {
+		t.Error("expected a rounded corner to be outside of the module")
+	}
+	if !s.contains(0, 0, 0.95, 0.05) {
+		t.Error("expected a square corner to be inside of the module")
+	}
+}
+
+func TestQRStylerFinder(t *testing.T) {
+	qrCode, err := qrcode.New("https://lnk.now/abc", qrcode.Medium)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	qrCode.DisableBorder = false
+	bitmap := qrCode.Bitmap()
+	s := newQRStyler(bitmap, QRConfig{Style: QRStyleDot, Border: true})
+	modules := len(bitmap)
+
+	tests := []struct {
+		x, y int
+		want bool
+	}{
+		{0, 0, false},                     // Quiet zone
+		{4, 4, true},                      // Top-left
+		{modules - 5, 4, true},            // Top-right
+		{4, modules - 5, true},            // Bottom-left
+		{modules - 5, modules - 5, false}, // No finder in the bottom-right corner
+		{12, 12, false},
+	}
+	for _, tt := range tests {
+		if got := s.finder(tt.x, tt.y); got != tt.want {
+			t.Errorf("finder(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	// Finder patterns stay square when drawing dots.
+	if got := s.shape(4, 4); got != QRStyleSquare {
+		t.Errorf("expected finder modules to be square, got %s", got)
+	}
+	if got := s.shape(12, 12); got != QRStyleDot {
+		t.Errorf("expected other modules to be dots, got %s", got)
+	}
+}
+
+func TestMixColors(t *testing.T) {
+	got := color.NRGBAModel.Convert(mixColors(color.Black, color.White, 0.5)).(color.NRGBA)
+	if got != (color.NRGBA{R: 128, G: 128, B: 128, A: 255}) {
+		t.Errorf("expected grey, got %v", got)
+	}
+	got = straightNRGBA(mixColors(color.RGBA{R: 200, A: 128}, color.RGBA{B: 100, A: 255}, 0.5))
+	if got != (color.NRGBA{R: 100, B: 50, A: 192}) {
+		t.Errorf("expected translucent purple, got %v", got)
+	}
+}
+
+func TestRenderQRStyled(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	base := QRConfig{Size: 330, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true, Format: QRFormatPNG}
+
+	t.Run("finder color", func(t *testing.T) {
+		conf := base
+		conf.Style = QRStyleRounded
+		conf.FinderColor = red
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+		// 33 modules of 10px, the outer ring of the top-left finder pattern starts at module 4.
+		if got := color.RGBAModel.Convert(img.At(45, 75)); got != red {
+			t.Errorf("expected the finder pattern to be red, got %v", got)
+		}
+		if got := color.RGBAModel.Convert(img.At(5, 5)); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+			t.Errorf("expected the quiet zone to be white, got %v", got)
+		}
+	})
+
+	t.Run("translucent colors", func(t *testing.T) {
+		// Parsed colors aren't premultiplied, they must come out as they were given.
+		fg, err := ParseColor("#c80000c0")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		conf := base
+		conf.Style = QRStyleRounded
+		conf.FgColor, conf.FinderColor = fg, fg
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+		if got := color.NRGBAModel.Convert(img.At(45, 75)); got != (color.NRGBA{R: 200, A: 192}) {
+			t.Errorf("expected the finder pattern to be translucent red, got %v", got)
+		}
+
+		conf.Format = QRFormatSVG
+		conf.FinderColor = nil
+		conf.GradientColor = color.RGBA{B: 255, A: 255}
+		data, _, err = RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s := `stop-color="#c80000" stop-opacity="0.7529"`; !strings.Contains(string(data), s) {
+			t.Errorf("expected output to contain %q", s)
+		}
+	})
+
+	t.Run("transparent background", func(t *testing.T) {
+		conf := base
+		conf.Style = QRStyleDot
+		conf.BgColor = color.Transparent
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+		if _, _, _, a := img.At(5, 5).RGBA(); a != 0 {
+			t.Errorf("expected a transparent quiet zone, got alpha %d", a)
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		conf := base
+		conf.Format = QRFormatSVG
+		conf.Style = QRStyleDot
+		conf.FinderColor = red
+		conf.GradientColor = color.RGBA{B: 255, A: 255}
+		conf.GradientDirection = QRGradientHorizontal
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, s := range []string{`<linearGradient id="qr-gradient"`, `x2="33" y2="0"`, `stop-color="#0000ff"`,
+			`fill="url(#qr-gradient)"`, `fill="#ff0000"`, "a0.45 0.45 0 1 0 0.9 0"} {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("expected output to contain %q", s)
+			}
+		}
+	})
+}
+
+func TestSVGRoundedModule(t *testing.T) {
+	tests := []struct {
+		name    string
+		corners qrCorners
+		want    string
+	}{
+		{"square", qrCorners{}, "M1 2H2V3H1V2z"},
+		{"round", qrCorners{true, true, true, true}, "M1.5 2H1.5a0.5 0.5 0 0 1 0.5 0.5V2.5a0.5 0.5 0 0 1 -0.5 0.5H1.5a0.5 0.5 0 0 1 -0.5 -0.5V2.5a0.5 0.5 0 0 1 0.5 -0.5z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svgRoundedModule(1, 2, tt.corners); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
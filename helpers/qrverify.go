@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// Limits of verifyQR, below which phone cameras commonly fail to read a code.
+const (
+	qrReaderMinContrast = 2.0 // Contrast ratio between the dark and the light modules
+	qrReaderMinModule   = 2.0 // Width of a module, in pixels
+)
+
+// verifyQR checks that img, rendered from bitmap with conf, can be scanned: it must have a quiet zone, its modules
+// must be large enough and contrast enough, and decoding it must give back content.
+func verifyQR(img image.Image, bitmap [][]bool, content string, conf QRConfig) error {
+	if err := checkQRImage(img, bitmap, content, conf); err != nil {
+		return NewUnscannableError(err)
+	}
+	return nil
+}
+
+// checkQRImage does the checks of verifyQR.
+func checkQRImage(img image.Image, bitmap [][]bool, content string, conf QRConfig) error {
+	// Readers look for the code's edges in the margin around it, which nothing guarantees will be there once it's
+	// printed or placed on a page.
+	if !conf.Border {
+		return errors.New("the code has no quiet zone around it (set border to add one)")
+	}
+
+	bounds := img.Bounds()
+	modules := len(bitmap)
+	if module := float64(bounds.Dx()) / float64(modules); module < qrReaderMinModule {
+		return fmt.Errorf("the modules are too small to be read (%.1fpx, min %.0fpx)", module, qrReaderMinModule)
+	}
+
+	// The average colors of the centers of the dark and light modules, as seen on a white page.
+	page := image.NewRGBA(bounds)
+	draw.Draw(page, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(page, bounds, img, bounds.Min, draw.Over)
+	var sums [2][3]float64
+	var counts [2]float64
+	for y := range bitmap {
+		py := bounds.Min.Y + int((float64(y)+0.5)*float64(bounds.Dy())/float64(modules))
+		for x, dark := range bitmap[y] {
+			px := bounds.Min.X + int((float64(x)+0.5)*float64(bounds.Dx())/float64(modules))
+			c := page.RGBAAt(px, py)
+			side := 0
+			if dark {
+				side = 1
+			}
+			counts[side]++
+			sums[side][0] += float64(c.R)
+			sums[side][1] += float64(c.G)
+			sums[side][2] += float64(c.B)
+		}
+	}
+	mean := func(side int) color.RGBA {
+		return color.RGBA{R: colorByte(sums[side][0] / counts[side] / 255), G: colorByte(sums[side][1] / counts[side] / 255),
+			B: colorByte(sums[side][2] / counts[side] / 255), A: 255}
+	}
+	if ratio := ContrastRatio(mean(1), mean(0)); ratio < qrReaderMinContrast {
+		return fmt.Errorf("the dark and light modules don't contrast enough (%.2f:1, min %.2f:1)", ratio, qrReaderMinContrast)
+	}
+
+	decoded, err := decodeQR(page)
+	if err != nil {
+		return err
+	}
+	if decoded != content {
+		return fmt.Errorf("the code decodes to %q instead of %q", decoded, content)
+	}
+	return nil
+}
+
+// decodeQR reads the text of the QR code in img. Light on dark codes are read as well, like most phone cameras do.
+func decodeQR(img image.Image) (string, error) {
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	reader := zxingqr.NewQRCodeReader()
+	// go-qrcode writes content as is, without telling its encoding.
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER:    true,
+		gozxing.DecodeHintType_CHARACTER_SET: "UTF-8",
+	}
+	decode := func(source gozxing.LuminanceSource) (string, error) {
+		bitmap, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+		if err != nil {
+			return "", err
+		}
+		result, err := reader.Decode(bitmap, hints)
+		if err != nil {
+			return "", err
+		}
+		return result.GetText(), nil
+	}
+
+	text, err := decode(source)
+	if err == nil {
+		return text, nil
+	}
+	if text, invertedErr := decode(gozxing.LuminanceSourceInvert(source)); invertedErr == nil {
+		return text, nil
+	}
+
+	// The reader's errors are about its internals, tell what they mean instead.
+	var notFound gozxing.NotFoundException
+	var checksum gozxing.ChecksumException
+	var format gozxing.FormatException
+	switch {
+	case errors.As(err, &notFound):
+		return "", errors.New("no code can be found in the image")
+	case errors.As(err, &checksum):
+		return "", errors.New("too many errors to correct")
+	case errors.As(err, &format):
+		return "", errors.New("the code's format can't be read")
+	}
+	return "", fmt.Errorf("the code can't be decoded: %w", err)
+}
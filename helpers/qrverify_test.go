@@ -0,0 +1,137 @@
+package helpers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestVerifyQR(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0x80
+	}
+	grey := color.RGBA{R: 148, G: 148, B: 148, A: 255}
+	base := QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true, Style: QRStyleSquare}
+	with := func(change func(*QRConfig)) QRConfig {
+		conf := base
+		change(&conf)
+		return conf
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		conf    QRConfig
+		wantErr string
+	}{
+		{"plain", "https://lnk.now/abc", base, ""},
+		{"no border", "https://lnk.now/abc", with(func(c *QRConfig) { c.Border = false }),
+			"the code has no quiet zone around it (set border to add one)"},
+		{"unicode", "BEGIN:VCARD\nFN:Zoë Brontë\nEND:VCARD", base, ""},
+		{"uneven modules", "https://lnk.now/abc", with(func(c *QRConfig) { c.Size = 333 }), ""},
+		{"large version", strings.Repeat("https://lnk.now/abc/", 40), with(func(c *QRConfig) { c.Size = -2 }), ""},
+		{"dots", "https://lnk.now/abc", with(func(c *QRConfig) { c.Style = QRStyleDot }), ""},
+		{"rounded", "https://lnk.now/abc", with(func(c *QRConfig) { c.Style = QRStyleRounded }), ""},
+		{"gradient", "https://lnk.now/abc", with(func(c *QRConfig) { c.GradientColor, c.GradientDirection = grey, QRGradientDiagonal }), ""},
+		{"inverted", "https://lnk.now/abc", with(func(c *QRConfig) { c.BgColor, c.FgColor = color.Black, color.White }), ""},
+		{"transparent", "https://lnk.now/abc", with(func(c *QRConfig) { c.BgColor = color.RGBA{} }), ""},
+		{"logo", "https://lnk.now/abc", with(func(c *QRConfig) { c.Level, c.LogoImage = qrcode.Highest, logo }), ""},
+		{"logo without error correction", "https://lnk.now/abc", with(func(c *QRConfig) { c.Level, c.LogoImage = qrcode.Low, logo }),
+			"too many errors to correct"},
+		{"tiny", "https://lnk.now/abc", with(func(c *QRConfig) { c.Size = 10 }), "the modules are too small to be read (1.0px, min 2px)"},
+		{"low contrast", "https://lnk.now/abc", with(func(c *QRConfig) { c.FgColor = color.RGBA{G: 255, A: 255} }),
+			"the dark and light modules don't contrast enough (1.37:1, min 2.00:1)"},
+		{"blank", "https://lnk.now/abc", with(func(c *QRConfig) { c.BgColor, c.FgColor = color.RGBA{}, color.White }),
+			"the dark and light modules don't contrast enough (1.00:1, min 2.00:1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qrCode, err := qrcode.New(tt.content, tt.conf.Level)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			qrCode.DisableBorder = !tt.conf.Border
+			bitmap := qrCode.Bitmap()
+
+			err = checkQRImage(rasterQR(bitmap, tt.conf), bitmap, tt.content, tt.conf)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("other content", func(t *testing.T) {
+		qrCode, _ := qrcode.New("https://lnk.now/abc", qrcode.Medium)
+		other, _ := qrcode.New("https://lnk.now/xyz", qrcode.Medium)
+		err := checkQRImage(rasterQR(other.Bitmap(), base), qrCode.Bitmap(), "https://lnk.now/abc", base)
+		if want := `the code decodes to "https://lnk.now/xyz" instead of "https://lnk.now/abc"`; err == nil || err.Error() != want {
+			t.Errorf("expected error %q, got %v", want, err)
+		}
+	})
+}
+
+func TestRenderQRVerify(t *testing.T) {
+	conf := QRConfig{Size: 256, Level: qrcode.Medium, BgColor: color.White, FgColor: color.Black, Border: true,
+		Format: QRFormatPNG, Style: QRStyleSquare, Verify: true}
+
+	for _, format := range []string{QRFormatPNG, QRFormatSVG, QRFormatPDF} {
+		t.Run(format, func(t *testing.T) {
+			conf := conf
+			conf.Format = format
+			if _, _, err := RenderQR("https://lnk.now/abc", conf); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("rendered image", func(t *testing.T) {
+		data, _, err := RenderQR("https://lnk.now/abc", conf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		qrCode, _ := qrcode.New("https://lnk.now/abc", conf.Level)
+		if err := checkQRImage(img, qrCode.Bitmap(), "https://lnk.now/abc", conf); err != nil {
+			t.Errorf("expected the PNG to be scannable, got %v", err)
+		}
+	})
+
+	t.Run("unscannable", func(t *testing.T) {
+		conf := conf
+		conf.Size = 10
+		_, _, err := RenderQR("https://lnk.now/abc", conf)
+		var unscannable *UnscannableError
+		if !errors.As(err, &unscannable) {
+			t.Fatalf("expected an UnscannableError, got %v", err)
+		}
+		if want := "the QR code can't be scanned: the modules are too small to be read (1.0px, min 2px)"; err.Error() != want {
+			t.Errorf("expected %q, got %q", want, err.Error())
+		}
+	})
+
+	t.Run("not verified", func(t *testing.T) {
+		conf := conf
+		conf.Size = 10
+		conf.Verify = false
+		if _, _, err := RenderQR("https://lnk.now/abc", conf); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
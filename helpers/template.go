@@ -0,0 +1,21 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ExpandTemplate replaces every "{name}" placeholder in tmpl with the matching value from vars.
+// Values are inserted as-is, use EscapeTemplateValue for values that need to be URL safe.
+func ExpandTemplate(tmpl string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
+
+// EscapeTemplateValue escapes a value so that it can be placed in either the path or the query string of a URL.
+func EscapeTemplateValue(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
@@ -0,0 +1,46 @@
+package helpers
+
+import "testing"
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{"no placeholders", "https://example.com/", map[string]string{"key": "abc"}, "https://example.com/"},
+		{"single placeholder", "https://example.com/search?q={key}", map[string]string{"key": "abc"}, "https://example.com/search?q=abc"},
+		{"repeated placeholder", "https://{key}.example.com/{key}", map[string]string{"key": "abc"}, "https://abc.example.com/abc"},
+		{"unknown placeholder", "https://example.com/{other}", map[string]string{"key": "abc"}, "https://example.com/{other}"},
+		{"multiple placeholders", "https://example.com/{key}/{path}", map[string]string{"key": "abc", "path": "a/b"}, "https://example.com/abc/a/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandTemplate(tt.tmpl, tt.vars); got != tt.want {
+				t.Errorf("ExpandTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeTemplateValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"abc", "abc"},
+		{"a b", "a%20b"},
+		{"a&b=c", "a%26b%3Dc"},
+		{"a/b?c", "a%2Fb%3Fc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := EscapeTemplateValue(tt.value); got != tt.want {
+				t.Errorf("EscapeTemplateValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
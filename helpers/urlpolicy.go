@@ -0,0 +1,240 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules of the URL policy, reported by PolicyError.
+const (
+	URLRuleInvalid          = "invalid_url"
+	URLRuleScheme           = "scheme"
+	URLRuleBlockedDomain    = "blocked_domain"
+	URLRuleDomainNotAllowed = "domain_not_allowed"
+	URLRuleIPLiteral        = "ip_literal"
+	URLRulePrivateAddress   = "private_address"
+
+	// Rules enforced by following redirects through our own links.
+	URLRuleLoop  = "redirect_loop"
+	URLRuleChain = "redirect_chain"
+)
+
+// urlPolicyLookupTimeout bounds how long resolving a URL's host can take.
+const urlPolicyLookupTimeout = 2 * time.Second
+
+// DefaultURLSchemes are the schemes a URLPolicy allows when it isn't given any.
+var DefaultURLSchemes = []string{"http", "https"}
+
+// internalHostSuffixes are the suffixes of host names that only make sense on a private network.
+var internalHostSuffixes = []string{".localhost", ".local", ".internal", ".home.arpa"}
+
+// privateNetworks are the ranges that aren't reachable from the internet, beyond what net.IP already classifies.
+var privateNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "This" network
+	mustParseCIDR("100.64.0.0/10"), // Carrier-grade NAT
+}
+
+// IPResolver looks up the addresses of a host, *net.Resolver is one.
+type IPResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// URLPolicy decides which URLs redirects may point to. A nil *URLPolicy allows everything.
+//
+// Domain patterns are host names, "example.com" only matches itself, and "*.example.com" matches its subdomains.
+type URLPolicy struct {
+	Schemes      []string   // Allowed schemes, DefaultURLSchemes if empty
+	AllowDomains []string   // Optional domain patterns that URLs must point to one of
+	BlockDomains []string   // Domain patterns that URLs may not point to, even if they're allowed
+	AllowIPs     bool       // Allow URLs pointing to public IP addresses instead of host names
+	AllowPrivate bool       // Allow URLs pointing to private, loopback, or link-local addresses, or to internal hosts
+	Resolver     IPResolver // Optional resolver used to reject host names pointing to private addresses
+}
+
+// Check returns a PolicyError naming the rule that rejects rawURL, or nil if the policy allows it.
+// Host names that can't be resolved are allowed, they may just not be set up yet.
+func (p *URLPolicy) Check(ctx context.Context, rawURL string) error {
+	if p == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return NewPolicyError(URLRuleInvalid, err.Error())
+	}
+
+	schemes := p.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultURLSchemes
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !containsFold(schemes, scheme) {
+		return NewPolicyError(URLRuleScheme,
+			fmt.Sprintf("the %q scheme is not allowed (allowed: %s)", scheme, strings.Join(schemes, ", ")))
+	}
+
+	// Browsers read "http:///example.com" as "http://example.com", so web URLs must have a host to check.
+	host := NormalizeHost(u.Hostname())
+	if host == "" {
+		if scheme == "http" || scheme == "https" {
+			return NewPolicyError(URLRuleInvalid, "the URL has no host")
+		}
+		return nil
+	}
+
+	if matchesDomain(p.BlockDomains, host) {
+		return NewPolicyError(URLRuleBlockedDomain, fmt.Sprintf("%s is blocked", host))
+	}
+	if len(p.AllowDomains) > 0 && !matchesDomain(p.AllowDomains, host) {
+		return NewPolicyError(URLRuleDomainNotAllowed, fmt.Sprintf("%s is not an allowed domain", host))
+	}
+
+	if ip := parseIPHost(host); ip != nil {
+		if !p.AllowPrivate && isPrivateIP(ip) {
+			return NewPolicyError(URLRulePrivateAddress, fmt.Sprintf("%s is a private address", ip))
+		}
+		if !p.AllowIPs {
+			return NewPolicyError(URLRuleIPLiteral, fmt.Sprintf("%s is an IP address, use a host name", host))
+		}
+		return nil
+	}
+
+	if p.AllowPrivate {
+		return nil
+	}
+	if isInternalHost(host) {
+		return NewPolicyError(URLRulePrivateAddress, fmt.Sprintf("%s is an internal host", host))
+	}
+	if p.Resolver != nil {
+		ctx, cancel := context.WithTimeout(ctx, urlPolicyLookupTimeout)
+		defer cancel()
+		addrs, err := p.Resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil
+		}
+		for _, addr := range addrs {
+			if isPrivateIP(addr.IP) {
+				return NewPolicyError(URLRulePrivateAddress, fmt.Sprintf("%s resolves to the private address %s", host, addr.IP))
+			}
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether values contains s, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDomain reports whether host matches any of the domain patterns.
+func matchesDomain(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = NormalizeHost(pattern)
+		if pattern == "*" {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if pattern != "" && host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalHost reports whether host is a name that only resolves on a private network: localhost, a reserved
+// internal suffix, or a single label that would be completed with the network's search domains.
+func isInternalHost(host string) bool {
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range internalHostSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateIP reports whether ip isn't a public unicast address.
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIPHost returns the IP address host stands for, or nil if it's a host name. On top of the usual notations, it
+// understands the shorthand IPv4 notations that browsers accept, such as "127.1", "0x7f.0.0.1", or "2130706433".
+func parseIPHost(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var addr uint64
+	for i, part := range parts {
+		n, ok := parseIPv4Part(part)
+		if !ok {
+			return nil
+		}
+		// Every part is a byte, except the last one which fills the remaining bytes.
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return nil
+			}
+			addr |= n << (8 * (3 - i))
+		} else {
+			if n >= 1<<(8*(4-i)) {
+				return nil
+			}
+			addr |= n
+		}
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+// parseIPv4Part parses a part of a shorthand IPv4 address, which may be decimal, octal with a leading 0, or hexadecimal
+// with a leading 0x.
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	if rest, ok := strings.CutPrefix(strings.ToLower(part), "0x"); ok {
+		if rest == "" {
+			return 0, true
+		}
+		part, base = rest, 16
+	} else if len(part) > 1 && part[0] == '0' {
+		part, base = part[1:], 8
+	}
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
+
+// mustParseCIDR parses a CIDR network, and panics if it's invalid.
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeResolver resolves host names from a map, and fails for the others.
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ip, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+}
+
+func TestURLPolicy_Check(t *testing.T) {
+	resolver := fakeResolver{"intranet.example.com": "10.1.2.3", "www.example.com": "93.184.215.14"}
+
+	tests := []struct {
+		name     string
+		policy   *URLPolicy
+		url      string
+		wantRule string
+	}{
+		{"nil policy", nil, "javascript:alert(1)", ""},
+		{"https", &URLPolicy{}, "https://example.com/path", ""},
+		{"http", &URLPolicy{}, "http://example.com", ""},
+		{"uppercase scheme", &URLPolicy{}, "HTTPS://EXAMPLE.COM", ""},
+		{"javascript", &URLPolicy{}, "javascript:alert(1)", URLRuleScheme},
+		{"file", &URLPolicy{}, "file:///etc/passwd", URLRuleScheme},
+		{"data", &URLPolicy{}, "data:text/html,hi", URLRuleScheme},
+		{"allowed scheme", &URLPolicy{Schemes: []string{"https", "mailto"}}, "mailto:hi@example.com", ""},
+		{"scheme not in list", &URLPolicy{Schemes: []string{"https"}}, "http://example.com", URLRuleScheme},
+		{"no host", &URLPolicy{}, "http:///example.com", URLRuleInvalid},
+		{"unparseable", &URLPolicy{}, "http://[::1", URLRuleInvalid},
+
+		{"blocked", &URLPolicy{BlockDomains: []string{"evil.com"}}, "https://evil.com/x", URLRuleBlockedDomain},
+		{"blocked trailing dot", &URLPolicy{BlockDomains: []string{"evil.com"}}, "https://EVIL.com./x", URLRuleBlockedDomain},
+		{"blocked exact only", &URLPolicy{BlockDomains: []string{"evil.com"}}, "https://www.evil.com", ""},
+		{"blocked wildcard", &URLPolicy{BlockDomains: []string{"*.evil.com"}}, "https://www.evil.com", URLRuleBlockedDomain},
+		{"wildcard skips apex", &URLPolicy{BlockDomains: []string{"*.evil.com"}}, "https://evil.com", ""},
+		{"wildcard suffix only", &URLPolicy{BlockDomains: []string{"*.evil.com"}}, "https://notevil.com", ""},
+		{"allowed", &URLPolicy{AllowDomains: []string{"example.com", "*.example.com"}}, "https://a.b.example.com", ""},
+		{"not allowed", &URLPolicy{AllowDomains: []string{"example.com"}}, "https://example.org", URLRuleDomainNotAllowed},
+		{"block beats allow", &URLPolicy{AllowDomains: []string{"*"}, BlockDomains: []string{"evil.com"}}, "https://evil.com",
+			URLRuleBlockedDomain},
+
+		{"IP literal", &URLPolicy{}, "http://93.184.215.14/", URLRuleIPLiteral},
+		{"IPv6 literal", &URLPolicy{}, "http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]/", URLRuleIPLiteral},
+		{"allowed IP literal", &URLPolicy{AllowIPs: true}, "http://93.184.215.14:8080/", ""},
+		{"private IP", &URLPolicy{AllowIPs: true}, "http://10.0.0.1/admin", URLRulePrivateAddress},
+		{"loopback", &URLPolicy{AllowIPs: true}, "http://127.0.0.1/", URLRulePrivateAddress},
+		{"IPv6 loopback", &URLPolicy{AllowIPs: true}, "http://[::1]/", URLRulePrivateAddress},
+		{"IPv4-mapped loopback", &URLPolicy{AllowIPs: true}, "http://[::ffff:127.0.0.1]/", URLRulePrivateAddress},
+		{"link-local", &URLPolicy{AllowIPs: true}, "http://169.254.169.254/latest/meta-data", URLRulePrivateAddress},
+		{"carrier-grade NAT", &URLPolicy{AllowIPs: true}, "http://100.64.0.1/", URLRulePrivateAddress},
+		{"unspecified", &URLPolicy{AllowIPs: true}, "http://0.0.0.0:8080/", URLRulePrivateAddress},
+		{"shorthand loopback", &URLPolicy{AllowIPs: true}, "http://127.1/", URLRulePrivateAddress},
+		{"decimal loopback", &URLPolicy{AllowIPs: true}, "http://2130706433/", URLRulePrivateAddress},
+		{"hex loopback", &URLPolicy{AllowIPs: true}, "http://0x7f.0.0.1/", URLRulePrivateAddress},
+		{"octal private", &URLPolicy{AllowIPs: true}, "http://012.0.0.1/", URLRulePrivateAddress},
+		{"shorthand public", &URLPolicy{}, "http://1.1/", URLRuleIPLiteral},
+		{"allowed private IP", &URLPolicy{AllowIPs: true, AllowPrivate: true}, "http://10.0.0.1/", ""},
+		{"private IP literal", &URLPolicy{AllowPrivate: true}, "http://10.0.0.1/", URLRuleIPLiteral},
+
+		{"localhost", &URLPolicy{}, "http://localhost:8080/", URLRulePrivateAddress},
+		{"localhost subdomain", &URLPolicy{}, "http://app.localhost/", URLRulePrivateAddress},
+		{"mDNS", &URLPolicy{}, "http://printer.local/", URLRulePrivateAddress},
+		{"single label", &URLPolicy{}, "http://intranet/", URLRulePrivateAddress},
+		{"allowed internal host", &URLPolicy{AllowPrivate: true}, "http://intranet/", ""},
+		{"numeric-looking label", &URLPolicy{}, "http://1.2.3.com/", ""},
+
+		{"resolves private", &URLPolicy{Resolver: resolver}, "https://intranet.example.com", URLRulePrivateAddress},
+		{"resolves public", &URLPolicy{Resolver: resolver}, "https://www.example.com", ""},
+		{"doesn't resolve", &URLPolicy{Resolver: resolver}, "https://new.example.com", ""},
+		{"allowed resolves private", &URLPolicy{Resolver: resolver, AllowPrivate: true}, "https://intranet.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(context.Background(), tt.url)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected a PolicyError, got %v", err)
+			}
+			if policyErr.Rule != tt.wantRule {
+				t.Errorf("expected rule %q, got %q (%v)", tt.wantRule, policyErr.Rule, err)
+			}
+		})
+	}
+}
+
+func TestURLPolicy_CheckMessages(t *testing.T) {
+	policy := &URLPolicy{AllowIPs: true, BlockDomains: []string{"*.evil.com"}}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"file:///etc/passwd", `the URL is not allowed: the "file" scheme is not allowed (allowed: http, https)`},
+		{"https://www.evil.com", "the URL is not allowed: www.evil.com is blocked"},
+		{"http://2130706433/", "the URL is not allowed: 127.0.0.1 is a private address"},
+		{"http://intranet/", "the URL is not allowed: intranet is an internal host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := policy.Check(context.Background(), tt.url)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseIPHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+		{"127.1", "127.0.0.1"},
+		{"10.1.1", "10.1.0.1"},
+		{"2130706433", "127.0.0.1"},
+		{"0x7f000001", "127.0.0.1"},
+		{"0177.0.0.1", "127.0.0.1"},
+		{"0x.0.0.0", "0.0.0.0"},
+		{"256.0.0.1", ""},
+		{"1.2.3.4.5", ""},
+		{"4294967296", ""},
+		{"08.0.0.1", ""},
+		{"example.com", ""},
+		{"1.2.3.com", ""},
+		{"1..2", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got := parseIPHost(tt.host)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("expected no IP, got %v", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Errorf("expected %s, got %v", tt.want, got)
+			}
+		})
+	}
+}
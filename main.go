@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/thedeltaflyer/redirector/database"
@@ -11,9 +13,48 @@ import (
 )
 
 var (
-	Debug  = false          // Debug mode option
-	Bind   = ":8080"        // Bind host and/or port
-	DbPath = "./db/db.bolt" // Path to the BoltDB file
+	Debug       = false          // Debug mode option
+	Bind        = ":8080"        // Bind host and/or port
+	DbPath      = "./db/db.bolt" // Path to the BoltDB file
+	TemplateDir = ""             // Directory of custom page templates
+	FallbackURL = ""             // URL unknown keys are redirected to
+
+	QRCacheEntries = 1000     // Maximum number of cached QR codes
+	QRCacheSize    = 64       // Maximum size of the cached QR codes, in MB
+	QRCacheDir     = ""       // Directory to cache QR codes in instead of memory
+	QRContrast     = "reject" // What to do with QR codes whose colors don't contrast enough
+
+	TrustedProxies []string         // Proxies trusted to report client IPs, none of them if unset
+	RedirectRate   = 20.0           // Redirects per second per client IP
+	RedirectBurst  = 100            // Redirects a client IP can make at once
+	APIRate        = 5.0            // Authenticated requests per second per API key
+	APIBurst       = 50             // Authenticated requests an API key can make at once
+	AuthFailures   = 10             // Failed authentication attempts per client IP before a lockout
+	AuthLockout    = time.Minute    // First lockout, doubled every time
+	AuthLockoutMax = 24 * time.Hour // Longest lockout
+
+	IdempotencyWindow = 24 * time.Hour // How long responses are replayed to requests repeating their Idempotency-Key
+
+	URLSchemes      = []string{"http", "https"} // Schemes redirects may use
+	URLAllowDomains []string                    // Domains redirects must point to, any if unset
+	URLBlockDomains []string                    // Domains redirects may not point to
+	URLAllowIPs     = false                     // Allow redirects to public IP addresses
+	URLAllowPrivate = false                     // Allow redirects to private addresses and internal hosts
+	URLResolve      = false                     // Resolve redirect hosts to check their addresses
+
+	PublicHosts   []string // Hosts serving the default namespace
+	MaxChainDepth = 0      // Links a redirect may go through before it's flattened
+
+	KeyCharset       = "A-Za-z0-9_-" // Characters keys may use
+	KeyMinLength     = 1             // Shortest key
+	KeyMaxLength     = 100           // Longest key
+	KeyNormalization = "none"        // How keys are normalized
+	ReservedKeys     []string        // Keys that can't be used, on top of the routes
+	MigrateKeys      = ""            // Check or apply the migration of keys to the key normalization, then exit
+
+	KeyGenerator = "nanoid" // Generator of the keys of redirects created without one
+	KeyAlphabet  = ""       // Characters of nanoid keys, the nanoid default if unset
+	KeyLength    = 0        // Characters of generated keys, or digits of word keys, the generator's default if unset
 )
 
 // main initializes the logger, enables debug mode if specified, initializes the database, and starts the HTTP server.
@@ -30,8 +71,65 @@ func main() {
 	database.InitDB(DbPath, true)
 	defer database.CloseDB()
 
+	config := server.Config{
+		Bind:        Bind,
+		Debug:       Debug,
+		TemplateDir: TemplateDir,
+		FallbackURL: FallbackURL,
+
+		QRCacheEntries: QRCacheEntries,
+		QRCacheBytes:   int64(QRCacheSize) << 20,
+		QRCacheDir:     QRCacheDir,
+		QRContrast:     QRContrast,
+
+		TrustedProxies: TrustedProxies,
+		RedirectRate:   RedirectRate,
+		RedirectBurst:  RedirectBurst,
+		APIRate:        APIRate,
+		APIBurst:       APIBurst,
+		AuthFailures:   AuthFailures,
+		AuthLockout:    AuthLockout,
+		AuthLockoutMax: AuthLockoutMax,
+
+		IdempotencyWindow: IdempotencyWindow,
+
+		URLSchemes:      URLSchemes,
+		URLAllowDomains: URLAllowDomains,
+		URLBlockDomains: URLBlockDomains,
+		URLAllowIPs:     URLAllowIPs,
+		URLAllowPrivate: URLAllowPrivate,
+		URLResolve:      URLResolve,
+
+		PublicHosts:   PublicHosts,
+		MaxChainDepth: MaxChainDepth,
+
+		KeyCharset:       KeyCharset,
+		KeyMinLength:     KeyMinLength,
+		KeyMaxLength:     KeyMaxLength,
+		KeyNormalization: KeyNormalization,
+		ReservedKeys:     ReservedKeys,
+
+		KeyGenerator: KeyGenerator,
+		KeyAlphabet:  KeyAlphabet,
+		KeyLength:    KeyLength,
+	}
+
+	// Migrate the keys to the key normalization instead of serving, if asked to.
+	if MigrateKeys != "" {
+		if MigrateKeys != "check" && MigrateKeys != "apply" {
+			logger.Errorf("invalid key migration (must be one of check,apply): %s", MigrateKeys)
+			return
+		}
+		if err := server.MigrateKeys(config, MigrateKeys == "apply"); err != nil {
+			logger.Errorf("Key migration failed: %v", err)
+			return
+		}
+		logger.Infof("Key migration done (%s)", MigrateKeys)
+		return
+	}
+
 	logger.Infof("Starting redirector on %q", Bind)
-	server.Run(Bind, Debug)
+	server.Run(config)
 
 	logger.Info("Redirector stopped")
 }
@@ -40,5 +138,37 @@ func init() {
 	flag.BoolVarP(&Debug, "debug", "d", Debug, "Debug mode")
 	flag.StringVarP(&Bind, "bind", "b", Bind, "Address/port to bind to")
 	flag.StringVarP(&DbPath, "db", "s", DbPath, "Path to database file")
+	flag.StringVar(&TemplateDir, "templates", TemplateDir, "Directory of custom page templates")
+	flag.StringVar(&FallbackURL, "fallback-url", FallbackURL, "URL to redirect unknown keys to, {key} is replaced with the key")
+	flag.IntVar(&QRCacheEntries, "qr-cache-entries", QRCacheEntries, "Maximum number of cached QR codes, 0 disables the cache")
+	flag.IntVar(&QRCacheSize, "qr-cache-size", QRCacheSize, "Maximum size of the cached QR codes, in MB")
+	flag.StringVar(&QRCacheDir, "qr-cache-dir", QRCacheDir, "Directory to cache QR codes in instead of memory")
+	flag.StringVar(&QRContrast, "qr-contrast", QRContrast, "What to do with low contrast QR codes: reject, warn, or off")
+	flag.StringSliceVar(&TrustedProxies, "trusted-proxies", TrustedProxies, "Proxies (IPs or CIDRs) trusted to report client IPs in X-Forwarded-For, none of them if unset")
+	flag.Float64Var(&RedirectRate, "redirect-rate", RedirectRate, "Redirects per second per client IP, 0 disables the limit")
+	flag.IntVar(&RedirectBurst, "redirect-burst", RedirectBurst, "Redirects a client IP can make at once")
+	flag.Float64Var(&APIRate, "api-rate", APIRate, "Authenticated requests per second per API key, 0 disables the limit")
+	flag.IntVar(&APIBurst, "api-burst", APIBurst, "Authenticated requests an API key can make at once")
+	flag.IntVar(&AuthFailures, "auth-failures", AuthFailures, "Failed authentication attempts per client IP before it is locked out, 0 disables lockouts")
+	flag.DurationVar(&AuthLockout, "auth-lockout", AuthLockout, "First lockout after too many failed authentication attempts, doubled every time")
+	flag.DurationVar(&AuthLockoutMax, "auth-lockout-max", AuthLockoutMax, "Longest lockout after failed authentication attempts")
+	flag.DurationVar(&IdempotencyWindow, "idempotency-window", IdempotencyWindow, "How long responses to creation requests are replayed to requests repeating their Idempotency-Key header, 0 disables it")
+	flag.StringSliceVar(&URLSchemes, "url-schemes", URLSchemes, "Schemes redirects may use")
+	flag.StringSliceVar(&URLAllowDomains, "url-allow-domains", URLAllowDomains, "Domains redirects must point to, *.example.com matches its subdomains, any if unset")
+	flag.StringSliceVar(&URLBlockDomains, "url-block-domains", URLBlockDomains, "Domains redirects may not point to, *.example.com matches its subdomains")
+	flag.BoolVar(&URLAllowIPs, "url-allow-ips", URLAllowIPs, "Allow redirects to public IP addresses instead of host names")
+	flag.BoolVar(&URLAllowPrivate, "url-allow-private", URLAllowPrivate, "Allow redirects to private, loopback, and link-local addresses, and to internal hosts")
+	flag.BoolVar(&URLResolve, "url-resolve", URLResolve, "Resolve redirect hosts when they're set, to reject the ones pointing to private addresses")
+	flag.StringSliceVar(&PublicHosts, "public-hosts", PublicHosts, "Hosts serving the default namespace, redirects to them are followed to reject loops")
+	flag.IntVar(&MaxChainDepth, "max-chain-depth", MaxChainDepth, "Links of ours a redirect may go through before it's pointed straight at the end of the chain, 0 never flattens")
+	flag.StringVar(&KeyCharset, "key-charset", KeyCharset, "Characters keys may use, as a regular expression character class")
+	flag.IntVar(&KeyMinLength, "key-min-length", KeyMinLength, "Shortest key, in characters")
+	flag.IntVar(&KeyMaxLength, "key-max-length", KeyMaxLength, "Longest key, in characters")
+	flag.StringVar(&KeyNormalization, "key-normalization", KeyNormalization, "How keys are normalized on write and read: none, lower, or canonical (case-folded, NFC, trailing punctuation trimmed)")
+	flag.StringVar(&MigrateKeys, "migrate-keys", MigrateKeys, "Report the keys that --key-normalization would rename or make collide (check), or rename them (apply), then exit")
+	flag.StringSliceVar(&ReservedKeys, "reserved-keys", ReservedKeys, "Keys that can't be used, on top of the first segment of every route")
+	flag.StringVar(&KeyGenerator, "key-generator", KeyGenerator, "Generator of the keys of redirects created without one: nanoid, base32 (no 0, 1, l, or o), or words (brave-otter-42)")
+	flag.StringVar(&KeyAlphabet, "key-alphabet", KeyAlphabet, "Characters of nanoid keys, letters, digits, _ and - if unset")
+	flag.IntVar(&KeyLength, "key-length", KeyLength, "Characters of nanoid and base32 keys (default 12), or digits ending word keys (default 2)")
 	flag.Parse()
 }
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of idempotent requests.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	// maxIdempotencyKeyLength is the longest Idempotency-Key header accepted.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentResponseSize is the largest response remembered, larger ones aren't replayed.
+	maxIdempotentResponseSize = 1 << 20
+	// idempotencySweepInterval is how often expired responses are dropped.
+	idempotencySweepInterval = time.Minute
+)
+
+// idempotentResponse is the response to the first request made with an idempotency key, done once it is sent.
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+}
+
+// IdempotencyStore remembers the responses to requests made with an Idempotency-Key header for window, so that
+// retries get the same response instead of being processed again. Responses are kept in memory, they don't survive a
+// restart. A nil *IdempotencyStore doesn't remember anything.
+type IdempotencyStore struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+// NewIdempotencyStore creates an IdempotencyStore remembering responses for window.
+// Returns nil, which doesn't remember anything, if window isn't positive.
+func NewIdempotencyStore(window time.Duration) *IdempotencyStore {
+	if window <= 0 {
+		return nil
+	}
+	return &IdempotencyStore{
+		window:    window,
+		now:       time.Now,
+		responses: map[string]*idempotentResponse{},
+	}
+}
+
+// begin reserves key for a request with fingerprint. It returns the response to replay if the key was already used
+// for the same request, or a status to reject the request with if it was used for another request or its first
+// request is still being processed. Otherwise the request is to be processed, and finished with finish or abort.
+func (s *IdempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (*idempotentResponse, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	response, ok := s.responses[key]
+	if ok && now.Before(response.expires) {
+		switch {
+		case response.fingerprint != fingerprint:
+			return nil, http.StatusUnprocessableEntity
+		case !response.done:
+			return nil, http.StatusConflict
+		default:
+			return response, 0
+		}
+	}
+	s.responses[key] = &idempotentResponse{fingerprint: fingerprint, expires: now.Add(s.window)}
+	return nil, 0
+}
+
+// finish remembers the response to the request that reserved key.
+func (s *IdempotencyStore) finish(key string, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if response, ok := s.responses[key]; ok {
+		response.done = true
+		response.status = status
+		response.contentType = contentType
+		response.body = body
+	}
+}
+
+// abort forgets key, so that the request can be retried.
+func (s *IdempotencyStore) abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, key)
+}
+
+// sweep drops the responses that expired. The lock must be held.
+func (s *IdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, response := range s.responses {
+		if !now.Before(response.expires) {
+			delete(s.responses, key)
+		}
+	}
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if w.body.Len() <= maxIdempotentResponseSize {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	if w.body.Len() <= maxIdempotentResponseSize {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the response to the first request made with an Idempotency-Key header to the requests
+// repeating it within the store's window, with an Idempotent-Replayed header. Keys are scoped to the API key, host,
+// method, and path of the request. Reusing a key for a different body gets a 422, and repeating a request that is still
+// being processed gets a 409. Server errors aren't remembered, so that the request can be retried. It must run after
+// the auth middleware.
+func IdempotencyMiddleware(store *IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if store == nil || idempotencyKey == "" {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the Idempotency-Key header is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := c.GetString(APIKeyIDContextKey) + " " + c.Request.Host + " " + c.Request.Method + " " +
+			c.Request.URL.RequestURI() + " " + idempotencyKey
+		response, status := store.begin(key, sha256.Sum256(body))
+		switch status {
+		case http.StatusUnprocessableEntity:
+			c.AbortWithStatusJSON(status, gin.H{"error": "the Idempotency-Key was already used for another request"})
+			return
+		case http.StatusConflict:
+			c.AbortWithStatusJSON(status, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+			return
+		}
+		if response != nil {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(response.status, response.contentType, response.body)
+			c.Abort()
+			return
+		}
+
+		// Forget the key if the request panics, it may be retried.
+		finished := false
+		defer func() {
+			if !finished {
+				store.abort(key)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		finished = true
+		if writer.Status() >= http.StatusInternalServerError || writer.body.Len() > maxIdempotentResponseSize {
+			store.abort(key)
+			return
+		}
+		store.finish(key, writer.Status(), writer.Header().Get("Content-Type"), writer.body.Bytes())
+	}
+}
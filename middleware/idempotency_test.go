@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	store := NewIdempotencyStore(time.Hour)
+	store.now = clock.Now
+
+	calls := 0
+	status := http.StatusOK
+	release := make(chan struct{})
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(APIKeyIDContextKey, c.GetHeader("X-Test-Key"))
+	}, IdempotencyMiddleware(store))
+	r.POST("/", func(c *gin.Context) {
+		calls++
+		c.JSON(status, gin.H{"call": calls})
+	})
+	r.POST("/slow", func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+	r.POST("/panic", func(c *gin.Context) {
+		calls++
+		panic("boom")
+	})
+
+	request := func(path string, idempotencyKey string, apiKey string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		req.Header.Set("X-Test-Key", apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The first response is replayed.
+	first := request("/", "k1", "a", `{"url":"https://example.com"}`)
+	if first.Code != http.StatusOK || first.Body.String() != `{"call":1}` {
+		t.Fatalf("unexpected first response: %d %s", first.Code, first.Body.String())
+	}
+	replay := request("/", "k1", "a", `{"url":"https://example.com"}`)
+	if replay.Code != http.StatusOK || replay.Body.String() != `{"call":1}` || replay.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected the first response to be replayed, got %d %s", replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("expected content type %q, got %q", first.Header().Get("Content-Type"), replay.Header().Get("Content-Type"))
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		idempotencyKey string
+		apiKey         string
+		body           string
+		wantStatus     int
+		wantCall       int
+	}{
+		{"another body", "/", "k1", "a", `{"url":"https://example.org"}`, http.StatusUnprocessableEntity, 0},
+		{"another API key", "/", "k1", "b", `{"url":"https://example.com"}`, http.StatusOK, 2},
+		{"another path", "/?dedupe=true", "k1", "a", `{"url":"https://example.com"}`, http.StatusOK, 3},
+		{"another idempotency key", "/", "k2", "a", `{"url":"https://example.com"}`, http.StatusOK, 4},
+		{"no idempotency key", "/", "", "a", `{"url":"https://example.com"}`, http.StatusOK, 5},
+		{"no idempotency key again", "/", "", "a", `{"url":"https://example.com"}`, http.StatusOK, 6},
+		{"too long", "/", strings.Repeat("k", 256), "a", `{}`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request(tt.path, tt.idempotencyKey, tt.apiKey, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantCall > 0 && w.Body.String() != `{"call":`+strconv.Itoa(tt.wantCall)+`}` {
+				t.Errorf("expected call %d, got %s", tt.wantCall, w.Body.String())
+			}
+		})
+	}
+
+	// Server errors aren't remembered.
+	status = http.StatusInternalServerError
+	if w := request("/", "k3", "a", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a server error, got %d", w.Code)
+	}
+	status = http.StatusOK
+	if w := request("/", "k3", "a", `{}`); w.Code != http.StatusOK || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("expected the request to be processed again, got %d", w.Code)
+	}
+
+	// Neither are panics.
+	func() {
+		defer func() { _ = recover() }()
+		request("/panic", "k4", "a", `{}`)
+	}()
+	func() {
+		defer func() { _ = recover() }()
+		calls = 0
+		request("/panic", "k4", "a", `{}`)
+	}()
+	if calls != 1 {
+		t.Errorf("expected a request that panicked to be processed again, got %d calls", calls)
+	}
+
+	// Requests still being processed can't be repeated.
+	done := make(chan struct{})
+	go func() {
+		request("/slow", "k5", "a", `{}`)
+		close(done)
+	}()
+	for {
+		store.mu.Lock()
+		_, started := store.responses["a example.com POST /slow k5"]
+		store.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if w := request("/slow", "k5", "a", `{}`); w.Code != http.StatusConflict {
+		t.Errorf("expected a conflict, got %d", w.Code)
+	}
+	close(release)
+	<-done
+
+	// Responses are forgotten after the window.
+	clock.Advance(time.Hour)
+	if w := request("/", "k1", "a", `{"url":"https://example.com"}`); w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Error("expected the response to be forgotten")
+	}
+	if len(store.responses) != 1 {
+		t.Errorf("expected expired responses to be dropped, got %d", len(store.responses))
+	}
+}
+
+func TestIdempotencyMiddleware_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	r := gin.New()
+	r.Use(IdempotencyMiddleware(NewIdempotencyStore(0)))
+	r.POST("/", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Errorf("expected every request to be processed, got %d calls", calls)
+	}
+}
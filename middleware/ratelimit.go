@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitSweepInterval is how often idle buckets are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// Bounds of the clients an AuthLockout keeps track of: how often the forgotten ones are dropped, and how many are kept
+// at most, so that failures from a flood of addresses can't exhaust memory. Once full, making room drops the one that
+// ends soonest among lockoutEvictionSample of them.
+const (
+	lockoutSweepInterval  = time.Minute
+	maxLockoutEntries     = 100000
+	lockoutEvictionSample = 8
+)
+
+// RateLimitKeyFunc returns the key a request is rate limited by, or an empty string to let it through.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// ClientIPKey rate limits requests by client IP.
+func ClientIPKey(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// APIKeyKey rate limits requests by the API key they were authenticated with, it must run after the auth middleware.
+func APIKeyKey(c *gin.Context) string {
+	return c.GetString(APIKeyIDContextKey)
+}
+
+// tokenBucket holds the tokens left for a key, as of updated.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a token bucket rate limiter: every key may make burst requests at once, and gets rate more tokens per
+// second up to burst. A nil *RateLimiter allows everything.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second per key, with bursts of up to burst requests.
+// Returns nil, which allows everything, if rate or burst isn't positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token from the bucket of key. If there's none left, it returns false along with how long until there
+// is one.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled, they're the same as new ones. The lock must be held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware rejects requests over the limiter's rate for their key with a 429 and a Retry-After header.
+func RateLimitMiddleware(limiter *RateLimiter, key RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+		if ok, wait := limiter.Allow(k); !ok {
+			tooManyRequests(c, wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+// tooManyRequests aborts the request with a 429, telling the client how long to wait in whole seconds.
+func tooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+}
+
+// lockoutEntry is the failed authentication state of a client.
+type lockoutEntry struct {
+	strikes int
+	until   time.Time
+}
+
+// AuthLockout locks clients out after too many failed authentication attempts. Failures are rate limited like requests,
+// and every time a client runs out of them it is locked out for twice as long as the previous time, from base up to
+// max. A client's lockouts are forgotten once it authenticates, or after max without being locked out.
+// A nil *AuthLockout never locks anyone out.
+type AuthLockout struct {
+	failures *RateLimiter
+	base     time.Duration
+	max      time.Duration
+	limit    int
+	now      func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*lockoutEntry
+	lastSweep time.Time
+}
+
+// NewAuthLockout creates an AuthLockout allowing burst failed attempts per client, regaining one every base.
+// Returns nil, which never locks anyone out, if burst or base isn't positive.
+func NewAuthLockout(burst int, base time.Duration, max time.Duration) *AuthLockout {
+	if burst <= 0 || base <= 0 {
+		return nil
+	}
+	if max < base {
+		max = base
+	}
+	return &AuthLockout{
+		failures: NewRateLimiter(1/base.Seconds(), burst),
+		base:     base,
+		max:      max,
+		limit:    maxLockoutEntries,
+		now:      time.Now,
+		entries:  map[string]*lockoutEntry{},
+	}
+}
+
+// Locked returns how long key is still locked out for, 0 if it isn't.
+func (l *AuthLockout) Locked(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+	now := l.now()
+	if wait := entry.until.Sub(now); wait > 0 {
+		return wait
+	}
+	if now.Sub(entry.until) > l.max {
+		delete(l.entries, key)
+	}
+	return 0
+}
+
+// Failure records a failed authentication attempt of key, locking it out if it has run out of attempts.
+func (l *AuthLockout) Failure(key string) {
+	if l == nil {
+		return
+	}
+	if ok, _ := l.failures.Allow(key); ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.until) > l.max {
+		if !ok && len(l.entries) >= l.limit {
+			l.evict()
+		}
+		entry = &lockoutEntry{}
+		l.entries[key] = entry
+	}
+	lockout := l.base
+	for i := 0; i < entry.strikes && lockout < l.max; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, l.max)
+	entry.strikes++
+	entry.until = now.Add(lockout)
+}
+
+// sweep drops the entries whose lockouts are forgotten, for the clients that never came back. The lock must be held.
+func (l *AuthLockout) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < lockoutSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.entries {
+		if now.Sub(entry.until) > l.max {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// evict drops the entry that ends soonest among a few of them, to make room for another. The lock must be held.
+func (l *AuthLockout) evict() {
+	var victim string
+	var until time.Time
+	seen := 0
+	for key, entry := range l.entries {
+		if seen == 0 || entry.until.Before(until) {
+			victim, until = key, entry.until
+		}
+		if seen++; seen == lockoutEvictionSample {
+			break
+		}
+	}
+	delete(l.entries, victim)
+}
+
+// Success forgets the lockouts of key. Its failed attempts still count towards the next one.
+func (l *AuthLockout) Success(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// AuthLockoutMiddleware rejects requests from locked out clients with a 429 and a Retry-After header, and records the
+// outcome of the authentication of the others. It must run before the auth middleware.
+func AuthLockoutMiddleware(lockout *AuthLockout) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if wait := lockout.Locked(ip); wait > 0 {
+			tooManyRequests(c, wait)
+			return
+		}
+
+		c.Next()
+
+		if _, ok := c.Get(APIKeyIDContextKey); ok {
+			lockout.Success(ip)
+		} else if c.Writer.Status() == http.StatusUnauthorized {
+			lockout.Failure(ip)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.now = f.now.Add(d)
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = clock.Now
+
+	// The whole burst, then nothing until a token is back.
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("a"); !ok {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+	ok, wait := limiter.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("expected to wait 500ms, got %v %v", ok, wait)
+	}
+
+	// Other keys have their own bucket.
+	if ok, _ := limiter.Allow("b"); !ok {
+		t.Error("expected another key to be allowed")
+	}
+
+	clock.Advance(250 * time.Millisecond)
+	if ok, wait := limiter.Allow("a"); ok || wait != 250*time.Millisecond {
+		t.Errorf("expected to wait 250ms, got %v %v", ok, wait)
+	}
+	clock.Advance(250 * time.Millisecond)
+	if ok, _ := limiter.Allow("a"); !ok {
+		t.Error("expected a request to be allowed once a token is back")
+	}
+
+	// Refilled buckets are dropped.
+	clock.Advance(time.Hour)
+	limiter.Allow("c")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("expected idle buckets to be dropped, got %d", len(limiter.buckets))
+	}
+
+	// Disabled limits allow everything.
+	disabled := NewRateLimiter(0, 10)
+	if ok, _ := disabled.Allow("a"); !ok {
+		t.Error("expected a disabled limiter to allow everything")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimitMiddleware(NewRateLimiter(0.1, 2), ClientIPKey))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("192.0.2.1"); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	w := request("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "10" {
+		t.Errorf("expected to retry after 10 seconds, got %q", retry)
+	}
+	if w := request("192.0.2.2"); w.Code != http.StatusOK {
+		t.Errorf("expected another IP to be allowed, got %d", w.Code)
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	lockout := NewAuthLockout(2, time.Minute, 3*time.Minute)
+	lockout.now = clock.Now
+	lockout.failures.now = clock.Now
+
+	// fail records failures of "a" and returns how long it's locked out for.
+	fail := func(n int) time.Duration {
+		for i := 0; i < n; i++ {
+			lockout.Failure("a")
+		}
+		return lockout.Locked("a")
+	}
+
+	if wait := fail(2); wait != 0 {
+		t.Fatalf("expected no lockout yet, got %v", wait)
+	}
+	if wait := fail(1); wait != time.Minute {
+		t.Errorf("expected a 1m lockout, got %v", wait)
+	}
+	if wait := lockout.Locked("b"); wait != 0 {
+		t.Errorf("expected other clients not to be locked out, got %v", wait)
+	}
+
+	// A failure is forgiven every minute, and lockouts get twice as long up to the max.
+	clock.Advance(time.Minute)
+	if wait := fail(1); wait != 0 {
+		t.Errorf("expected the lockout to be over, got %v", wait)
+	}
+	if wait := fail(1); wait != 2*time.Minute {
+		t.Errorf("expected a 2m lockout, got %v", wait)
+	}
+	clock.Advance(2 * time.Minute)
+	if wait := fail(3); wait != 3*time.Minute {
+		t.Errorf("expected a 3m lockout, got %v", wait)
+	}
+
+	// Authenticating forgets the lockouts, but not the failures.
+	clock.Advance(3 * time.Minute)
+	fail(3)
+	lockout.Success("a")
+	if wait := fail(1); wait != time.Minute {
+		t.Errorf("expected a first lockout again, got %v", wait)
+	}
+
+	// So does staying out of trouble.
+	clock.Advance(5 * time.Minute)
+	if wait := fail(3); wait != time.Minute {
+		t.Errorf("expected a first lockout again, got %v", wait)
+	}
+}
+
+func TestAuthLockoutBounds(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	lockout := NewAuthLockout(1, time.Minute, 3*time.Minute)
+	lockout.now = clock.Now
+	lockout.failures.now = clock.Now
+	lockout.limit = 2
+
+	// lock locks key out.
+	lock := func(key string) {
+		lockout.Failure(key)
+		lockout.Failure(key)
+	}
+
+	// Clients that never come back are dropped once their lockouts are forgotten.
+	lock("a")
+	lock("b")
+	clock.Advance(5 * time.Minute)
+	lock("c")
+	if len(lockout.entries) != 1 {
+		t.Errorf("expected the forgotten lockouts to be swept, got %d entries", len(lockout.entries))
+	}
+
+	// Past the limit, the lockout that ends soonest makes room.
+	clock.Advance(time.Second)
+	lock("d")
+	clock.Advance(time.Second)
+	lock("e")
+	if len(lockout.entries) != 2 {
+		t.Errorf("expected at most 2 entries, got %d", len(lockout.entries))
+	}
+	if wait := lockout.Locked("c"); wait != 0 {
+		t.Errorf("expected the oldest lockout to be dropped, got %v", wait)
+	}
+	if wait := lockout.Locked("e"); wait != time.Minute {
+		t.Errorf("expected the new lockout to be kept, got %v", wait)
+	}
+}
+
+func TestAuthLockoutMiddleware(t *testing.T) {
+	global := &mockKV{data: map[string][]byte{string(TokenHash("valid_token")): []byte("data")}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AuthLockoutMiddleware(NewAuthLockout(2, time.Minute, time.Hour)), TokenAuthMiddleware(global))
+	r.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := request("wrong_token"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	// Locked out, even with a valid token.
+	w := request("valid_token")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("expected to retry after 60 seconds, got %q", retry)
+	}
+}
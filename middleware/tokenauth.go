@@ -1,17 +1,41 @@
 package middleware
 
 import (
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/thedeltaflyer/redirector/helpers"
 	"github.com/thedeltaflyer/redirector/models"
 )
 
+// APIKeyIDContextKey is the context key of the ID of the API key a request was authenticated with.
+const APIKeyIDContextKey = "api_key_id"
+
+// APIKeyID returns an ID for an API token that can be logged or used as a key without revealing the token.
+func APIKeyID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// TokenHash returns the key an API token is stored under in an "api_keys" bucket.
+func TokenHash(token string) []byte {
+	return sha512.New().Sum([]byte(token))
+}
+
 // TokenAuthMiddleware validates Bearer tokens using a KV store and blocks unauthorized requests.
 func TokenAuthMiddleware(kv models.KV) gin.HandlerFunc {
+	return DomainTokenAuthMiddleware(kv, nil)
+}
+
+// DomainTokenAuthMiddleware validates Bearer tokens against the global KV store and, for requests to a registered
+// domain, against that domain's own API keys. Unauthorized requests are blocked, authorized ones have the APIKeyID of
+// their token set in the context.
+func DomainTokenAuthMiddleware(kv models.KV, namespaces models.NamespaceResolver) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Grab the "Authorization" header and split it at the first space.
 		authData := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
@@ -27,11 +51,21 @@ func TokenAuthMiddleware(kv models.KV) gin.HandlerFunc {
 		}
 		// Try to get the requested auth token from the database, if it exists the token is valid.
 		// Use the SHA-512 sum so that we are not storing the actual token.
-		data, err := kv.Get(sha512.New().Sum([]byte(authData[1])))
+		hash := TokenHash(authData[1])
+		data, err := kv.Get(hash)
+		if err == nil && data == nil && namespaces != nil {
+			// Not a global token, maybe it belongs to the domain being requested.
+			var ns *models.Namespace
+			ns, err = namespaces.Resolve(helpers.NormalizeHost(c.Request.Host))
+			if err == nil && ns != nil {
+				data, err = ns.APIKeys.Get(hash)
+			}
+		}
 		if err != nil || data == nil {
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
+		c.Set(APIKeyIDContextKey, APIKeyID(authData[1]))
 		c.Next()
 	}
 }
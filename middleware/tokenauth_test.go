@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/models"
 )
 
 type mockKV struct {
@@ -30,6 +32,9 @@ func (m *mockKV) Put(key []byte, value []byte) error               { return nil
 func (m *mockKV) ExclusivePut(key []byte, value []byte) error      { return nil }
 func (m *mockKV) Replace(key []byte, value []byte) ([]byte, error) { return nil, nil }
 func (m *mockKV) Delete(key []byte) error                          { return nil }
+func (m *mockKV) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return nil
+}
 
 func TestTokenAuthMiddleware(t *testing.T) {
 	tests := []struct {
@@ -105,3 +110,78 @@ func TestTokenAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+type mockResolver map[string]*models.Namespace
+
+func (m mockResolver) Resolve(host string) (*models.Namespace, error) {
+	return m[host], nil
+}
+
+func TestDomainTokenAuthMiddleware(t *testing.T) {
+	global := &mockKV{data: map[string][]byte{string(TokenHash("global_token")): []byte("data")}}
+	resolver := mockResolver{
+		"go.team-a": {
+			Domain:  &models.Domain{Host: "go.team-a"},
+			APIKeys: &mockKV{data: map[string][]byte{string(TokenHash("team_token")): []byte("go.team-a")}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		host           string
+		token          string
+		expectedStatus int
+	}{
+		{"Global token on domain", "go.team-a", "global_token", http.StatusOK},
+		{"Global token on default namespace", "lnk.now", "global_token", http.StatusOK},
+		{"Domain token on its domain", "go.team-a:443", "team_token", http.StatusOK},
+		{"Domain token on default namespace", "lnk.now", "team_token", http.StatusUnauthorized},
+		{"Unknown token on domain", "go.team-a", "other_token", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(DomainTokenAuthMiddleware(global, resolver))
+			r.GET("/test", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Host = test.host
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestDomainTokenAuthMiddleware_APIKeyID(t *testing.T) {
+	global := &mockKV{data: map[string][]byte{string(TokenHash("global_token")): []byte("data")}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(TokenAuthMiddleware(global))
+	var id string
+	r.GET("/test", func(c *gin.Context) {
+		id = c.GetString(APIKeyIDContextKey)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer global_token")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if id != APIKeyID("global_token") || len(id) != 16 {
+		t.Errorf("expected the API key ID to be set, got %q", id)
+	}
+	if APIKeyID("global_token") == APIKeyID("other_token") {
+		t.Error("expected different tokens to have different IDs")
+	}
+}
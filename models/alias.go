@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// AliasesBucket stores the aliases of redirects, mapping each alias to the key of the redirect it stands for.
+const AliasesBucket = "aliases"
+
+// AliasKeysBucket indexes the aliases of a namespace by the key of the redirect they stand for. Entries are
+// "<key>\x00<alias>" with no value, keys never contain a NUL.
+const AliasKeysBucket = "alias_keys"
+
+// Alias is an additional key that resolves to the redirect stored under Key.
+type Alias struct {
+	Alias string `json:"alias"`
+	Key   string `json:"key"`
+}
+
+// AliasIndex keeps the reverse index of an aliases bucket in a BoltDB bucket. It is the KVIndex of the aliases bucket,
+// so the index changes in the same transaction as the aliases do.
+type AliasIndex struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// NamespaceAliases returns the KV of the aliases of the namespace of host, which keeps its reverse index up to date.
+func NamespaceAliases(db *bolt.DB, host string) *KVWrapper {
+	return &KVWrapper{
+		DB:     db,
+		Bucket: NamespaceBucket(AliasesBucket, host),
+		Index:  NamespaceAliasKeys(db, host),
+	}
+}
+
+// NamespaceAliasKeys returns the reverse index of the aliases of the namespace of host.
+func NamespaceAliasKeys(db *bolt.DB, host string) *AliasIndex {
+	return &AliasIndex{DB: db, Bucket: NamespaceBucket(AliasKeysBucket, host)}
+}
+
+// aliasEntry returns the index entry of alias under key. A nil alias returns the prefix of the entries of key.
+func aliasEntry(key []byte, alias []byte) []byte {
+	entry := append(bytes.Clone(key), 0)
+	return append(entry, alias...)
+}
+
+// Update replaces the index entry of alias, standing for oldKey, with the one of newKey, within tx.
+func (i *AliasIndex) Update(tx *bolt.Tx, alias []byte, oldKey []byte, newKey []byte) error {
+	b, err := tx.CreateBucketIfNotExists(i.Bucket)
+	if err != nil {
+		return err
+	}
+	if oldKey != nil {
+		if err := b.Delete(aliasEntry(oldKey, alias)); err != nil {
+			return err
+		}
+	}
+	if newKey != nil {
+		return b.Put(aliasEntry(newKey, alias), []byte{})
+	}
+	return nil
+}
+
+// FindAliases returns the aliases of the redirect stored under key, ordered by alias.
+func (i *AliasIndex) FindAliases(key string) ([]string, error) {
+	prefix := aliasEntry([]byte(key), nil)
+	aliases := make([]string, 0)
+	kv := &KVWrapper{DB: i.DB, Bucket: i.Bucket}
+	err := kv.Scan(prefix, func(entry []byte, _ []byte) error {
+		aliases = append(aliases, string(entry[len(prefix):]))
+		return nil
+	})
+	return aliases, err
+}
+
+// Built reports whether the index exists, it is only missing for aliases stored before it was introduced.
+func (i *AliasIndex) Built() (bool, error) {
+	return indexBuilt(i.DB, i.Bucket)
+}
+
+// Build indexes every alias stored in the aliases bucket, replacing the index if there is one.
+// Returns the number of aliases indexed.
+func (i *AliasIndex) Build(aliases []byte) (int, error) {
+	return buildIndex(i.DB, i.Bucket, aliases, i.Update)
+}
+
+// ListAliases returns the aliases in aliases ordered by alias, only those of the redirect stored under key unless key
+// is empty. A nil aliases KV has no aliases. The aliases of a key are found through the reverse index of aliases if it
+// keeps one, they're scanned for otherwise.
+func ListAliases(aliases KV, key string) ([]Alias, error) {
+	list := make([]Alias, 0)
+	if aliases == nil {
+		return list, nil
+	}
+	if wrapper, ok := aliases.(*KVWrapper); ok && key != "" {
+		if index, ok := wrapper.Index.(*AliasIndex); ok {
+			found, err := index.FindAliases(key)
+			if err != nil {
+				return nil, err
+			}
+			for _, alias := range found {
+				list = append(list, Alias{Alias: alias, Key: key})
+			}
+			return list, nil
+		}
+	}
+
+	err := aliases.Scan(nil, func(alias []byte, target []byte) error {
+		if key == "" || string(target) == key {
+			list = append(list, Alias{Alias: string(alias), Key: string(target)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Alias < list[j].Alias })
+	return list, nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListAliases(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	aliases := NamespaceAliases(db, "")
+	unindexed := &KVWrapper{DB: db, Bucket: []byte(AliasesBucket)}
+
+	t.Run("missing bucket", func(t *testing.T) {
+		list, err := ListAliases(aliases, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(list) != 0 {
+			t.Errorf("expected no aliases, got %v", list)
+		}
+	})
+
+	for alias, key := range map[string]string{"q4-report": "q4", "2026-q4": "q4", "handbook": "docs"} {
+		if err := aliases.Put([]byte(alias), []byte(key)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		aliases  KV
+		key      string
+		expected []Alias
+	}{
+		{"all", aliases, "", []Alias{{"2026-q4", "q4"}, {"handbook", "docs"}, {"q4-report", "q4"}}},
+		{"of a key", aliases, "q4", []Alias{{"2026-q4", "q4"}, {"q4-report", "q4"}}},
+		{"of a key without aliases", aliases, "blog", []Alias{}},
+		{"of a prefix of a key", aliases, "q", []Alias{}},
+		{"of a key without an index", unindexed, "q4", []Alias{{"2026-q4", "q4"}, {"q4-report", "q4"}}},
+		{"nil KV", nil, "q4", []Alias{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := ListAliases(tt.aliases, tt.key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(list, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, list)
+			}
+		})
+	}
+}
+
+func TestAliasIndex(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	aliases := NamespaceAliases(db, "go.team")
+	index := NamespaceAliasKeys(db, "go.team")
+
+	// find checks the aliases of key found through the index.
+	find := func(key string, expected ...string) {
+		t.Helper()
+		found, err := index.FindAliases(key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if expected == nil {
+			expected = []string{}
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("expected the aliases of %q to be %v, got %v", key, expected, found)
+		}
+	}
+
+	t.Run("follows the aliases", func(t *testing.T) {
+		for alias, key := range map[string]string{"q4-report": "q4", "2026-q4": "q4", "handbook": "docs"} {
+			if err := aliases.Put([]byte(alias), []byte(key)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		find("q4", "2026-q4", "q4-report")
+		find("docs", "handbook")
+
+		if err := aliases.Put([]byte("handbook"), []byte("q4")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := aliases.Delete([]byte("2026-q4")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		find("q4", "handbook", "q4-report")
+		find("docs")
+	})
+
+	t.Run("build", func(t *testing.T) {
+		legacy := &KVWrapper{DB: db, Bucket: NamespaceBucket(AliasesBucket, "")}
+		if err := legacy.Put([]byte("old"), []byte("docs")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		index := NamespaceAliasKeys(db, "")
+		if built, err := index.Built(); err != nil || built {
+			t.Fatalf("expected no index, got %v (%v)", built, err)
+		}
+		count, err := index.Build(NamespaceBucket(AliasesBucket, ""))
+		if err != nil || count != 1 {
+			t.Fatalf("expected 1 alias indexed, got %d (%v)", count, err)
+		}
+		if built, err := index.Built(); err != nil || !built {
+			t.Fatalf("expected an index, got %v (%v)", built, err)
+		}
+		found, err := index.FindAliases("docs")
+		if err != nil || !reflect.DeepEqual(found, []string{"old"}) {
+			t.Errorf("expected [old], got %v (%v)", found, err)
+		}
+	})
+}
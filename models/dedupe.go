@@ -0,0 +1,201 @@
+package models
+
+import (
+	"bytes"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DedupeBucket indexes the redirects created by each API key by their normalized URL, so that shortening the same URL
+// again can return the existing redirect. The entries of a redirect follow it as its URL changes and are dropped
+// along with it, but shortening the same URL again moves the entry to the new redirect, so entries must be checked
+// against their redirect.
+const DedupeBucket = "dedupe"
+
+// Entries of the dedupe index other than those of DedupeKey start with a NUL, which API key IDs never do:
+// "\x00<key>\x00<API key ID>", valued with the normalized URL, lists the entries of each redirect, and "\x00" alone
+// marks an index that lists them. Keys never contain a NUL.
+const dedupeBuilt = "\x00"
+
+// DedupeKey returns the key the redirect created by the API key apiKeyID for the normalized URL is indexed under.
+// API key IDs never contain a space.
+func DedupeKey(apiKeyID string, normalizedURL string) []byte {
+	return []byte(apiKeyID + " " + normalizedURL)
+}
+
+// dedupeEntry returns the entry listing the dedupe entry of the API key apiKeyID for the redirect stored under key.
+func dedupeEntry(key string, apiKeyID string) []byte {
+	return append(dedupeEntries(key), apiKeyID...)
+}
+
+// dedupeEntries returns the prefix of the entries listing the dedupe entries of the redirect stored under key.
+func dedupeEntries(key string) []byte {
+	return []byte("\x00" + key + "\x00")
+}
+
+// IndexDuplicate indexes the redirect stored under key, created by the API key apiKeyID for the normalized URL, in
+// the dedupe bucket of dedupe, which must be a KVWrapper.
+func IndexDuplicate(dedupe KV, apiKeyID string, key string, normalizedURL string) error {
+	return Atomic(func(kvs ...KV) error {
+		if err := kvs[0].Put(dedupeEntry(key, apiKeyID), []byte(normalizedURL)); err != nil {
+			return err
+		}
+		return kvs[0].Put(DedupeKey(apiKeyID, normalizedURL), []byte(key))
+	}, dedupe)
+}
+
+// RenameDuplicates moves the dedupe entries of the redirect stored under from to the key to, so that it's still found
+// once renamed.
+func RenameDuplicates(dedupe KV, from string, to string) error {
+	renamed := map[string][]byte{}
+	prefix := dedupeEntries(from)
+	err := dedupe.Scan(prefix, func(entry []byte, normalizedURL []byte) error {
+		renamed[string(entry[len(prefix):])] = bytes.Clone(normalizedURL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for apiKeyID, normalizedURL := range renamed {
+		if err := dedupe.Delete(dedupeEntry(from, apiKeyID)); err != nil {
+			return err
+		}
+		if err := dedupe.Put(dedupeEntry(to, apiKeyID), normalizedURL); err != nil {
+			return err
+		}
+		if err := dedupe.Put(DedupeKey(apiKeyID, string(normalizedURL)), []byte(to)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DedupeIndex keeps the dedupe index of a redirects bucket up to date. It is a KVIndex of the redirects bucket, so the
+// index changes in the same transaction as the redirects do. Unlike the target and term indexes, it can't be built from
+// the redirects alone, since they don't tell which API key created them.
+type DedupeIndex struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// NamespaceDedupe returns the dedupe index of the redirects of the namespace of host.
+func NamespaceDedupe(db *bolt.DB, host string) *DedupeIndex {
+	return &DedupeIndex{DB: db, Bucket: NamespaceBucket(DedupeBucket, host)}
+}
+
+// dedupeURL returns the normalized URL of the redirect stored under key as value, or "" if there is none.
+func dedupeURL(key []byte, value []byte) string {
+	if value == nil {
+		return ""
+	}
+	redirect, err := DecodeRedirect(key, value)
+	if err != nil {
+		return ""
+	}
+	return helpers.NormalizeURL(redirect.URL)
+}
+
+// Update moves the dedupe entries of the redirect stored under key as oldValue to the URL of newValue, within tx.
+// They're dropped if newValue is nil.
+func (i *DedupeIndex) Update(tx *bolt.Tx, key []byte, oldValue []byte, newValue []byte) error {
+	oldURL, newURL := dedupeURL(key, oldValue), dedupeURL(key, newValue)
+	if oldURL == newURL {
+		return nil
+	}
+	b := tx.Bucket(i.Bucket)
+	if b == nil {
+		return nil
+	}
+
+	prefix := dedupeEntries(string(key))
+	var apiKeyIDs []string
+	c := b.Cursor()
+	for entry, _ := c.Seek(prefix); entry != nil && bytes.HasPrefix(entry, prefix); entry, _ = c.Next() {
+		apiKeyIDs = append(apiKeyIDs, string(entry[len(prefix):]))
+	}
+	for _, apiKeyID := range apiKeyIDs {
+		// Another redirect of the API key may have been created for the URL since.
+		if oldURL != "" && bytes.Equal(b.Get(DedupeKey(apiKeyID, oldURL)), key) {
+			if err := b.Delete(DedupeKey(apiKeyID, oldURL)); err != nil {
+				return err
+			}
+		}
+		if newURL == "" {
+			if err := b.Delete(dedupeEntry(string(key), apiKeyID)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := b.Put(dedupeEntry(string(key), apiKeyID), []byte(newURL)); err != nil {
+			return err
+		}
+		if err := b.Put(DedupeKey(apiKeyID, newURL), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Built reports whether the index lists the entries of each redirect, it only doesn't for redirects deduplicated
+// before it did.
+func (i *DedupeIndex) Built() (bool, error) {
+	built := false
+	err := i.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(i.Bucket)
+		built = b != nil && b.Get([]byte(dedupeBuilt)) != nil
+		return nil
+	})
+	return built, err
+}
+
+// Build lists the entries of each redirect of the redirects bucket, dropping those that don't lead to their redirect
+// anymore. Returns the number of redirects indexed.
+func (i *DedupeIndex) Build(redirects []byte) (int, error) {
+	count := 0
+	err := i.DB.Update(func(tx *bolt.Tx) error {
+		count = 0
+		b, err := tx.CreateBucketIfNotExists(i.Bucket)
+		if err != nil {
+			return err
+		}
+		r := tx.Bucket(redirects)
+
+		type entry struct{ apiKeyID, normalizedURL, key string }
+		var kept []entry
+		var stale [][]byte
+		err = b.ForEach(func(k []byte, v []byte) error {
+			if bytes.HasPrefix(k, []byte("\x00")) {
+				stale = append(stale, bytes.Clone(k))
+				return nil
+			}
+			apiKeyID, normalizedURL, _ := bytes.Cut(k, []byte(" "))
+			if r != nil && dedupeURL(v, r.Get(v)) == string(normalizedURL) {
+				kept = append(kept, entry{string(apiKeyID), string(normalizedURL), string(v)})
+			} else {
+				stale = append(stale, bytes.Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		keys := map[string]bool{}
+		for _, e := range kept {
+			if err := b.Put(dedupeEntry(e.key, e.apiKeyID), []byte(e.normalizedURL)); err != nil {
+				return err
+			}
+			keys[e.key] = true
+		}
+		count = len(keys)
+		return b.Put([]byte(dedupeBuilt), []byte{})
+	})
+	return count, err
+}
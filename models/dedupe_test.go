@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+)
+
+func TestDedupeKey(t *testing.T) {
+	if got := string(DedupeKey("0123abcd", "https://example.com/")); got != "0123abcd https://example.com/" {
+		t.Errorf("unexpected key %q", got)
+	}
+	if got := string(DedupeKey("", "https://example.com/")); got != " https://example.com/" {
+		t.Errorf("unexpected key %q", got)
+	}
+}
+
+func TestDedupeIndex(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	redirects := NamespaceRedirects(db, "")
+	dedupe := &KVWrapper{DB: db, Bucket: []byte(DedupeBucket)}
+	index := NamespaceDedupe(db, "")
+
+	indexed := func(apiKeyID string, target string) string {
+		t.Helper()
+		key, err := dedupe.Get(DedupeKey(apiKeyID, helpers.NormalizeURL(target)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(key)
+	}
+
+	// Entries stored before the index listed them are kept if they still lead to their redirect.
+	for key, target := range map[string]string{"blog": "https://example.com/blog", "docs": "https://example.com/docs"} {
+		if err := redirects.Put([]byte(key), []byte(target)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	for entry, key := range map[string]string{"a https://example.com/blog": "blog", "a https://example.com/old": "docs"} {
+		if err := dedupe.Put([]byte(entry), []byte(key)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if built, err := index.Built(); err != nil || built {
+		t.Fatalf("expected the index not to be built, got %v (%v)", built, err)
+	}
+	count, err := index.Build(NamespaceBucket(RedirectsBucket, ""))
+	if err != nil || count != 1 {
+		t.Fatalf("expected 1 redirect to be indexed, got %d (%v)", count, err)
+	}
+	if built, err := index.Built(); err != nil || !built {
+		t.Errorf("expected the index to be built, got %v (%v)", built, err)
+	}
+	if got := indexed("a", "https://example.com/old"); got != "" {
+		t.Errorf("expected the stale entry to be dropped, got %q", got)
+	}
+
+	// Entries follow their redirect to its new URL.
+	if err := IndexDuplicate(dedupe, "b", "docs", helpers.NormalizeURL("https://example.com/docs")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for key, target := range map[string]string{"blog": "https://example.com/journal", "docs": "https://example.com/guide"} {
+		if err := redirects.Put([]byte(key), []byte(target)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := indexed("a", "https://example.com/journal"); got != "blog" {
+		t.Errorf("expected blog to be found at its new URL, got %q", got)
+	}
+	if got := indexed("b", "https://example.com/guide"); got != "docs" {
+		t.Errorf("expected docs to be found at its new URL, got %q", got)
+	}
+	if got := indexed("b", "https://example.com/docs"); got != "" {
+		t.Errorf("expected docs not to be found at its old URL, got %q", got)
+	}
+
+	// And its key, once renamed.
+	migration, err := PlanKeyMigration(redirects, nil, strings.ToUpper)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := migration.Apply(redirects, nil, nil, dedupe); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := indexed("b", "https://example.com/guide"); got != "DOCS" {
+		t.Errorf("expected docs to be found under its new key, got %q", got)
+	}
+
+	// They're dropped along with it.
+	if err := redirects.Delete([]byte("DOCS")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := indexed("b", "https://example.com/guide"); got != "" {
+		t.Errorf("expected the entry to be dropped, got %q", got)
+	}
+	err = dedupe.Scan([]byte("\x00DOCS\x00"), func(entry []byte, _ []byte) error {
+		t.Errorf("expected no entries left for DOCS, got %q", entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+// Domain represents a vanity host served by the redirector with its own link namespace.
+// The Host field is the normalized request host (no port) the domain answers for.
+// RootText replaces the default root page text, and QRDefaults provides fallback `/qr` query parameters for the domain.
+// FallbackURL, if set, is where unknown keys are redirected to instead of the global fallback; "{key}" is replaced with
+// the requested key.
+type Domain struct {
+	Host        string            `json:"host" binding:"required,hostname_rfc1123"`
+	RootText    string            `json:"root_text,omitempty"`
+	QRDefaults  map[string]string `json:"qr_defaults,omitempty"`
+	FallbackURL string            `json:"fallback_url,omitempty" binding:"omitempty,url"`
+}
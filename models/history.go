@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HistoryBucket records the changes made to the destination of redirects by bulk operations.
+const HistoryBucket = "history"
+
+// Reasons for changes.
+const (
+	ChangeRetarget = "retarget"
+)
+
+// historyTimeFormat orders the changes of a key by time, unlike time.RFC3339Nano which trims trailing zeros.
+const historyTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Change is a change of the URL of the redirect stored under Key.
+type Change struct {
+	Key    string    `json:"key"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// historyKey returns the key change is recorded under, so that the changes of a key are listed in order.
+// Keys never contain a NUL.
+func historyKey(change Change) []byte {
+	return []byte(change.Key + "\x00" + change.Time.UTC().Format(historyTimeFormat))
+}
+
+// RecordChange adds change to history.
+func RecordChange(history KV, change Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return history.Put(historyKey(change), data)
+}
+
+// ListHistory returns the changes recorded in history for the redirect stored under key, oldest first.
+// A nil history KV has no changes.
+func ListHistory(history KV, key string) ([]Change, error) {
+	changes := make([]Change, 0)
+	if history == nil {
+		return changes, nil
+	}
+	err := history.Scan([]byte(key+"\x00"), func(_ []byte, value []byte) error {
+		var change Change
+		if err := json.Unmarshal(value, &change); err != nil {
+			return err
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
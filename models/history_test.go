@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	history := &KVWrapper{DB: db, Bucket: []byte(HistoryBucket)}
+	changes := []Change{
+		{Key: "docs", From: "https://a.example.com", To: "https://b.example.com", Reason: ChangeRetarget},
+		{Key: "docs", From: "https://b.example.com", To: "https://c.example.com", Reason: ChangeRetarget},
+		{Key: "docs2", From: "https://a.example.com", To: "https://b.example.com", Reason: ChangeRetarget},
+	}
+	for i, change := range changes {
+		change.Time = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * 100 * time.Millisecond)
+		if err := RecordChange(history, change); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	list, err := ListHistory(history, "docs")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 2 || list[0].To != "https://b.example.com" || list[1].To != "https://c.example.com" {
+		t.Errorf("unexpected history: %+v", list)
+	}
+	if list, err := ListHistory(nil, "docs"); err != nil || len(list) != 0 {
+		t.Errorf("expected no history, got %+v (%v)", list, err)
+	}
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// KeyRename is a key stored as something else than what it normalizes to. Alias is set for the keys of aliases.
+type KeyRename struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Alias bool   `json:"alias,omitempty"`
+}
+
+// KeyCollision is a group of keys that normalize to the same key, only one of which can be found once keys are
+// normalized.
+type KeyCollision struct {
+	Key  string   `json:"key"`
+	Keys []string `json:"keys"`
+}
+
+// KeyMigration lists what it takes for the keys of a namespace to be stored the way they normalize to.
+type KeyMigration struct {
+	Renames    []KeyRename    `json:"renames"`
+	Collisions []KeyCollision `json:"collisions"`
+}
+
+// PlanKeyMigration works out which keys of redirects and aliases have to be renamed once keys are normalized by
+// normalize, and which collide with each other. Redirects and aliases share the keys of a namespace, so a redirect and
+// an alias that normalize to the same key collide too. A nil aliases KV has no aliases. Nothing is changed.
+func PlanKeyMigration(redirects KV, aliases KV, normalize func(string) string) (*KeyMigration, error) {
+	groups := map[string][]KeyRename{}
+	scan := func(kv KV, alias bool) error {
+		if kv == nil {
+			return nil
+		}
+		return kv.Scan(nil, func(key []byte, _ []byte) error {
+			normalized := normalize(string(key))
+			groups[normalized] = append(groups[normalized], KeyRename{From: string(key), To: normalized, Alias: alias})
+			return nil
+		})
+	}
+	if err := scan(redirects, false); err != nil {
+		return nil, err
+	}
+	if err := scan(aliases, true); err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, 0, len(groups))
+	for key := range groups {
+		normalized = append(normalized, key)
+	}
+	sort.Strings(normalized)
+
+	migration := &KeyMigration{Renames: make([]KeyRename, 0), Collisions: make([]KeyCollision, 0)}
+	for _, key := range normalized {
+		renames := groups[key]
+		if len(renames) > 1 {
+			keys := make([]string, 0, len(renames))
+			for _, rename := range renames {
+				keys = append(keys, rename.From)
+			}
+			sort.Strings(keys)
+			migration.Collisions = append(migration.Collisions, KeyCollision{Key: key, Keys: keys})
+		} else if renames[0].From != key {
+			migration.Renames = append(migration.Renames, renames[0])
+		}
+	}
+	return migration, nil
+}
+
+// Apply renames the keys of the migration in redirects and aliases, moves the logos and dedupe entries of redirects
+// along if logos and dedupe aren't nil, and points the aliases of renamed redirects at their new keys. Everything is
+// renamed in a single transaction, so redirects, logos, aliases, and dedupe must be KVWrappers of the same database, or
+// nil for all but redirects. It refuses to if any keys collide, they have to be resolved by hand first.
+func (m *KeyMigration) Apply(redirects KV, logos KV, aliases KV, dedupe KV) error {
+	if len(m.Collisions) > 0 {
+		return fmt.Errorf("%d normalized keys are shared by several keys, resolve them first", len(m.Collisions))
+	}
+
+	return Atomic(func(kvs ...KV) error {
+		redirects, logos, aliases, dedupe := kvs[0], kvs[1], kvs[2], kvs[3]
+		renamed := map[string]string{}
+		for _, rename := range m.Renames {
+			if rename.Alias {
+				if err := renameKey(aliases, rename); err != nil {
+					return err
+				}
+				continue
+			}
+			// Entries are moved first, the index of the redirects drops those left under the old key.
+			if dedupe != nil {
+				if err := RenameDuplicates(dedupe, rename.From, rename.To); err != nil {
+					return err
+				}
+			}
+			if err := renameKey(redirects, rename); err != nil {
+				return err
+			}
+			if logos != nil {
+				if err := renameKey(logos, rename); err != nil {
+					return err
+				}
+			}
+			renamed[rename.From] = rename.To
+		}
+		if aliases == nil || len(renamed) == 0 {
+			return nil
+		}
+		return retargetAliases(aliases, renamed)
+	}, redirects, logos, aliases, dedupe)
+}
+
+// renameKey moves the value of rename.From to rename.To, if there is one. Returns an AlreadyExistsError if rename.To
+// was created in the meantime.
+func renameKey(kv KV, rename KeyRename) error {
+	value, err := kv.Get([]byte(rename.From))
+	if err != nil || value == nil {
+		return err
+	}
+	if err := kv.ExclusivePut([]byte(rename.To), value); err != nil {
+		return err
+	}
+	return kv.Delete([]byte(rename.From))
+}
+
+// retargetAliases points the aliases of the redirects renamed from the keys of renamed to their new keys.
+func retargetAliases(aliases KV, renamed map[string]string) error {
+	retargeted := map[string]string{}
+	err := aliases.Scan(nil, func(alias []byte, key []byte) error {
+		if to, ok := renamed[string(key)]; ok {
+			retargeted[string(alias)] = to
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for alias, key := range retargeted {
+		if err := aliases.Put([]byte(alias), []byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
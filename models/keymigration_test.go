@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+)
+
+func TestPlanKeyMigration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	setupBucket(t, db, []byte("redirects"))
+	redirects := &KVWrapper{DB: db, Bucket: []byte("redirects")}
+	for _, key := range []string{"launch", "Launch", "LAUNCH", "Docs", "blog", "News"} {
+		if err := redirects.Put([]byte(key), []byte("https://example.com/"+key)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	migration, err := PlanKeyMigration(redirects, nil, strings.ToLower)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantRenames := []KeyRename{{From: "Docs", To: "docs"}, {From: "News", To: "news"}}
+	if !reflect.DeepEqual(migration.Renames, wantRenames) {
+		t.Errorf("expected renames %v, got %v", wantRenames, migration.Renames)
+	}
+	wantCollisions := []KeyCollision{{Key: "launch", Keys: []string{"LAUNCH", "Launch", "launch"}}}
+	if !reflect.DeepEqual(migration.Collisions, wantCollisions) {
+		t.Errorf("expected collisions %v, got %v", wantCollisions, migration.Collisions)
+	}
+
+	if err := migration.Apply(redirects, nil, nil, nil); err == nil {
+		t.Error("expected colliding keys to be refused")
+	}
+	if value, _ := redirects.Get([]byte("Docs")); value == nil {
+		t.Error("expected nothing to be renamed")
+	}
+}
+
+func TestKeyMigration_Apply(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	setupBucket(t, db, []byte("redirects"))
+	setupBucket(t, db, []byte("logos"))
+	redirects := &KVWrapper{DB: db, Bucket: []byte("redirects")}
+	logos := &KVWrapper{DB: db, Bucket: []byte("logos")}
+	for key, value := range map[string]string{"Docs": "https://example.com/docs", "blog": "https://example.com/blog"} {
+		if err := redirects.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if err := logos.Put([]byte("Docs"), []byte("logo")); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	migration, err := PlanKeyMigration(redirects, nil, strings.ToLower)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := migration.Apply(redirects, logos, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if value, _ := redirects.Get([]byte("docs")); string(value) != "https://example.com/docs" {
+		t.Errorf("expected docs to be renamed, got %q", value)
+	}
+	if value, _ := redirects.Get([]byte("Docs")); value != nil {
+		t.Errorf("expected Docs to be gone, got %q", value)
+	}
+	if value, _ := redirects.Get([]byte("blog")); string(value) != "https://example.com/blog" {
+		t.Errorf("expected blog to be left as is, got %q", value)
+	}
+	if value, _ := logos.Get([]byte("docs")); string(value) != "logo" {
+		t.Errorf("expected the logo to be moved, got %q", value)
+	}
+
+	t.Run("created in the meantime", func(t *testing.T) {
+		if err := redirects.Put([]byte("News"), []byte("https://example.com/news")); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		migration, err := PlanKeyMigration(redirects, nil, strings.ToLower)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := redirects.Put([]byte("news"), []byte("https://example.com/other")); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		var ae *helpers.AlreadyExistsError
+		if err := migration.Apply(redirects, logos, nil, nil); !errors.As(err, &ae) {
+			t.Errorf("expected an AlreadyExistsError, got %v", err)
+		}
+		if value, _ := redirects.Get([]byte("News")); value == nil {
+			t.Error("expected nothing to be renamed")
+		}
+	})
+}
+
+func TestKeyMigration_Aliases(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	setupBucket(t, db, []byte("redirects"))
+	setupBucket(t, db, []byte("aliases"))
+	redirects := &KVWrapper{DB: db, Bucket: []byte("redirects")}
+	aliases := &KVWrapper{DB: db, Bucket: []byte("aliases")}
+	if err := redirects.Put([]byte("Docs"), []byte("https://example.com/docs")); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	for alias, key := range map[string]string{"manual": "Docs", "Guide": "Docs"} {
+		if err := aliases.Put([]byte(alias), []byte(key)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	migration, err := PlanKeyMigration(redirects, aliases, strings.ToLower)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantRenames := []KeyRename{{From: "Docs", To: "docs"}, {From: "Guide", To: "guide", Alias: true}}
+	if !reflect.DeepEqual(migration.Renames, wantRenames) {
+		t.Errorf("expected renames %v, got %v", wantRenames, migration.Renames)
+	}
+	if err := migration.Apply(redirects, nil, aliases, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if value, _ := redirects.Get([]byte("docs")); string(value) != "https://example.com/docs" {
+		t.Errorf("expected docs to be renamed, got %q", value)
+	}
+	if value, _ := aliases.Get([]byte("Guide")); value != nil {
+		t.Errorf("expected Guide to be gone, got %q", value)
+	}
+	for _, alias := range []string{"manual", "guide"} {
+		if value, _ := aliases.Get([]byte(alias)); string(value) != "docs" {
+			t.Errorf("expected %s to lead to docs, got %q", alias, value)
+		}
+	}
+
+	t.Run("alias colliding with a redirect", func(t *testing.T) {
+		if err := redirects.Put([]byte("News"), []byte("https://example.com/news")); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if err := aliases.Put([]byte("news"), []byte("docs")); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		migration, err := PlanKeyMigration(redirects, aliases, strings.ToLower)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		wantCollisions := []KeyCollision{{Key: "news", Keys: []string{"News", "news"}}}
+		if !reflect.DeepEqual(migration.Collisions, wantCollisions) {
+			t.Errorf("expected collisions %v, got %v", wantCollisions, migration.Collisions)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"bytes"
+	"errors"
+
 	"github.com/thedeltaflyer/redirector/helpers"
 
 	bolt "go.etcd.io/bbolt"
@@ -13,12 +16,72 @@ type KV interface {
 	ExclusivePut(key []byte, value []byte) error
 	Replace(key []byte, value []byte) ([]byte, error)
 	Delete(key []byte) error
+	Scan(prefix []byte, fn func(key []byte, value []byte) error) error
+}
+
+// KVIndex maintains a secondary index of a bucket. Update is called within the transaction of every write to the
+// bucket, with the previous and the new value of key, either of which is nil if there is none.
+type KVIndex interface {
+	Update(tx *bolt.Tx, key []byte, oldValue []byte, newValue []byte) error
+}
+
+// KVIndexes is a KVIndex keeping several indexes of the same bucket up to date.
+type KVIndexes []KVIndex
+
+// Update updates every index in order.
+func (indexes KVIndexes) Update(tx *bolt.Tx, key []byte, oldValue []byte, newValue []byte) error {
+	for _, index := range indexes {
+		if err := index.Update(tx, key, oldValue, newValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBuilt reports whether the bucket of an index exists.
+func indexBuilt(db *bolt.DB, indexBucket []byte) (bool, error) {
+	built := false
+	err := db.View(func(tx *bolt.Tx) error {
+		built = tx.Bucket(indexBucket) != nil
+		return nil
+	})
+	return built, err
+}
+
+// buildIndex replaces the bucket of an index with one indexing every key of bucket through update.
+// Returns the number of keys indexed.
+func buildIndex(db *bolt.DB, indexBucket []byte, bucket []byte, update func(tx *bolt.Tx, key []byte, oldValue []byte,
+	newValue []byte) error) (int, error) {
+	count := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		count = 0
+		if tx.Bucket(indexBucket) != nil {
+			if err := tx.DeleteBucket(indexBucket); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket(indexBucket); err != nil {
+			return err
+		}
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key []byte, value []byte) error {
+			count++
+			return update(tx, key, nil, value)
+		})
+	})
+	return count, err
 }
 
 // KVWrapper provides a wrapper around a BoltDB instance and a specific bucket for key-value operations using the KV interface.
+// The bucket is created on the first write, reads against a missing bucket behave as if it were empty.
+// Index (optional) is kept up to date along with the bucket.
 type KVWrapper struct {
 	DB     *bolt.DB
 	Bucket []byte
+	Index  KVIndex
 }
 
 // Get retrieves the value associated with the provided key from the underlying BoltDB bucket.
@@ -26,9 +89,9 @@ type KVWrapper struct {
 func (kv *KVWrapper) Get(key []byte) ([]byte, error) {
 	var value []byte
 	err := kv.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(kv.Bucket)
-		value = b.Get(key)
-		return nil
+		var err error
+		value, err = kv.tx(tx).Get(key)
+		return err
 	})
 	return value, err
 }
@@ -36,9 +99,7 @@ func (kv *KVWrapper) Get(key []byte) ([]byte, error) {
 // Put inserts or updates the specified key-value pair in the BoltDB bucket. Returns an error if the operation fails.
 func (kv *KVWrapper) Put(key []byte, value []byte) error {
 	return kv.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(kv.Bucket)
-		err := b.Put(key, value)
-		return err
+		return kv.tx(tx).Put(key, value)
 	})
 }
 
@@ -47,13 +108,7 @@ func (kv *KVWrapper) Put(key []byte, value []byte) error {
 // Returns an error if the operation fails.
 func (kv *KVWrapper) ExclusivePut(key []byte, value []byte) error {
 	return kv.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(kv.Bucket)
-		testVal := b.Get(key)
-		if testVal != nil {
-			return helpers.NewAlreadyExistsError(key)
-		}
-		err := b.Put(key, value)
-		return err
+		return kv.tx(tx).ExclusivePut(key, value)
 	})
 }
 
@@ -61,12 +116,8 @@ func (kv *KVWrapper) ExclusivePut(key []byte, value []byte) error {
 func (kv *KVWrapper) Replace(key []byte, value []byte) ([]byte, error) {
 	var oldVal []byte
 	err := kv.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(kv.Bucket)
-		oldVal = b.Get(key)
-		if oldVal == nil {
-			return helpers.NewDoesNotExistError(key)
-		}
-		err := b.Put(key, value)
+		var err error
+		oldVal, err = kv.tx(tx).Replace(key, value)
 		return err
 	})
 	return oldVal, err
@@ -75,11 +126,164 @@ func (kv *KVWrapper) Replace(key []byte, value []byte) ([]byte, error) {
 // Delete removes the specified key from the BoltDB bucket. Returns a DoesNotExistError if the key does not exist.
 func (kv *KVWrapper) Delete(key []byte) error {
 	return kv.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(kv.Bucket)
-		oldVal := b.Get(key)
-		if oldVal == nil {
-			return helpers.NewDoesNotExistError(key)
+		return kv.tx(tx).Delete(key)
+	})
+}
+
+// Scan calls fn for every key-value pair in the bucket whose key starts with prefix, in key order.
+// Iteration stops at the first error returned by fn, which is passed back to the caller.
+func (kv *KVWrapper) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return kv.DB.View(func(tx *bolt.Tx) error {
+		return kv.tx(tx).Scan(prefix, fn)
+	})
+}
+
+// Count returns the number of keys in the bucket, read from the statistics of the bucket rather than by scanning it.
+func (kv *KVWrapper) Count() (int, error) {
+	count := 0
+	err := kv.DB.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(kv.Bucket); b != nil {
+			count = b.Stats().KeyN
+		}
+		return nil
+	})
+	return count, err
+}
+
+// CountKeys returns the number of keys of kv, which is scanned unless it can count its keys itself. A nil KV has none.
+func CountKeys(kv KV) (int, error) {
+	if kv == nil {
+		return 0, nil
+	}
+	if counter, ok := kv.(interface{ Count() (int, error) }); ok {
+		return counter.Count()
+	}
+	count := 0
+	err := kv.Scan(nil, func([]byte, []byte) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// tx returns the KV of the bucket within tx.
+func (kv *KVWrapper) tx(tx *bolt.Tx) *txKV {
+	return &txKV{kv: kv, tx: tx}
+}
+
+// Atomic calls fn with kvs bound to a single read-write transaction, so that either every write fn makes is applied,
+// if it returns nil, or none is. Values read within fn are only valid until it returns. kvs must all be KVWrappers of
+// the same database, or nil, which are passed on as nil.
+func Atomic(fn func(kvs ...KV) error, kvs ...KV) error {
+	var db *bolt.DB
+	wrappers := make([]*KVWrapper, len(kvs))
+	for i, kv := range kvs {
+		if kv == nil {
+			continue
+		}
+		wrapper, ok := kv.(*KVWrapper)
+		if !ok || (db != nil && wrapper.DB != db) {
+			return errors.New("atomic operations require KVWrappers of the same database")
+		}
+		db, wrappers[i] = wrapper.DB, wrapper
+	}
+	if db == nil {
+		return fn(kvs...)
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bound := make([]KV, len(wrappers))
+		for i, wrapper := range wrappers {
+			if wrapper != nil {
+				bound[i] = wrapper.tx(tx)
+			}
 		}
-		return b.Delete(key)
+		return fn(bound...)
 	})
 }
+
+// txKV is the KV of the bucket of a KVWrapper within a transaction, writes require a read-write transaction.
+type txKV struct {
+	kv *KVWrapper
+	tx *bolt.Tx
+}
+
+// index updates the index of the bucket, if there is one, for a write of key.
+func (t *txKV) index(key []byte, oldValue []byte, newValue []byte) error {
+	if t.kv.Index == nil {
+		return nil
+	}
+	return t.kv.Index.Update(t.tx, key, oldValue, newValue)
+}
+
+func (t *txKV) Get(key []byte) ([]byte, error) {
+	b := t.tx.Bucket(t.kv.Bucket)
+	if b == nil {
+		return nil, nil
+	}
+	return b.Get(key), nil
+}
+
+func (t *txKV) Put(key []byte, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists(t.kv.Bucket)
+	if err != nil {
+		return err
+	}
+	if err := t.index(key, b.Get(key), value); err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+func (t *txKV) ExclusivePut(key []byte, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists(t.kv.Bucket)
+	if err != nil {
+		return err
+	}
+	if b.Get(key) != nil {
+		return helpers.NewAlreadyExistsError(key)
+	}
+	if err := t.index(key, nil, value); err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+func (t *txKV) Replace(key []byte, value []byte) ([]byte, error) {
+	var oldVal []byte
+	b := t.tx.Bucket(t.kv.Bucket)
+	if b != nil {
+		oldVal = b.Get(key)
+	}
+	if oldVal == nil {
+		return nil, helpers.NewDoesNotExistError(key)
+	}
+	if err := t.index(key, oldVal, value); err != nil {
+		return nil, err
+	}
+	return oldVal, b.Put(key, value)
+}
+
+func (t *txKV) Delete(key []byte) error {
+	b := t.tx.Bucket(t.kv.Bucket)
+	if b == nil || b.Get(key) == nil {
+		return helpers.NewDoesNotExistError(key)
+	}
+	if err := t.index(key, b.Get(key), nil); err != nil {
+		return err
+	}
+	return b.Delete(key)
+}
+
+func (t *txKV) Scan(prefix []byte, fn func(key []byte, value []byte) error) error {
+	b := t.tx.Bucket(t.kv.Bucket)
+	if b == nil {
+		return nil
+	}
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
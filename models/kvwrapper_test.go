@@ -1,7 +1,10 @@
 package models
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/thedeltaflyer/redirector/helpers"
@@ -524,3 +527,157 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestMissingBucket(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kv := &KVWrapper{
+		DB:     db,
+		Bucket: []byte("missingBucket"),
+	}
+
+	value, err := kv.Get([]byte("key1"))
+	if err != nil || value != nil {
+		t.Fatalf("expected nil value and error, got %q, %v", value, err)
+	}
+
+	if _, err := kv.Replace([]byte("key1"), []byte("value1")); err == nil {
+		t.Fatal("expected error replacing in missing bucket")
+	}
+
+	if err := kv.Delete([]byte("key1")); err == nil {
+		t.Fatal("expected error deleting from missing bucket")
+	}
+
+	if err := kv.ExclusivePut([]byte("key1"), []byte("value1")); err != nil {
+		t.Fatalf("expected bucket to be created, got %v", err)
+	}
+
+	value, err = kv.Get([]byte("key1"))
+	if err != nil || string(value) != "value1" {
+		t.Fatalf("expected %q, got %q, %v", "value1", value, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	bucket := []byte("testBucket")
+	setupBucket(t, db, bucket)
+
+	kv := &KVWrapper{
+		DB:     db,
+		Bucket: bucket,
+	}
+
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		if err := kv.Put([]byte(key), []byte("v-"+key)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		prefix   []byte
+		expected []string
+	}{
+		{name: "all keys", prefix: nil, expected: []string{"a/1", "a/2", "b/1"}},
+		{name: "prefix", prefix: []byte("a/"), expected: []string{"a/1", "a/2"}},
+		{name: "no match", prefix: []byte("c/"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			err := kv.Scan(tt.prefix, func(key []byte, value []byte) error {
+				if string(value) != "v-"+string(key) {
+					t.Errorf("unexpected value %q for key %q", value, key)
+				}
+				keys = append(keys, string(key))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected keys %v, got %v", tt.expected, keys)
+			}
+		})
+	}
+}
+
+func TestCountKeys(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	kv := &KVWrapper{DB: db, Bucket: []byte("testBucket")}
+	if count, err := CountKeys(kv); err != nil || count != 0 {
+		t.Fatalf("expected no keys in a missing bucket, got %d, %v", count, err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := kv.Put([]byte(key), []byte("v")); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if err := kv.Delete([]byte("b")); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if count, err := CountKeys(kv); err != nil || count != 2 {
+		t.Errorf("expected 2 keys, got %d, %v", count, err)
+	}
+	if count, err := CountKeys(nil); err != nil || count != 0 {
+		t.Errorf("expected no keys in a nil KV, got %d, %v", count, err)
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	first := &KVWrapper{DB: db, Bucket: []byte("first")}
+	second := &KVWrapper{DB: db, Bucket: []byte("second")}
+
+	// Either every write is applied...
+	err := Atomic(func(kvs ...KV) error {
+		if err := kvs[0].Put([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		value, err := kvs[0].Get([]byte("a"))
+		if err != nil || string(value) != "1" {
+			t.Errorf("expected the write to be visible within the transaction, got %q (%v)", value, err)
+		}
+		return kvs[1].Put([]byte("b"), []byte("2"))
+	}, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value, _ := second.Get([]byte("b")); string(value) != "2" {
+		t.Errorf("expected the write to be applied, got %q", value)
+	}
+
+	// ...or none is.
+	err = Atomic(func(kvs ...KV) error {
+		if _, err := kvs[0].Replace([]byte("a"), []byte("3")); err != nil {
+			return err
+		}
+		return kvs[1].ExclusivePut([]byte("b"), []byte("4"))
+	}, first, second)
+	var ae *helpers.AlreadyExistsError
+	if !errors.As(err, &ae) {
+		t.Fatalf("expected AlreadyExistsError, got %v", err)
+	}
+	if value, _ := first.Get([]byte("a")); string(value) != "1" {
+		t.Errorf("expected the write to be rolled back, got %q", value)
+	}
+
+	other, err := bolt.Open(filepath.Join(t.TempDir(), "other.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	defer other.Close()
+	if err := Atomic(func(kvs ...KV) error { return nil }, first, &KVWrapper{DB: other, Bucket: []byte("first")}); err == nil {
+		t.Error("expected an error for KVs of different databases")
+	}
+}
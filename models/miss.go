@@ -0,0 +1,230 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MissesBucket stores the keys that were requested but don't exist.
+const MissesBucket = "misses"
+
+// Miss summarizes the lookups of a key that doesn't exist.
+type Miss struct {
+	Key      string    `json:"key"`
+	Count    uint64    `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// MissRecorder records and lists lookups of keys that don't exist.
+type MissRecorder interface {
+	Record(key []byte) error
+	List() ([]Miss, error)
+}
+
+// Defaults of MissBuffer.
+const (
+	DefaultMaxMissKeys       = 10000
+	DefaultMissFlushInterval = 10 * time.Second
+)
+
+// MissLog is a MissRecorder that keeps a counter per key in a bucket of the database of its MissBuffer.
+type MissLog struct {
+	Buffer *MissBuffer
+	Bucket []byte
+}
+
+// Record counts a miss of key, it's written to the database along with the others when the buffer is flushed.
+func (m *MissLog) Record(key []byte) error {
+	return m.Buffer.Record(m.Bucket, key)
+}
+
+// MissBuffer counts the misses of MissLogs in memory, and writes them to DB in a single transaction every
+// FlushInterval, so that lookups of unknown keys don't each write to the database. Flushing starts with the first miss
+// and stops with Close, which flushes what's left; misses counted since the last flush are lost if the process exits
+// without it. Only MaxKeys keys are counted per bucket, misses of other keys are dropped, so that requests for random
+// keys can't fill the database.
+type MissBuffer struct {
+	DB            *bolt.DB
+	MaxKeys       int           // Keys counted per bucket, DefaultMaxMissKeys if 0
+	FlushInterval time.Duration // DefaultMissFlushInterval if 0
+
+	mu      sync.Mutex
+	pending map[string]map[string]*Miss
+	stop    chan struct{} // Closed to stop flushing, nil if it isn't running
+	done    chan struct{} // Closed once flushing stopped
+	closed  bool
+}
+
+// maxKeys returns the number of keys counted per bucket.
+func (b *MissBuffer) maxKeys() int {
+	if b.MaxKeys > 0 {
+		return b.MaxKeys
+	}
+	return DefaultMaxMissKeys
+}
+
+// counts returns the misses counted in bucket since the last flush. The lock must be held.
+func (b *MissBuffer) counts(bucket string) map[string]*Miss {
+	if b.pending == nil {
+		b.pending = map[string]map[string]*Miss{}
+	}
+	misses := b.pending[bucket]
+	if misses == nil {
+		misses = map[string]*Miss{}
+		b.pending[bucket] = misses
+	}
+	return misses
+}
+
+// Record counts a miss of key in bucket, and starts flushing the buffer if it isn't yet. It never fails, the error is
+// that of MissRecorder.
+func (b *MissBuffer) Record(bucket []byte, key []byte) error {
+	now := time.Now().UTC()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop == nil && !b.closed {
+		b.start()
+	}
+	misses := b.counts(string(bucket))
+	if miss := misses[string(key)]; miss != nil {
+		miss.Count++
+		miss.LastSeen = now
+	} else if len(misses) < b.maxKeys() {
+		misses[string(key)] = &Miss{Key: string(key), Count: 1, LastSeen: now}
+	}
+	return nil
+}
+
+// start flushes the buffer every FlushInterval in the background until Close is called. The lock must be held.
+func (b *MissBuffer) start() {
+	interval := b.FlushInterval
+	if interval <= 0 {
+		interval = DefaultMissFlushInterval
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	b.stop, b.done = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// A failed flush keeps its misses, the next one retries them.
+				_ = b.Flush()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops flushing the buffer in the background and flushes the misses counted since the last flush.
+// Misses recorded afterwards are only written by List, or another Close.
+func (b *MissBuffer) Close() error {
+	b.mu.Lock()
+	stop, done := b.stop, b.done
+	b.stop, b.closed = nil, true
+	b.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return b.Flush()
+}
+
+// Flush adds the misses counted since the last flush to those stored in the database. If that fails, the misses are
+// kept for the next flush.
+func (b *MissBuffer) Flush() error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := b.DB.Update(func(tx *bolt.Tx) error {
+		for bucket, misses := range pending {
+			bkt, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			keys := bkt.Stats().KeyN
+			for key, miss := range misses {
+				// The pending counts are left as they are, in case the transaction fails.
+				stored := Miss{Key: miss.Key, Count: miss.Count, LastSeen: miss.LastSeen}
+				if data := bkt.Get([]byte(key)); data != nil {
+					var previous Miss
+					if err := json.Unmarshal(data, &previous); err != nil {
+						return err
+					}
+					stored.Count += previous.Count
+				} else if keys >= b.maxKeys() {
+					continue
+				} else {
+					keys++
+				}
+				data, err := json.Marshal(stored)
+				if err != nil {
+					return err
+				}
+				if err := bkt.Put([]byte(key), data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.restore(pending)
+	}
+	return err
+}
+
+// restore adds misses that couldn't be flushed back to those counted since, which are more recent.
+func (b *MissBuffer) restore(pending map[string]map[string]*Miss) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for bucket, misses := range pending {
+		counts := b.counts(bucket)
+		for key, miss := range misses {
+			if counted := counts[key]; counted != nil {
+				counted.Count += miss.Count
+			} else if len(counts) < b.maxKeys() {
+				counts[key] = miss
+			}
+		}
+	}
+}
+
+// drop forgets the misses counted in bucket since the last flush.
+func (b *MissBuffer) drop(bucket []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pending, string(bucket))
+}
+
+// List returns the recorded misses ordered by key, including those that weren't flushed yet.
+func (m *MissLog) List() ([]Miss, error) {
+	if err := m.Buffer.Flush(); err != nil {
+		return nil, err
+	}
+	misses := make([]Miss, 0)
+	kv := &KVWrapper{DB: m.Buffer.DB, Bucket: m.Bucket}
+	err := kv.Scan(nil, func(_ []byte, value []byte) error {
+		var miss Miss
+		if err := json.Unmarshal(value, &miss); err != nil {
+			return err
+		}
+		misses = append(misses, miss)
+		return nil
+	})
+	return misses, err
+}
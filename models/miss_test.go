@@ -0,0 +1,177 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMissLog(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	log := &MissLog{Buffer: &MissBuffer{DB: db}, Bucket: []byte(MissesBucket)}
+	defer log.Buffer.Close()
+
+	misses, err := log.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(misses) != 0 {
+		t.Fatalf("expected no misses, got %+v", misses)
+	}
+
+	for _, key := range []string{"lauch", "docs", "lauch"} {
+		if err := log.Record([]byte(key)); err != nil {
+			t.Fatalf("failed to record miss: %v", err)
+		}
+	}
+
+	// Misses are only counted in memory until they're flushed.
+	if count, err := CountKeys(&KVWrapper{DB: db, Bucket: []byte(MissesBucket)}); err != nil || count != 0 {
+		t.Fatalf("expected nothing to be written yet, got %d keys (%v)", count, err)
+	}
+
+	misses, err = log.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(misses) != 2 {
+		t.Fatalf("expected 2 misses, got %+v", misses)
+	}
+	if misses[0].Key != "docs" || misses[0].Count != 1 {
+		t.Errorf("unexpected miss: %+v", misses[0])
+	}
+	if misses[1].Key != "lauch" || misses[1].Count != 2 || misses[1].LastSeen.IsZero() {
+		t.Errorf("unexpected miss: %+v", misses[1])
+	}
+
+	// Counts add up across flushes.
+	if err := log.Record([]byte("lauch")); err != nil {
+		t.Fatalf("failed to record miss: %v", err)
+	}
+	misses, err = log.List()
+	if err != nil || len(misses) != 2 || misses[1].Count != 3 {
+		t.Errorf("expected lauch to be counted 3 times, got %+v (%v)", misses, err)
+	}
+}
+
+func TestMissBuffer(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	buffer := &MissBuffer{DB: db, MaxKeys: 3, FlushInterval: time.Hour}
+	log := &MissLog{Buffer: buffer, Bucket: []byte(MissesBucket)}
+	other := &MissLog{Buffer: buffer, Bucket: NamespaceBucket(MissesBucket, "example.com")}
+
+	t.Run("cap", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			if err := log.Record([]byte(fmt.Sprintf("key%d", i))); err != nil {
+				t.Fatalf("failed to record miss: %v", err)
+			}
+		}
+		// Keys that are already counted still are.
+		if err := log.Record([]byte("key0")); err != nil {
+			t.Fatalf("failed to record miss: %v", err)
+		}
+		misses, err := log.List()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(misses) != 3 || misses[0].Key != "key0" || misses[0].Count != 2 {
+			t.Errorf("expected 3 misses, key0 twice, got %+v", misses)
+		}
+
+		// The cap holds across flushes.
+		for _, key := range []string{"key3", "key1"} {
+			if err := log.Record([]byte(key)); err != nil {
+				t.Fatalf("failed to record miss: %v", err)
+			}
+		}
+		misses, err = log.List()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(misses) != 3 || misses[1].Key != "key1" || misses[1].Count != 2 {
+			t.Errorf("expected 3 misses, key1 twice, got %+v", misses)
+		}
+	})
+
+	t.Run("per bucket", func(t *testing.T) {
+		if err := other.Record([]byte("docs")); err != nil {
+			t.Fatalf("failed to record miss: %v", err)
+		}
+		misses, err := other.List()
+		if err != nil || len(misses) != 1 || misses[0].Key != "docs" {
+			t.Errorf("expected docs to be counted, got %+v (%v)", misses, err)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		buffer := &MissBuffer{DB: db, FlushInterval: time.Millisecond}
+		defer buffer.Close()
+		if err := buffer.Record(NamespaceBucket(MissesBucket, "example.com"), []byte("blog")); err != nil {
+			t.Fatalf("failed to record miss: %v", err)
+		}
+		kv := &KVWrapper{DB: db, Bucket: NamespaceBucket(MissesBucket, "example.com")}
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+			if value, err := kv.Get([]byte("blog")); err == nil && value != nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected the miss to be flushed")
+			}
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		if err := log.Record([]byte("key2")); err != nil {
+			t.Fatalf("failed to record miss: %v", err)
+		}
+		if err := buffer.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		kv := &KVWrapper{DB: db, Bucket: []byte(MissesBucket)}
+		value, err := kv.Get([]byte("key2"))
+		if err != nil || !strings.Contains(string(value), `"count":2`) {
+			t.Errorf("expected the miss to be flushed on close, got %s (%v)", value, err)
+		}
+	})
+}
+
+func TestMissBufferFailedFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "misses.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	buffer := &MissBuffer{DB: db, FlushInterval: time.Hour}
+	log := &MissLog{Buffer: buffer, Bucket: []byte(MissesBucket)}
+	if err := log.Record([]byte("docs")); err != nil {
+		t.Fatalf("failed to record miss: %v", err)
+	}
+
+	// Misses that can't be written are kept, along with those counted since.
+	_ = db.Close()
+	if err := buffer.Flush(); err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	if err := log.Record([]byte("docs")); err != nil {
+		t.Fatalf("failed to record miss: %v", err)
+	}
+
+	buffer.DB, err = bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer buffer.DB.Close()
+	defer buffer.Close()
+	misses, err := log.List()
+	if err != nil || len(misses) != 1 || misses[0].Count != 2 {
+		t.Errorf("expected docs to be counted twice, got %+v (%v)", misses, err)
+	}
+}
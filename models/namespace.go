@@ -0,0 +1,177 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names shared by every namespace. Namespaced copies are suffixed with "@<host>" by NamespaceBucket.
+const (
+	RedirectsBucket = "redirects"
+	APIKeysBucket   = "api_keys"
+	DomainsBucket   = "domains"
+	LogosBucket     = "logos"
+)
+
+// NamespaceLogoKey is the key of the logo used by every redirect of a namespace that doesn't have its own.
+// It can't collide with a redirect key since keys never contain a "/".
+const NamespaceLogoKey = "/"
+
+// namespaceBuckets lists the buckets, other than the redirects, that are dropped along with a domain.
+var namespaceBuckets = []string{APIKeysBucket, MissesBucket, LogosBucket, AliasesBucket, AliasKeysBucket,
+	DedupeBucket, TargetsBucket, TermsBucket, HistoryBucket}
+
+// Namespace groups the stores backing the links of a single Domain.
+type Namespace struct {
+	Domain    *Domain
+	Redirects KV
+	APIKeys   KV
+	Misses    MissRecorder
+	Logos     KV
+	Aliases   KV
+	Dedupe    KV
+	Targets   TargetFinder
+	Terms     TermSearcher
+	History   KV
+}
+
+// NamespaceResolver resolves a normalized request host to its Namespace.
+// A nil Namespace means that the host is not a registered Domain and the default namespace applies.
+type NamespaceResolver interface {
+	Resolve(host string) (*Namespace, error)
+}
+
+// NamespaceBucket returns the name of the base bucket within the namespace of host, or the base bucket itself for the
+// default namespace (empty host).
+func NamespaceBucket(base string, host string) []byte {
+	if host == "" {
+		return []byte(base)
+	}
+	return []byte(base + "@" + host)
+}
+
+// DomainStore manages registered domains in the "domains" bucket and resolves them to their namespaces.
+// Misses (optional) counts the misses of the namespaces, which don't record misses without it.
+type DomainStore struct {
+	DB     *bolt.DB
+	Misses *MissBuffer
+}
+
+// Resolve returns the Namespace of the registered domain matching host, or nil if the host is not registered.
+func (s *DomainStore) Resolve(host string) (*Namespace, error) {
+	domain, err := s.Get(host)
+	if err != nil || domain == nil {
+		return nil, err
+	}
+	return s.Namespace(domain), nil
+}
+
+// Namespace builds the stores of the namespace belonging to domain.
+func (s *DomainStore) Namespace(domain *Domain) *Namespace {
+	ns := &Namespace{
+		Domain:    domain,
+		Redirects: NamespaceRedirects(s.DB, domain.Host),
+		APIKeys:   &KVWrapper{DB: s.DB, Bucket: NamespaceBucket(APIKeysBucket, domain.Host)},
+		Logos:     &KVWrapper{DB: s.DB, Bucket: NamespaceBucket(LogosBucket, domain.Host)},
+		Aliases:   NamespaceAliases(s.DB, domain.Host),
+		Dedupe:    &KVWrapper{DB: s.DB, Bucket: NamespaceBucket(DedupeBucket, domain.Host)},
+		Targets:   NamespaceTargets(s.DB, domain.Host),
+		Terms:     NamespaceTerms(s.DB, domain.Host),
+		History:   &KVWrapper{DB: s.DB, Bucket: NamespaceBucket(HistoryBucket, domain.Host)},
+	}
+	if s.Misses != nil {
+		ns.Misses = &MissLog{Buffer: s.Misses, Bucket: NamespaceBucket(MissesBucket, domain.Host)}
+	}
+	return ns
+}
+
+// Get returns the domain registered for host, or nil if there is none.
+func (s *DomainStore) Get(host string) (*Domain, error) {
+	var domain *Domain
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(DomainsBucket))
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(host))
+		if data == nil {
+			return nil
+		}
+		domain = &Domain{}
+		return json.Unmarshal(data, domain)
+	})
+	return domain, err
+}
+
+// List returns every registered domain ordered by host.
+func (s *DomainStore) List() ([]Domain, error) {
+	domains := make([]Domain, 0)
+	kv := &KVWrapper{DB: s.DB, Bucket: []byte(DomainsBucket)}
+	err := kv.Scan(nil, func(_ []byte, value []byte) error {
+		var domain Domain
+		if err := json.Unmarshal(value, &domain); err != nil {
+			return err
+		}
+		domains = append(domains, domain)
+		return nil
+	})
+	return domains, err
+}
+
+// Create registers a new domain. Returns an AlreadyExistsError if the host is already registered.
+func (s *DomainStore) Create(domain Domain) error {
+	data, err := json.Marshal(domain)
+	if err != nil {
+		return err
+	}
+	kv := &KVWrapper{DB: s.DB, Bucket: []byte(DomainsBucket)}
+	return kv.ExclusivePut([]byte(domain.Host), data)
+}
+
+// Update replaces the configuration of a registered domain. Returns a DoesNotExistError if the host is not registered.
+func (s *DomainStore) Update(domain Domain) error {
+	data, err := json.Marshal(domain)
+	if err != nil {
+		return err
+	}
+	kv := &KVWrapper{DB: s.DB, Bucket: []byte(DomainsBucket)}
+	_, err = kv.Replace([]byte(domain.Host), data)
+	return err
+}
+
+// Delete removes a registered domain along with its API keys, recorded misses, logos, aliases,
+// dedupe, target, and term indexes, and history.
+// Returns a DoesNotExistError if the host is not registered, or an InUseError if the domain still has redirects.
+func (s *DomainStore) Delete(host string) error {
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		domains := tx.Bucket([]byte(DomainsBucket))
+		if domains == nil || domains.Get([]byte(host)) == nil {
+			return helpers.NewDoesNotExistError([]byte(host))
+		}
+		if redirects := tx.Bucket(NamespaceBucket(RedirectsBucket, host)); redirects != nil {
+			if k, _ := redirects.Cursor().First(); k != nil {
+				return helpers.NewInUseError([]byte(host), "domain still has redirects")
+			}
+			if err := tx.DeleteBucket(NamespaceBucket(RedirectsBucket, host)); err != nil {
+				return err
+			}
+		}
+		for _, base := range namespaceBuckets {
+			if tx.Bucket(NamespaceBucket(base, host)) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(NamespaceBucket(base, host)); err != nil {
+				return err
+			}
+		}
+		return domains.Delete([]byte(host))
+	})
+	// Misses that weren't flushed yet would bring the bucket back, those of a domain that's kept must not be lost.
+	if err == nil && s.Misses != nil {
+		s.Misses.drop(NamespaceBucket(MissesBucket, host))
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+)
+
+func TestNamespaceBucket(t *testing.T) {
+	if got := string(NamespaceBucket("redirects", "")); got != "redirects" {
+		t.Errorf("expected default namespace bucket %q, got %q", "redirects", got)
+	}
+	if got := string(NamespaceBucket("redirects", "go.team-a")); got != "redirects@go.team-a" {
+		t.Errorf("expected namespaced bucket %q, got %q", "redirects@go.team-a", got)
+	}
+}
+
+func TestDomainStore(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	store := &DomainStore{DB: db, Misses: &MissBuffer{DB: db, FlushInterval: time.Hour}}
+	defer store.Misses.Close()
+
+	t.Run("resolve unregistered host", func(t *testing.T) {
+		ns, err := store.Resolve("lnk.now")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ns != nil {
+			t.Fatalf("expected nil namespace, got %+v", ns)
+		}
+	})
+
+	t.Run("create and resolve", func(t *testing.T) {
+		err := store.Create(Domain{Host: "go.team-a", RootText: "Team A links"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ns, err := store.Resolve("go.team-a")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ns == nil || ns.Domain.RootText != "Team A links" {
+			t.Fatalf("unexpected namespace: %+v", ns)
+		}
+		if err := ns.Redirects.Put([]byte("docs"), []byte("https://a.example.com")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("create duplicate", func(t *testing.T) {
+		err := store.Create(Domain{Host: "go.team-a"})
+		var ae *helpers.AlreadyExistsError
+		if !errors.As(err, &ae) {
+			t.Fatalf("expected AlreadyExistsError, got %v", err)
+		}
+	})
+
+	t.Run("namespaces are isolated", func(t *testing.T) {
+		if err := store.Create(Domain{Host: "lnk.now"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ns, err := store.Resolve("lnk.now")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		value, err := ns.Redirects.Get([]byte("docs"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if value != nil {
+			t.Errorf("expected key to be missing from other namespace, got %q", value)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		domains, err := store.List()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(domains) != 2 || domains[0].Host != "go.team-a" || domains[1].Host != "lnk.now" {
+			t.Errorf("unexpected domains: %+v", domains)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		if err := store.Update(Domain{Host: "lnk.now", RootText: "updated"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		domain, err := store.Get("lnk.now")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if domain.RootText != "updated" {
+			t.Errorf("expected updated root text, got %q", domain.RootText)
+		}
+		err = store.Update(Domain{Host: "missing.example"})
+		var dne *helpers.DoesNotExistError
+		if !errors.As(err, &dne) {
+			t.Fatalf("expected DoesNotExistError, got %v", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		missed := func(host string) int {
+			store.Misses.mu.Lock()
+			defer store.Misses.mu.Unlock()
+			return len(store.Misses.pending[string(NamespaceBucket(MissesBucket, host))])
+		}
+		for _, host := range []string{"go.team-a", "lnk.now"} {
+			if err := store.Misses.Record(NamespaceBucket(MissesBucket, host), []byte("docs")); err != nil {
+				t.Fatalf("failed to record miss: %v", err)
+			}
+		}
+
+		err := store.Delete("go.team-a")
+		var iu *helpers.InUseError
+		if !errors.As(err, &iu) {
+			t.Fatalf("expected InUseError, got %v", err)
+		}
+		if missed("go.team-a") != 1 {
+			t.Error("expected the misses of a domain that wasn't deleted to be kept")
+		}
+		if err := store.Delete("lnk.now"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if missed("lnk.now") != 0 {
+			t.Error("expected the misses of a deleted domain to be dropped")
+		}
+		err = store.Delete("lnk.now")
+		var dne *helpers.DoesNotExistError
+		if !errors.As(err, &dne) {
+			t.Fatalf("expected DoesNotExistError, got %v", err)
+		}
+	})
+}
@@ -1,9 +1,173 @@
 package models
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+)
+
+// Path modes control what happens to the part of the request path that follows the key.
+const (
+	PathModeNone     = ""         // Extra path segments are not allowed
+	PathModeAppend   = "append"   // Extra path segments are appended to the URL's path
+	PathModeTemplate = "template" // Extra path segments replace "{path}" in the URL
+)
+
+// Query modes control what happens to the query string of the request.
+const (
+	QueryModeDrop     = ""         // The request's query string is dropped
+	QueryModeOverride = "override" // The request's query parameters are merged in, replacing parameters of the same name
+	QueryModeAppend   = "append"   // The request's query parameters are added alongside parameters of the same name
+)
+
 // Redirect represents a redirection entity with a URL and an optional key.
 // The URL field specifies the target destination and is required with validation as a valid URL.
 // The Key field is optional and can be used to uniquely identify the redirection.
+// PathMode and QueryMode optionally pass the rest of the request path and its query string through to the URL.
+// Params are query parameters (e.g. "utm_source") added to the URL at redirect time, replacing any of the same name.
+// Title, Tags, and Notes describe the redirect, so that it can be searched for.
 type Redirect struct {
-	URL string `json:"url" binding:"required,url"`
-	Key string `json:"key,omitempty" binding:"-"`
+	URL       string            `json:"url" binding:"required,url"`
+	Key       string            `json:"key,omitempty" binding:"-"`
+	PathMode  string            `json:"path_mode,omitempty" binding:"omitempty,oneof=append template"`
+	QueryMode string            `json:"query_mode,omitempty" binding:"omitempty,oneof=override append"`
+	Params    map[string]string `json:"params,omitempty" binding:"omitempty,dive,keys,required,endkeys"`
+	Title     string            `json:"title,omitempty" binding:"max=256"`
+	Tags      []string          `json:"tags,omitempty" binding:"max=32,dive,required,max=64"`
+	Notes     string            `json:"notes,omitempty" binding:"max=4096"`
+}
+
+// EncodeRedirect serializes a Redirect for storage. The key is not stored since it's the key of the record.
+func EncodeRedirect(r Redirect) ([]byte, error) {
+	r.Key = ""
+	return json.Marshal(r)
+}
+
+// DecodeRedirect deserializes a stored Redirect for key. Values stored before redirects were records are plain URLs.
+func DecodeRedirect(key []byte, value []byte) (Redirect, error) {
+	r := Redirect{}
+	if bytes.HasPrefix(value, []byte("{")) {
+		if err := json.Unmarshal(value, &r); err != nil {
+			return r, err
+		}
+	} else {
+		r.URL = string(value)
+	}
+	r.Key = string(key)
+	return r, nil
+}
+
+// ErrDotSegment is returned for extra paths with "." or ".." segments, which would lead elsewhere than below the URL.
+var ErrDotSegment = errors.New(`the path can't contain "." or ".." segments`)
+
+// Destination builds the URL a request is redirected to.
+// extraPath is the part of the request path following the key (without the leading "/"), and query is the request's
+// query string. extraPath is ignored unless the redirect has a PathMode, and returns ErrDotSegment if it has dot
+// segments, since encoding them wouldn't keep browsers and servers from resolving them.
+// Query parameters are applied in order: the URL's own, then the redirect's Params, then the request's as per QueryMode.
+func (r *Redirect) Destination(extraPath string, query url.Values) (string, error) {
+	if r.PathMode != PathModeNone && hasDotSegment(extraPath) {
+		return "", ErrDotSegment
+	}
+
+	target := r.URL
+	if r.PathMode == PathModeTemplate {
+		target = helpers.ExpandTemplate(target, map[string]string{
+			"key":  helpers.EscapeTemplateValue(r.Key),
+			"path": escapePath(extraPath),
+		})
+	}
+
+	// Nothing else to do, return the URL untouched.
+	mergeQuery := r.QueryMode != QueryModeDrop && len(query) > 0
+	if (r.PathMode != PathModeAppend || extraPath == "") && !mergeQuery && len(r.Params) == 0 {
+		return target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	if r.PathMode == PathModeAppend && extraPath != "" {
+		u = u.JoinPath(extraPath)
+	}
+
+	// The target's own query string is kept as it is written, only what's merged into it is encoded.
+	if mergeQuery || len(r.Params) > 0 {
+		added := url.Values{}
+		replaced := map[string]bool{}
+		for name, value := range r.Params {
+			added.Set(name, value)
+			replaced[name] = true
+		}
+		for name, v := range query {
+			switch r.QueryMode {
+			case QueryModeOverride:
+				added[name] = v
+				replaced[name] = true
+			case QueryModeAppend:
+				added[name] = append(added[name], v...)
+			}
+		}
+		u.RawQuery = mergeRawQuery(u.RawQuery, added, replaced)
+	}
+
+	return u.String(), nil
+}
+
+// mergeRawQuery returns the query string rawQuery with the values of added. Parameters named in replaced take the place
+// of the first parameter of the same name, the others are appended. Everything else is left as it is written, in the
+// same order.
+func mergeRawQuery(rawQuery string, added url.Values, replaced map[string]bool) string {
+	var parts []string
+	merged := map[string]bool{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && replaced[unescaped] {
+			if !merged[unescaped] {
+				merged[unescaped] = true
+				parts = append(parts, url.Values{unescaped: added[unescaped]}.Encode())
+			}
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	rest := url.Values{}
+	for name, values := range added {
+		if !merged[name] {
+			rest[name] = values
+		}
+	}
+	if len(rest) > 0 {
+		parts = append(parts, rest.Encode())
+	}
+	return strings.Join(parts, "&")
+}
+
+// hasDotSegment reports whether a "/" separated path has a "." or ".." segment.
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePath escapes every segment of a "/" separated path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
 }
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    []byte
+		expected Redirect
+		wantErr  bool
+	}{
+		{
+			name:     "legacy plain url",
+			value:    []byte("https://example.com"),
+			expected: Redirect{Key: "key1", URL: "https://example.com"},
+		},
+		{
+			name:     "record",
+			value:    []byte(`{"url":"https://example.com/{path}","path_mode":"template"}`),
+			expected: Redirect{Key: "key1", URL: "https://example.com/{path}", PathMode: PathModeTemplate},
+		},
+		{
+			name:    "broken record",
+			value:   []byte(`{"url":`),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := DecodeRedirect([]byte("key1"), tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, r)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		original := Redirect{Key: "key1", URL: "https://example.com", PathMode: PathModeAppend, QueryMode: QueryModeOverride}
+		data, err := EncodeRedirect(original)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(data) != `{"url":"https://example.com","path_mode":"append","query_mode":"override"}` {
+			t.Errorf("unexpected encoding: %s", data)
+		}
+		decoded, err := DecodeRedirect([]byte("key1"), data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, original) {
+			t.Errorf("expected %+v, got %+v", original, decoded)
+		}
+	})
+}
+
+func TestRedirect_Destination(t *testing.T) {
+	tests := []struct {
+		name      string
+		redirect  Redirect
+		extraPath string
+		query     string
+		expected  string
+	}{
+		{
+			name:     "plain redirect",
+			redirect: Redirect{URL: "https://example.com/a?b=1"},
+			query:    "x=1",
+			expected: "https://example.com/a?b=1",
+		},
+		{
+			name:      "append path",
+			redirect:  Redirect{URL: "https://docs.example.com", PathMode: PathModeAppend},
+			extraPath: "some/page",
+			expected:  "https://docs.example.com/some/page",
+		},
+		{
+			name:      "append path to existing path",
+			redirect:  Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend},
+			extraPath: "some/page",
+			expected:  "https://docs.example.com/v2/some/page",
+		},
+		{
+			name:      "append path with dots in segments",
+			redirect:  Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend},
+			extraPath: "..a/b.",
+			expected:  "https://docs.example.com/v2/..a/b.",
+		},
+		{
+			name:     "append without extra path",
+			redirect: Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend},
+			expected: "https://docs.example.com/v2/",
+		},
+		{
+			name:      "append path and override query",
+			redirect:  Redirect{URL: "https://docs.example.com/?x=0&y=2", PathMode: PathModeAppend, QueryMode: QueryModeOverride},
+			extraPath: "some/page",
+			query:     "x=1",
+			expected:  "https://docs.example.com/some/page?x=1&y=2",
+		},
+		{
+			name:      "template",
+			redirect:  Redirect{Key: "gh", URL: "https://github.com/org/{path}", PathMode: PathModeTemplate},
+			extraPath: "repo/issues",
+			expected:  "https://github.com/org/repo/issues",
+		},
+		{
+			name:      "template escapes segments",
+			redirect:  Redirect{Key: "gh", URL: "https://github.com/org/{path}?from={key}", PathMode: PathModeTemplate},
+			extraPath: "a b/c?d",
+			expected:  "https://github.com/org/a%20b/c%3Fd?from=gh",
+		},
+		{
+			name:     "query dropped by default",
+			redirect: Redirect{URL: "https://example.com/", PathMode: PathModeAppend},
+			query:    "x=1",
+			expected: "https://example.com/",
+		},
+		{
+			name:     "query override",
+			redirect: Redirect{URL: "https://example.com/", QueryMode: QueryModeOverride},
+			query:    "x=1",
+			expected: "https://example.com/?x=1",
+		},
+		{
+			name:     "params",
+			redirect: Redirect{URL: "https://example.com/?utm_source=old&page=2", Params: map[string]string{"utm_source": "lnk", "utm_campaign": "launch"}},
+			query:    "utm_source=email",
+			expected: "https://example.com/?utm_source=lnk&page=2&utm_campaign=launch",
+		},
+		{
+			name:     "params keep the target's query as written",
+			redirect: Redirect{URL: "https://api.example.com/v1?sig=abc%7E&z=1&a=2", Params: map[string]string{"utm_source": "lnk"}},
+			expected: "https://api.example.com/v1?sig=abc%7E&z=1&a=2&utm_source=lnk",
+		},
+		{
+			name:     "request append keeps the target's query as written",
+			redirect: Redirect{URL: "https://api.example.com/v1?z=1&a=2", QueryMode: QueryModeAppend},
+			query:    "z=3",
+			expected: "https://api.example.com/v1?z=1&a=2&z=3",
+		},
+		{
+			name:     "params with request override",
+			redirect: Redirect{URL: "https://example.com/", QueryMode: QueryModeOverride, Params: map[string]string{"utm_source": "lnk", "utm_campaign": "launch"}},
+			query:    "utm_source=email&ref=1",
+			expected: "https://example.com/?ref=1&utm_campaign=launch&utm_source=email",
+		},
+		{
+			name:     "params with request append",
+			redirect: Redirect{URL: "https://example.com/", QueryMode: QueryModeAppend, Params: map[string]string{"utm_source": "lnk"}},
+			query:    "utm_source=email&ref=1",
+			expected: "https://example.com/?ref=1&utm_source=lnk&utm_source=email",
+		},
+		{
+			name:     "params with request dropped",
+			redirect: Redirect{URL: "https://example.com/", Params: map[string]string{"utm_source": "lnk"}},
+			query:    "utm_source=email&ref=1",
+			expected: "https://example.com/?utm_source=lnk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := tt.redirect.Destination(tt.extraPath, query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRedirect_DestinationDotSegments(t *testing.T) {
+	tests := []struct {
+		name      string
+		redirect  Redirect
+		extraPath string
+	}{
+		{"append parent", Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend}, "../../admin"},
+		{"append current", Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend}, "a/./b"},
+		{"append trailing parent", Redirect{URL: "https://docs.example.com/v2/", PathMode: PathModeAppend}, "a/.."},
+		{"template parent", Redirect{URL: "https://github.com/org/{path}", PathMode: PathModeTemplate}, "../admin"},
+		{"template current", Redirect{URL: "https://github.com/org/{path}", PathMode: PathModeTemplate}, "."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.redirect.Destination(tt.extraPath, nil)
+			if !errors.Is(err, ErrDotSegment) {
+				t.Errorf("expected ErrDotSegment, got %q (%v)", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+)
+
+// RetargetMatch selects the redirects to retarget by their URL, with exactly one of:
+//   - Host: the URLs to this host, whatever their scheme, port, and path. The replacement is the new host, the port is
+//     kept unless the replacement has one.
+//   - Prefix: the URLs starting with this prefix, as they are stored. The replacement replaces the prefix.
+//   - Regex: the URLs matching this regular expression. The replacement replaces every match, "$1" expands to the
+//     first submatch.
+type RetargetMatch struct {
+	Host   string `json:"host,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+}
+
+// Retargeter rewrites the URLs selected by a RetargetMatch.
+type Retargeter struct {
+	match       RetargetMatch
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// NewRetargeter creates a Retargeter rewriting the URLs selected by match with replacement.
+// Returns an error if match doesn't set exactly one way to select URLs, or if the regular expression or the replacement
+// host are invalid.
+func NewRetargeter(match RetargetMatch, replacement string) (*Retargeter, error) {
+	set := 0
+	for _, s := range []string{match.Host, match.Prefix, match.Regex} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of host, prefix, and regex must be set")
+	}
+
+	r := &Retargeter{match: match, replacement: replacement}
+	switch {
+	case match.Host != "":
+		r.match.Host = helpers.NormalizeHost(match.Host)
+		if replacement == "" || strings.ContainsAny(replacement, "/?#@ ") {
+			return nil, errors.New("the replacement of a host must be a host")
+		}
+	case match.Regex != "":
+		regex, err := regexp.Compile(match.Regex)
+		if err != nil {
+			return nil, err
+		}
+		r.regex = regex
+	}
+	return r, nil
+}
+
+// Rewrite returns what rawURL becomes, and whether it is selected and changes at all.
+func (r *Retargeter) Rewrite(rawURL string) (string, bool) {
+	rewritten := rawURL
+	switch {
+	case r.match.Host != "":
+		var ok bool
+		if rewritten, ok = r.rewriteHost(rawURL); !ok {
+			return rawURL, false
+		}
+	case r.match.Prefix != "":
+		if !strings.HasPrefix(rawURL, r.match.Prefix) {
+			return rawURL, false
+		}
+		rewritten = r.replacement + strings.TrimPrefix(rawURL, r.match.Prefix)
+	default:
+		rewritten = r.regex.ReplaceAllString(rawURL, r.replacement)
+	}
+	return rewritten, rewritten != rawURL
+}
+
+// rewriteHost replaces the host of rawURL if it is the matched host. The rest of the URL is left as it is, rather than
+// parsed and serialized again, so that templates such as "{path}" aren't escaped.
+func (r *Retargeter) rewriteHost(rawURL string) (string, bool) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return "", false
+	}
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	userinfo, hostport := "", rest[:end]
+	if i := strings.LastIndex(hostport, "@"); i >= 0 {
+		userinfo, hostport = hostport[:i+1], hostport[i+1:]
+	}
+	if helpers.NormalizeHost(hostport) != r.match.Host {
+		return "", false
+	}
+
+	host := r.replacement
+	if _, port, err := net.SplitHostPort(hostport); err == nil {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, port)
+		}
+	}
+	return scheme + "://" + userinfo + host + rest[end:], true
+}
@@ -0,0 +1,79 @@
+package models
+
+import "testing"
+
+func TestNewRetargeter(t *testing.T) {
+	tests := []struct {
+		name        string
+		match       RetargetMatch
+		replacement string
+		wantErr     bool
+	}{
+		{"host", RetargetMatch{Host: "old.example.com"}, "new.example.com", false},
+		{"prefix", RetargetMatch{Prefix: "https://old.example.com/docs"}, "https://docs.example.com", false},
+		{"regex", RetargetMatch{Regex: `^http://(.*)$`}, "https://$1", false},
+		{"nothing to match", RetargetMatch{}, "new.example.com", true},
+		{"several matches", RetargetMatch{Host: "old.example.com", Prefix: "https://old.example.com"}, "x", true},
+		{"host replaced with a URL", RetargetMatch{Host: "old.example.com"}, "https://new.example.com", true},
+		{"host replaced with nothing", RetargetMatch{Host: "old.example.com"}, "", true},
+		{"invalid regex", RetargetMatch{Regex: `(`}, "x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRetargeter(tt.match, tt.replacement)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRetargeter_Rewrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		match       RetargetMatch
+		replacement string
+		url         string
+		want        string
+		wantChanged bool
+	}{
+		{"host", RetargetMatch{Host: "Old.example.com"}, "new.example.com",
+			"https://old.example.com/a?b=c#d", "https://new.example.com/a?b=c#d", true},
+		{"host without a path", RetargetMatch{Host: "old.example.com"}, "new.example.com",
+			"https://OLD.example.com", "https://new.example.com", true},
+		{"host keeps the port", RetargetMatch{Host: "old.example.com"}, "new.example.com",
+			"http://old.example.com:8080/a", "http://new.example.com:8080/a", true},
+		{"host replaces the port", RetargetMatch{Host: "old.example.com"}, "new.example.com:8443",
+			"http://old.example.com:8080/a", "http://new.example.com:8443/a", true},
+		{"host keeps user info and templates", RetargetMatch{Host: "old.example.com"}, "new.example.com",
+			"https://user@old.example.com/{path}", "https://user@new.example.com/{path}", true},
+		{"other host", RetargetMatch{Host: "old.example.com"}, "new.example.com",
+			"https://sub.old.example.com/a", "https://sub.old.example.com/a", false},
+		{"host in the path", RetargetMatch{Host: "old.example.com"}, "new.example.com",
+			"https://example.com/old.example.com", "https://example.com/old.example.com", false},
+		{"prefix", RetargetMatch{Prefix: "https://old.example.com/docs"}, "https://docs.example.com",
+			"https://old.example.com/docs/guide", "https://docs.example.com/guide", true},
+		{"other prefix", RetargetMatch{Prefix: "https://old.example.com/docs"}, "https://docs.example.com",
+			"https://old.example.com/blog", "https://old.example.com/blog", false},
+		{"regex", RetargetMatch{Regex: `^http://(.*)$`}, "https://$1",
+			"http://example.com/a", "https://example.com/a", true},
+		{"regex without a match", RetargetMatch{Regex: `^http://(.*)$`}, "https://$1",
+			"https://example.com/a", "https://example.com/a", false},
+		{"unchanged", RetargetMatch{Prefix: "https://example.com"}, "https://example.com",
+			"https://example.com/a", "https://example.com/a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRetargeter(tt.match, tt.replacement)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, changed := r.Rewrite(tt.url)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("expected %q (%v), got %q (%v)", tt.want, tt.wantChanged, got, changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/thedeltaflyer/redirector/helpers"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TargetsBucket indexes the redirects of a namespace by the host and the normalized URL they lead to.
+const TargetsBucket = "targets"
+
+// Kinds of entries of the target index. Entries are "<kind>\x00<host or URL>\x00<key>" with no value, normalized URLs
+// never contain a NUL and neither do keys.
+const (
+	targetHost = "host"
+	targetURL  = "url"
+)
+
+// TargetFinder finds the redirects leading to a destination.
+type TargetFinder interface {
+	FindTarget(target string) ([]string, error)
+}
+
+// TargetIndex is a TargetFinder that keeps the reverse index of a redirects bucket in a BoltDB bucket. It is the
+// KVIndex of the redirects bucket, so the index changes in the same transaction as the redirects do.
+type TargetIndex struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// NamespaceRedirects returns the KV of the redirects of the namespace of host, which keeps its target, term, and dedupe
+// indexes up to date.
+func NamespaceRedirects(db *bolt.DB, host string) *KVWrapper {
+	return &KVWrapper{
+		DB:     db,
+		Bucket: NamespaceBucket(RedirectsBucket, host),
+		Index:  KVIndexes{NamespaceTargets(db, host), NamespaceTerms(db, host), NamespaceDedupe(db, host)},
+	}
+}
+
+// NamespaceTargets returns the target index of the redirects of the namespace of host.
+func NamespaceTargets(db *bolt.DB, host string) *TargetIndex {
+	return &TargetIndex{DB: db, Bucket: NamespaceBucket(TargetsBucket, host)}
+}
+
+// targetEntries returns the index entries of the redirect stored under key as value. Values that are nil or can't be
+// decoded have none, they don't lead anywhere.
+func targetEntries(key []byte, value []byte) [][]byte {
+	if value == nil {
+		return nil
+	}
+	redirect, err := DecodeRedirect(key, value)
+	if err != nil {
+		return nil
+	}
+	entries := [][]byte{targetEntry(targetURL, helpers.NormalizeURL(redirect.URL), key)}
+	if u, err := url.Parse(redirect.URL); err == nil && u.Host != "" {
+		entries = append(entries, targetEntry(targetHost, helpers.NormalizeHost(u.Host), key))
+	}
+	return entries
+}
+
+// targetEntry returns the index entry of key under the host or URL target. A nil key returns the prefix of the
+// entries of target.
+func targetEntry(kind string, target string, key []byte) []byte {
+	entry := []byte(kind + "\x00" + target + "\x00")
+	return append(entry, key...)
+}
+
+// Update replaces the index entries of the redirect stored under key as oldValue with those of newValue, within tx.
+func (i *TargetIndex) Update(tx *bolt.Tx, key []byte, oldValue []byte, newValue []byte) error {
+	b, err := tx.CreateBucketIfNotExists(i.Bucket)
+	if err != nil {
+		return err
+	}
+	for _, entry := range targetEntries(key, oldValue) {
+		if err := b.Delete(entry); err != nil {
+			return err
+		}
+	}
+	for _, entry := range targetEntries(key, newValue) {
+		if err := b.Put(entry, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindTarget returns the keys of the redirects leading to target, ordered by key. A target with a scheme is a URL, the
+// redirects leading to the same normalized URL are found. Otherwise it's a host, and every redirect to it is found
+// whatever its scheme, port, and path.
+func (i *TargetIndex) FindTarget(target string) ([]string, error) {
+	prefix := targetEntry(targetHost, helpers.NormalizeHost(target), nil)
+	if strings.Contains(target, "://") {
+		prefix = targetEntry(targetURL, helpers.NormalizeURL(target), nil)
+	}
+
+	keys := make([]string, 0)
+	kv := &KVWrapper{DB: i.DB, Bucket: i.Bucket}
+	err := kv.Scan(prefix, func(entry []byte, _ []byte) error {
+		keys = append(keys, string(entry[len(prefix):]))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Built reports whether the index exists, it is only missing for redirects stored before it was introduced.
+func (i *TargetIndex) Built() (bool, error) {
+	return indexBuilt(i.DB, i.Bucket)
+}
+
+// Build indexes every redirect stored in the redirects bucket, replacing the index if there is one.
+// Returns the number of redirects indexed.
+func (i *TargetIndex) Build(redirects []byte) (int, error) {
+	return buildIndex(i.DB, i.Bucket, redirects, i.Update)
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTargetIndex(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	redirects := NamespaceRedirects(db, "go.team-a")
+	targets := NamespaceTargets(db, "go.team-a")
+
+	put := func(key string, value string) {
+		t.Helper()
+		if err := redirects.ExclusivePut([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	put("docs", `{"url":"https://Docs.example.com/guide"}`)
+	put("guide", "https://docs.example.com:443/guide")
+	put("home", `{"url":"https://example.com"}`)
+	put("local", `{"url":"http://docs.example.com:8080/"}`)
+	put("broken", `{"url":`)
+
+	find := func(target string, want ...string) {
+		t.Helper()
+		keys, err := targets.FindTarget(target)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("FindTarget(%q): expected %v, got %v", target, want, keys)
+		}
+	}
+
+	t.Run("by host", func(t *testing.T) {
+		find("docs.example.com", "docs", "guide", "local")
+		find("DOCS.example.com.", "docs", "guide", "local")
+		find("example.com", "home")
+		find("example.org")
+	})
+
+	t.Run("by URL", func(t *testing.T) {
+		find("https://docs.example.com/guide", "docs", "guide")
+		find("http://docs.example.com:8080", "local")
+		find("https://example.com/", "home")
+		find("https://example.com/other")
+	})
+
+	t.Run("replace and delete", func(t *testing.T) {
+		if _, err := redirects.Replace([]byte("guide"), []byte(`{"url":"https://example.com"}`)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := redirects.Delete([]byte("home")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := redirects.Delete([]byte("broken")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		find("docs.example.com", "docs", "local")
+		find("https://example.com", "guide")
+	})
+
+	t.Run("other namespaces are separate", func(t *testing.T) {
+		keys, err := NamespaceTargets(db, "").FindTarget("docs.example.com")
+		if err != nil || len(keys) != 0 {
+			t.Errorf("expected no keys, got %v (%v)", keys, err)
+		}
+	})
+
+	t.Run("build", func(t *testing.T) {
+		legacy := &KVWrapper{DB: db, Bucket: NamespaceBucket(RedirectsBucket, "")}
+		if err := legacy.Put([]byte("old"), []byte("https://docs.example.com")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		index := NamespaceTargets(db, "")
+		if built, err := index.Built(); err != nil || built {
+			t.Fatalf("expected no index, got %v (%v)", built, err)
+		}
+		count, err := index.Build(NamespaceBucket(RedirectsBucket, ""))
+		if err != nil || count != 1 {
+			t.Fatalf("expected 1 redirect indexed, got %d (%v)", count, err)
+		}
+		if built, err := index.Built(); err != nil || !built {
+			t.Fatalf("expected an index, got %v (%v)", built, err)
+		}
+		keys, err := index.FindTarget("docs.example.com")
+		if err != nil || !reflect.DeepEqual(keys, []string{"old"}) {
+			t.Errorf("expected [old], got %v (%v)", keys, err)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TermsBucket is the inverted index of the redirects of a namespace, by the words of their key, URL, title, tags, and
+// notes. Entries are "<term>\x00<key>" with no value, terms never contain a NUL and neither do keys.
+const TermsBucket = "terms"
+
+// maxTermLength is the length in bytes terms are cut to, so that long tokens such as IDs in URLs don't bloat the index.
+const maxTermLength = 64
+
+// TermSearcher searches redirects by the words describing them.
+type TermSearcher interface {
+	SearchTerms(query string) ([]string, error)
+}
+
+// TermIndex is a TermSearcher that keeps the inverted index of a redirects bucket in a BoltDB bucket. It is a KVIndex
+// of the redirects bucket, so the index changes in the same transaction as the redirects do.
+type TermIndex struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// NamespaceTerms returns the inverted index of the redirects of the namespace of host.
+func NamespaceTerms(db *bolt.DB, host string) *TermIndex {
+	return &TermIndex{DB: db, Bucket: NamespaceBucket(TermsBucket, host)}
+}
+
+// Tokenize splits s into the lowercase terms it is indexed and searched by: its runs of letters and digits, each once.
+func Tokenize(s string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(term) > maxTermLength {
+			term = strings.ToValidUTF8(term[:maxTermLength], "")
+		}
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// termEntries returns the index entries of the redirect stored under key as value. Values that are nil or can't be
+// decoded have none.
+func termEntries(key []byte, value []byte) [][]byte {
+	if value == nil {
+		return nil
+	}
+	redirect, err := DecodeRedirect(key, value)
+	if err != nil {
+		return nil
+	}
+	fields := append([]string{redirect.Key, redirect.URL, redirect.Title, redirect.Notes}, redirect.Tags...)
+	text := strings.Join(fields, " ")
+	var entries [][]byte
+	for _, term := range Tokenize(text) {
+		entries = append(entries, append([]byte(term+"\x00"), key...))
+	}
+	return entries
+}
+
+// Update replaces the index entries of the redirect stored under key as oldValue with those of newValue, within tx.
+func (i *TermIndex) Update(tx *bolt.Tx, key []byte, oldValue []byte, newValue []byte) error {
+	b, err := tx.CreateBucketIfNotExists(i.Bucket)
+	if err != nil {
+		return err
+	}
+	for _, entry := range termEntries(key, oldValue) {
+		if err := b.Delete(entry); err != nil {
+			return err
+		}
+	}
+	for _, entry := range termEntries(key, newValue) {
+		if err := b.Put(entry, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchTerms returns the keys of the redirects matching every term of query, ordered by key. Terms match the words
+// they're a prefix of, so that "onboard doc" finds "Onboarding docs". A query without terms matches nothing.
+func (i *TermIndex) SearchTerms(query string) ([]string, error) {
+	var matches map[string]bool
+	for _, term := range Tokenize(query) {
+		found := map[string]bool{}
+		kv := &KVWrapper{DB: i.DB, Bucket: i.Bucket}
+		err := kv.Scan([]byte(term), func(entry []byte, _ []byte) error {
+			key := string(entry[bytes.IndexByte(entry, 0)+1:])
+			if matches == nil || matches[key] {
+				found[key] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		matches = found
+		if len(matches) == 0 {
+			break
+		}
+	}
+
+	keys := make([]string, 0)
+	for key := range matches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Built reports whether the index exists, it is only missing for redirects stored before it was introduced.
+func (i *TermIndex) Built() (bool, error) {
+	return indexBuilt(i.DB, i.Bucket)
+}
+
+// Build indexes every redirect stored in the redirects bucket, replacing the index if there is one.
+// Returns the number of redirects indexed.
+func (i *TermIndex) Build(redirects []byte) (int, error) {
+	return buildIndex(i.DB, i.Bucket, redirects, i.Update)
+}
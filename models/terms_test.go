@@ -0,0 +1,94 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"words", "Onboarding Docs", []string{"onboarding", "docs"}},
+		{"URL", "https://docs.example.com/team/onboarding?id=42", []string{"https", "docs", "example", "com", "team",
+			"onboarding", "id", "42"}},
+		{"key", "q4-report_2026", []string{"q4", "report", "2026"}},
+		{"repeated", "docs docs DOCS", []string{"docs"}},
+		{"unicode", "Café Ünïcode", []string{"café", "ünïcode"}},
+		{"long", strings.Repeat("a", 100), []string{strings.Repeat("a", maxTermLength)}},
+		{"nothing", " -- ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTermIndex(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	redirects := NamespaceRedirects(db, "")
+	terms := NamespaceTerms(db, "")
+
+	put := func(key string, value string) {
+		t.Helper()
+		if err := redirects.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	put("onboarding", `{"url":"https://wiki.example.com/start","title":"Onboarding doc","tags":["hr"]}`)
+	put("handbook", `{"url":"https://wiki.example.com/handbook","notes":"Read this during onboarding"}`)
+	put("q4", `{"url":"https://reports.example.com/q4","tags":["finance","Quarterly"]}`)
+	put("legacy", "https://docs.example.com/legacy")
+
+	search := func(query string, want ...string) {
+		t.Helper()
+		keys, err := terms.SearchTerms(query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("SearchTerms(%q): expected %v, got %v", query, want, keys)
+		}
+	}
+
+	t.Run("search", func(t *testing.T) {
+		search("onboarding", "handbook", "onboarding")
+		search("onboard doc", "onboarding")
+		search("ONBOARD", "handbook", "onboarding")
+		search("wiki", "handbook", "onboarding")
+		search("quarter", "q4")
+		search("legacy docs", "legacy")
+		search("finance hr")
+		search("")
+		search("--")
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		put("q4", `{"url":"https://reports.example.com/q4","title":"Onboarding numbers"}`)
+		if err := redirects.Delete([]byte("handbook")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		search("onboarding", "onboarding", "q4")
+		search("finance")
+	})
+
+	t.Run("build", func(t *testing.T) {
+		count, err := terms.Build(NamespaceBucket(RedirectsBucket, ""))
+		if err != nil || count != 3 {
+			t.Fatalf("expected 3 redirects indexed, got %d (%v)", count, err)
+		}
+		search("onboarding", "onboarding", "q4")
+	})
+}
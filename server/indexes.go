@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// namespaceIndex is an index of a bucket of a namespace.
+type namespaceIndex interface {
+	Built() (bool, error)
+	Build(bucket []byte) (int, error)
+}
+
+// buildIndexes builds the target, term, and dedupe indexes of the redirects, and the reverse index of the aliases, of
+// the default namespace and of every registered domain that aren't built yet, which is the case of redirects and
+// aliases stored before they were introduced. Built indexes are kept up to date as redirects and aliases change.
+func buildIndexes(domainStore *models.DomainStore) error {
+	hosts := []string{""}
+	domains, err := domainStore.List()
+	if err != nil {
+		return err
+	}
+	for _, domain := range domains {
+		hosts = append(hosts, domain.Host)
+	}
+
+	for _, host := range hosts {
+		indexes := []struct {
+			name   string
+			index  namespaceIndex
+			bucket string
+		}{
+			{"targets", models.NamespaceTargets(domainStore.DB, host), models.RedirectsBucket},
+			{"terms", models.NamespaceTerms(domainStore.DB, host), models.RedirectsBucket},
+			{"dedupe entries", models.NamespaceDedupe(domainStore.DB, host), models.RedirectsBucket},
+			{"keys", models.NamespaceAliasKeys(domainStore.DB, host), models.AliasesBucket},
+		}
+		for _, index := range indexes {
+			built, err := index.index.Built()
+			if err != nil {
+				return err
+			}
+			if built {
+				continue
+			}
+			count, err := index.index.Build(models.NamespaceBucket(index.bucket, host))
+			if err != nil {
+				return fmt.Errorf("%s: %w", namespaceName(host), err)
+			}
+			logging.GetLogger().Infof("%s: indexed the %s of %d %s", namespaceName(host), index.name, count, index.bucket)
+		}
+	}
+	return nil
+}
+
+// namespaceName names the namespace of host in logs.
+func namespaceName(host string) string {
+	if host == "" {
+		return "the default namespace"
+	}
+	return host
+}
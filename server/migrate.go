@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/thedeltaflyer/redirector/database"
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
+	"github.com/thedeltaflyer/redirector/models"
+)
+
+// namespaceMigration is the key migration of a namespace.
+type namespaceMigration struct {
+	name      string
+	ns        *models.Namespace
+	migration *models.KeyMigration
+}
+
+// newKeyPolicy creates the key policy configured by config.
+func newKeyPolicy(config Config) (*helpers.KeyPolicy, error) {
+	return helpers.NewKeyPolicy(config.KeyCharset, config.KeyMinLength, config.KeyMaxLength, config.KeyNormalization,
+		config.ReservedKeys)
+}
+
+// planKeyMigrations plans the key migration of the default namespace and of every registered domain.
+func planKeyMigrations(domainStore *models.DomainStore, policy *helpers.KeyPolicy) ([]namespaceMigration, error) {
+	namespaces := []namespaceMigration{{name: namespaceName(""), ns: &models.Namespace{
+		Redirects: models.NamespaceRedirects(domainStore.DB, ""),
+		Logos:     &models.KVWrapper{DB: domainStore.DB, Bucket: []byte(models.LogosBucket)},
+		Aliases:   models.NamespaceAliases(domainStore.DB, ""),
+		Dedupe:    &models.KVWrapper{DB: domainStore.DB, Bucket: []byte(models.DedupeBucket)},
+	}}}
+	domains, err := domainStore.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		namespaces = append(namespaces, namespaceMigration{name: domain.Host, ns: domainStore.Namespace(&domain)})
+	}
+
+	for i := range namespaces {
+		namespaces[i].migration, err = models.PlanKeyMigration(namespaces[i].ns.Redirects, namespaces[i].ns.Aliases,
+			policy.Normalize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return namespaces, nil
+}
+
+// MigrateKeys renames the keys of every namespace to what they normalize to as per config, so that they can be found
+// in any form once normalization is enabled. It logs every key that has to be renamed, and every group of keys that
+// normalize to the same key, which only one of can be kept. Nothing is renamed unless apply is set and no keys collide.
+func MigrateKeys(config Config, apply bool) error {
+	policy, err := newKeyPolicy(config)
+	if err != nil {
+		return err
+	}
+	namespaces, err := planKeyMigrations(&models.DomainStore{DB: database.GetDB()}, policy)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.GetLogger()
+	collisions := 0
+	for _, namespace := range namespaces {
+		for _, rename := range namespace.migration.Renames {
+			logger.Infof("%s: %q becomes %q", namespace.name, rename.From, rename.To)
+		}
+		for _, collision := range namespace.migration.Collisions {
+			logger.Warnf("%s: %q all become %q, only one of them can be kept", namespace.name, collision.Keys, collision.Key)
+		}
+		collisions += len(namespace.migration.Collisions)
+	}
+	if collisions > 0 {
+		return fmt.Errorf("%d groups of keys collide once normalized, rename or delete all but one key of each", collisions)
+	}
+	if !apply {
+		return nil
+	}
+
+	for _, namespace := range namespaces {
+		if err := namespace.migration.Apply(namespace.ns.Redirects, namespace.ns.Logos, namespace.ns.Aliases,
+			namespace.ns.Dedupe); err != nil {
+			return fmt.Errorf("%s: %w", namespace.name, err)
+		}
+		logger.Infof("%s: renamed %d keys", namespace.name, len(namespace.migration.Renames))
+	}
+	return nil
+}
+
+// warnUnmigratedKeys logs a warning if keys need migrating to the key normalization of policy.
+func warnUnmigratedKeys(domainStore *models.DomainStore, policy *helpers.KeyPolicy) {
+	if !policy.Normalizes() {
+		return
+	}
+	namespaces, err := planKeyMigrations(domainStore, policy)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		return
+	}
+	for _, namespace := range namespaces {
+		if renames, collisions := len(namespace.migration.Renames), len(namespace.migration.Collisions); renames > 0 || collisions > 0 {
+			logging.GetLogger().Warnf("%s: %d keys aren't normalized and %d groups of keys collide, see --migrate-keys=check",
+				namespace.name, renames, collisions)
+		}
+	}
+}
@@ -1,20 +1,81 @@
 package server
 
 import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/thedeltaflyer/redirector/controllers"
 	"github.com/thedeltaflyer/redirector/database"
+	"github.com/thedeltaflyer/redirector/helpers"
+	"github.com/thedeltaflyer/redirector/logging"
 	"github.com/thedeltaflyer/redirector/middleware"
 	"github.com/thedeltaflyer/redirector/models"
+	"github.com/thedeltaflyer/redirector/templates"
 )
 
-// Run starts the HTTP server with the specified binding address and debug mode settings.
+// shutdownTimeout is how long the requests in flight are given to finish when the server is shut down.
+const shutdownTimeout = 10 * time.Second
+
+// Config holds the settings used to run the HTTP server.
+type Config struct {
+	Bind        string // Bind host and/or port
+	Debug       bool   // Debug mode option
+	TemplateDir string // Optional directory of page templates overriding the embedded defaults
+	FallbackURL string // Optional URL unknown keys are redirected to, "{key}" is replaced with the requested key
+
+	QRCacheEntries int    // Maximum number of rendered QR codes to cache, 0 disables the cache
+	QRCacheBytes   int64  // Maximum total size of the cached QR codes
+	QRCacheDir     string // Optional directory to store cached QR codes in instead of memory
+	QRContrast     string // Optional policy for QR codes whose colors don't contrast enough (reject, warn, or off)
+
+	TrustedProxies []string      // Optional proxies whose X-Forwarded-For headers are trusted, none of them if nil
+	RedirectRate   float64       // Redirects per second per client IP, 0 disables the limit
+	RedirectBurst  int           // Redirects a client IP can make at once
+	APIRate        float64       // Authenticated requests per second per API key, 0 disables the limit
+	APIBurst       int           // Authenticated requests an API key can make at once
+	AuthFailures   int           // Failed authentication attempts per client IP before it is locked out, 0 disables it
+	AuthLockout    time.Duration // First lockout, doubled every time, also how often a failed attempt is forgiven
+	AuthLockoutMax time.Duration // Longest lockout
+
+	IdempotencyWindow time.Duration // How long responses are replayed to requests repeating their Idempotency-Key, 0 disables it
+
+	URLSchemes      []string // Schemes redirects may use, http and https if empty
+	URLAllowDomains []string // Optional domains redirects must point to, "*.example.com" matches its subdomains
+	URLBlockDomains []string // Domains redirects may not point to, "*.example.com" matches its subdomains
+	URLAllowIPs     bool     // Allow redirects to public IP addresses instead of host names
+	URLAllowPrivate bool     // Allow redirects to private, loopback, and link-local addresses, and to internal hosts
+	URLResolve      bool     // Resolve redirect hosts to reject the ones pointing to private addresses
+
+	PublicHosts   []string // Hosts serving the default namespace, links to them are followed to catch redirect loops
+	MaxChainDepth int      // Our own links a new redirect may go through before it's flattened, 0 never flattens
+
+	KeyCharset       string   // Characters keys may use, as a regular expression character class
+	KeyMinLength     int      // Shortest key, in characters
+	KeyMaxLength     int      // Longest key, in characters
+	KeyNormalization string   // How keys are normalized on write and read (none, lower, or canonical)
+	ReservedKeys     []string // Keys that can't be used, on top of the first segment of every route
+
+	KeyGenerator string // Generator of the keys of redirects created without one (nanoid, base32, or words)
+	KeyAlphabet  string // Optional characters of nanoid keys
+	KeyLength    int    // Characters of nanoid and base32 keys, or digits ending word keys, 0 for the default
+}
+
+// Run starts the HTTP server with the specified configuration.
 // It initializes controllers, middleware, and routes for handling HTTP requests.
-// The function panics if the server fails to start.
-func Run(bind string, debug bool) {
+// The function panics if the server fails to start, and returns once it was shut down by SIGINT or SIGTERM.
+func Run(config Config) {
 	// Set ReleaseMode if we're not debugging.
-	if !debug {
+	if !config.Debug {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
@@ -25,16 +86,51 @@ func Run(bind string, debug bool) {
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 
-	// KV for the "redirects" bucket.
-	redirectKV := &models.KVWrapper{
-		DB:     database.GetDB(),
-		Bucket: []byte("redirects"),
+	// Only trust the configured proxies to report client IPs, which rate limits are based on.
+	if err := trustProxies(r, config.TrustedProxies); err != nil {
+		panic(err)
 	}
 
+	// KV for the "redirects" bucket, along with its indexes by target in the "targets" bucket and by term in the
+	// "terms" bucket.
+	redirectKV := models.NamespaceRedirects(database.GetDB(), "")
+	targetIndex := models.NamespaceTargets(database.GetDB(), "")
+	termIndex := models.NamespaceTerms(database.GetDB(), "")
+
 	// KV for the "api_keys" bucket.
 	apiKeyKV := &models.KVWrapper{
 		DB:     database.GetDB(),
-		Bucket: []byte("api_keys"),
+		Bucket: []byte(models.APIKeysBucket),
+	}
+
+	// Log of unknown keys for the "misses" bucket, counted in memory along with those of the domains.
+	missBuffer := &models.MissBuffer{
+		DB: database.GetDB(),
+	}
+	missLog := &models.MissLog{
+		Buffer: missBuffer,
+		Bucket: []byte(models.MissesBucket),
+	}
+
+	// KV for the "logos" bucket.
+	logoKV := &models.KVWrapper{
+		DB:     database.GetDB(),
+		Bucket: []byte(models.LogosBucket),
+	}
+
+	// KV for the "aliases" bucket, indexed by the keys they stand for.
+	aliasKV := models.NamespaceAliases(database.GetDB(), "")
+
+	// KV for the "dedupe" bucket.
+	dedupeKV := &models.KVWrapper{
+		DB:     database.GetDB(),
+		Bucket: []byte(models.DedupeBucket),
+	}
+
+	// KV for the "history" bucket.
+	historyKV := &models.KVWrapper{
+		DB:     database.GetDB(),
+		Bucket: []byte(models.HistoryBucket),
 	}
 
 	// KV for the "health_checks" bucket.
@@ -43,15 +139,113 @@ func Run(bind string, debug bool) {
 		Bucket: []byte("health_checks"),
 	}
 
+	// Store for the registered domains and their namespaces.
+	domainStore := &models.DomainStore{
+		DB:     database.GetDB(),
+		Misses: missBuffer,
+	}
+
+	// Load the page templates.
+	pages, err := templates.Load(config.TemplateDir)
+	if err != nil {
+		panic(err)
+	}
+
+	// Policy for low contrast QR codes.
+	switch config.QRContrast {
+	case "":
+	case helpers.QRContrastReject, helpers.QRContrastWarn, helpers.QRContrastOff:
+		helpers.QRContrastPolicy = config.QRContrast
+	default:
+		panic(fmt.Sprintf("invalid QR contrast policy (must be one of reject,warn,off): %s", config.QRContrast))
+	}
+
+	// Cache of rendered QR codes.
+	var qrCache *helpers.QRCache
+	if config.QRCacheEntries > 0 {
+		qrCache, err = helpers.NewQRCache(config.QRCacheEntries, config.QRCacheBytes, config.QRCacheDir)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Policy for the URLs redirects may point to.
+	urlPolicy := &helpers.URLPolicy{
+		Schemes:      config.URLSchemes,
+		AllowDomains: config.URLAllowDomains,
+		BlockDomains: config.URLBlockDomains,
+		AllowIPs:     config.URLAllowIPs,
+		AllowPrivate: config.URLAllowPrivate,
+	}
+	if config.URLResolve {
+		urlPolicy.Resolver = net.DefaultResolver
+	}
+
+	// Policy for the keys of new redirects, the routes are reserved once they're all set up.
+	keyPolicy, err := newKeyPolicy(config)
+	if err != nil {
+		panic(err)
+	}
+	warnUnmigratedKeys(domainStore, keyPolicy)
+
+	// Index the redirects stored before they were indexed.
+	if err := buildIndexes(domainStore); err != nil {
+		panic(err)
+	}
+
+	// Generator for the keys of redirects created without one, requests may pick another one by name.
+	keyGenerator, err := helpers.NewKeyGenerator(config.KeyGenerator, config.KeyAlphabet, config.KeyLength)
+	if err != nil {
+		panic(err)
+	}
+	if err := keyPolicy.CheckGenerator(keyGenerator); err != nil {
+		panic(err)
+	}
+
 	// Create the controllers.
-	root := &controllers.RootController{}
+	root := &controllers.RootController{
+		Namespaces: domainStore,
+		Templates:  pages,
+	}
 	health := &controllers.HealthController{
 		KV: healthKV,
 	}
 	redirector := &controllers.RedirectorController{
-		KV: redirectKV,
+		KV:          redirectKV,
+		Namespaces:  domainStore,
+		Templates:   pages,
+		Misses:      missLog,
+		FallbackURL: config.FallbackURL,
+		Logos:       logoKV,
+		QRCache:     qrCache,
+		URLPolicy:   urlPolicy,
+
+		PublicHosts:   config.PublicHosts,
+		MaxChainDepth: config.MaxChainDepth,
+		KeyPolicy:     keyPolicy,
+		Aliases:       aliasKV,
+		KeyGenerator:  keyGenerator,
+		KeyGenerators: map[string]helpers.KeyGenerator{config.KeyGenerator: keyGenerator},
+		Dedupe:        dedupeKV,
+		Targets:       targetIndex,
+		Terms:         termIndex,
+		History:       historyKV,
+	}
+	domains := &controllers.DomainController{
+		Store:     domainStore,
+		URLPolicy: urlPolicy,
 	}
 
+	// Rate limits for redirects, authenticated requests, and failed authentication attempts.
+	redirectLimit := middleware.RateLimitMiddleware(
+		middleware.NewRateLimiter(config.RedirectRate, config.RedirectBurst), middleware.ClientIPKey)
+	apiLimit := middleware.RateLimitMiddleware(middleware.NewRateLimiter(config.APIRate, config.APIBurst), middleware.APIKeyKey)
+	authLockout := middleware.AuthLockoutMiddleware(
+		middleware.NewAuthLockout(config.AuthFailures, config.AuthLockout, config.AuthLockoutMax))
+
+	// Replays of requests repeating their Idempotency-Key.
+	idempotency := middleware.IdempotencyMiddleware(middleware.NewIdempotencyStore(config.IdempotencyWindow))
+
 	// Set up static and health routes
 	rootGroup := r.Group("/")
 	rootGroup.GET("", root.HandleGet)
@@ -59,18 +253,88 @@ func Run(bind string, debug bool) {
 
 	// Set up unauthenticated redirection routes
 	redirectorGroup := r.Group("/")
+	redirectorGroup.Use(redirectLimit)
 	redirectorGroup.GET("/:key/*mode", redirector.HandleGet)
 
+	// Set up domain administration routes, these only accept global API keys
+	domainGroup := r.Group("/api/domains")
+	domainGroup.Use(authLockout, middleware.TokenAuthMiddleware(apiKeyKV), apiLimit)
+	domainGroup.GET("", domains.HandleList)
+	domainGroup.POST("", domains.HandlePost)
+	domainGroup.GET("/:host", domains.HandleGet)
+	domainGroup.PUT("/:host", domains.HandlePut)
+	domainGroup.DELETE("/:host", domains.HandleDelete)
+	domainGroup.POST("/:host/keys", domains.HandlePostKey)
+	domainGroup.DELETE("/:host/keys", domains.HandleDeleteKey)
+
+	// Set up the metrics route, it only accepts global API keys
+	metricsGroup := r.Group("/api/metrics")
+	metricsGroup.Use(authLockout, middleware.TokenAuthMiddleware(apiKeyKV), apiLimit)
+	metricsGroup.GET("", gin.WrapH(expvar.Handler()))
+
 	// Set up authenticated redirection routes
 	createRedirectorGroup := r.Group("/")
-	createRedirectorGroup.Use(middleware.TokenAuthMiddleware(apiKeyKV))
-	createRedirectorGroup.POST("", redirector.HandlePost)
-	createRedirectorGroup.POST("/:key", redirector.HandlePost)
+	createRedirectorGroup.Use(authLockout, middleware.DomainTokenAuthMiddleware(apiKeyKV, domainStore), apiLimit)
+	createRedirectorGroup.POST("", idempotency, redirector.HandlePost)
+	createRedirectorGroup.POST("/:key", idempotency, redirector.HandlePost)
 	createRedirectorGroup.PUT("/:key", redirector.HandlePutWithKey)
+	createRedirectorGroup.DELETE("/:key", redirector.HandleDelete)
+	createRedirectorGroup.GET("/api/misses", redirector.HandleGetMisses)
+	createRedirectorGroup.POST("/api/qr", redirector.HandlePostQR)
+	createRedirectorGroup.POST("/api/qr/batch", redirector.HandlePostQRBatch)
+	createRedirectorGroup.PUT("/api/logo", redirector.HandlePutLogo)
+	createRedirectorGroup.DELETE("/api/logo", redirector.HandleDeleteLogo)
+	createRedirectorGroup.PUT("/api/logo/:key", redirector.HandlePutLogo)
+	createRedirectorGroup.DELETE("/api/logo/:key", redirector.HandleDeleteLogo)
+	createRedirectorGroup.GET("/api/aliases", redirector.HandleGetAliases)
+	createRedirectorGroup.PUT("/api/aliases/:alias", redirector.HandlePutAlias)
+	createRedirectorGroup.DELETE("/api/aliases/:alias", redirector.HandleDeleteAlias)
+	createRedirectorGroup.GET("/api/search", redirector.HandleSearch)
+	createRedirectorGroup.POST("/api/retarget", redirector.HandlePostRetarget)
+	createRedirectorGroup.GET("/api/history", redirector.HandleGetHistory)
 
-	// Start the server
-	err := r.Run(bind)
-	if err != nil {
+	// Keep keys from shadowing routes.
+	keyPolicy.Reserve(routeKeys(r.Routes())...)
+
+	// Start the server, and stop it on SIGINT or SIGTERM once the requests in flight are done.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	httpServer := &http.Server{Addr: config.Bind, Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
 		panic(err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logging.GetLogger().Error(err)
+	}
+	// Misses counted since the last flush would be lost otherwise.
+	if err := missBuffer.Close(); err != nil {
+		logging.GetLogger().Error(err)
+	}
+}
+
+// trustProxies makes r trust the X-Forwarded-For header of proxies only, none if proxies is empty. Gin trusts every
+// peer by default, which would let clients pick the IP their requests are rate limited and locked out by.
+func trustProxies(r *gin.Engine, proxies []string) error {
+	return r.SetTrustedProxies(proxies)
+}
+
+// routeKeys returns the first segment of the routes that start with a fixed one, which keys can't be.
+func routeKeys(routes gin.RoutesInfo) []string {
+	var keys []string
+	for _, route := range routes {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route.Path, "/"), "/")
+		if segment != "" && !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			keys = append(keys, segment)
+		}
 	}
+	return keys
 }
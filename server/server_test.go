@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thedeltaflyer/redirector/middleware"
+)
+
+func TestTrustProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		proxies      []string
+		peer         string
+		expectLimit  bool
+		expectClient string
+	}{
+		{"no proxies", nil, "203.0.113.7:1234", true, "203.0.113.7"},
+		{"untrusted peer", []string{"10.0.0.1"}, "203.0.113.7:1234", true, "203.0.113.7"},
+		{"trusted proxy", []string{"10.0.0.1"}, "10.0.0.1:1234", false, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if err := trustProxies(r, tt.proxies); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r.Use(middleware.RateLimitMiddleware(middleware.NewRateLimiter(1, 1), middleware.ClientIPKey))
+			r.GET("/", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			// Spoofing another X-Forwarded-For on every request doesn't reset the limit of an untrusted peer.
+			var codes []int
+			for i, forwarded := range []string{"198.51.100.1", "198.51.100.2"} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = tt.peer
+				req.Header.Set("X-Forwarded-For", forwarded)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				codes = append(codes, w.Code)
+				if i == 0 && w.Body.String() != tt.expectClient {
+					t.Errorf("expected client IP %q, got %q", tt.expectClient, w.Body.String())
+				}
+			}
+			if limited := codes[1] == http.StatusTooManyRequests; limited != tt.expectLimit {
+				t.Errorf("expected the second request to be limited: %v, got status %d", tt.expectLimit, codes[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Names of the pages that can be customized.
+const (
+	Root     = "root"
+	NotFound = "not_found"
+)
+
+//go:embed default/*.html
+var defaults embed.FS
+
+// Page holds the data available to every page template.
+type Page struct {
+	Host string // Normalized host of the request
+	Text string // Root page text for the host
+	Key  string // Requested key, if any
+}
+
+// Set holds the page templates, keyed by name, with optional overrides per domain.
+type Set struct {
+	global  map[string]*template.Template
+	domains map[string]map[string]*template.Template
+}
+
+// Load builds a Set from the embedded defaults, overridden by "<name>.html" files in dir and by
+// "<host>/<name>.html" files for a single domain. An empty dir only loads the defaults.
+func Load(dir string) (*Set, error) {
+	set := &Set{
+		global:  make(map[string]*template.Template),
+		domains: make(map[string]map[string]*template.Template),
+	}
+
+	for _, name := range []string{Root, NotFound} {
+		tmpl, err := template.ParseFS(defaults, "default/"+name+".html")
+		if err != nil {
+			return nil, err
+		}
+		set.global[name] = tmpl
+	}
+
+	if dir == "" {
+		return set, nil
+	}
+
+	overrides, err := loadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, tmpl := range overrides {
+		set.global[name] = tmpl
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		overrides, err := loadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(overrides) > 0 {
+			set.domains[entry.Name()] = overrides
+		}
+	}
+
+	return set, nil
+}
+
+// Render executes the named template for host, preferring the domain's own override, and writes the result to w.
+func (s *Set) Render(w io.Writer, host string, name string, page Page) error {
+	tmpl, ok := s.domains[host][name]
+	if !ok {
+		tmpl, ok = s.global[name]
+	}
+	if !ok {
+		return fmt.Errorf("unknown template %q", name)
+	}
+	return tmpl.Execute(w, page)
+}
+
+// loadDir parses any of the known page templates found in dir.
+func loadDir(dir string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	for _, name := range []string{Root, NotFound} {
+		path := filepath.Join(dir, name+".html")
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+	}
+	return templates, nil
+}
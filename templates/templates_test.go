@@ -0,0 +1,94 @@
+package templates
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create template dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, filepath.Join(dir, "root.html"), "global root: {{ .Text }}")
+	writeTemplate(t, filepath.Join(dir, "go.team-a", "not_found.html"), "team a missing: {{ .Key }}")
+
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		template string
+		page     Page
+		contains string
+		wantErr  bool
+	}{
+		{name: "global override", host: "lnk.now", template: Root, page: Page{Text: "hi"}, contains: "global root: hi"},
+		{name: "global override on domain", host: "go.team-a", template: Root, page: Page{Text: "hi"}, contains: "global root: hi"},
+		{name: "domain override", host: "go.team-a", template: NotFound, page: Page{Key: "abc"}, contains: "team a missing: abc"},
+		{name: "embedded default", host: "lnk.now", template: NotFound, page: Page{Key: "<abc>"}, contains: "&lt;abc&gt;"},
+		{name: "unknown template", host: "lnk.now", template: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := set.Render(&buf, tt.host, tt.template, tt.page)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.contains) {
+				t.Errorf("expected output to contain %q, got %q", tt.contains, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Run("missing directory", func(t *testing.T) {
+		if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, filepath.Join(dir, "root.html"), "{{ .Text ")
+		if _, err := Load(dir); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := set.Render(&buf, "", Root, Page{Text: "Welcome"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "<p>Welcome</p>") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}